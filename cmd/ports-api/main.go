@@ -2,74 +2,290 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
 	"syscall"
-	"time"
 
 	"github.com/WendelHime/ports/internal/api/rest/endpoints"
+	"github.com/WendelHime/ports/internal/config"
+	"github.com/WendelHime/ports/internal/events"
+	"github.com/WendelHime/ports/internal/logging"
 	"github.com/WendelHime/ports/internal/logic"
+	"github.com/WendelHime/ports/internal/metrics"
+	"github.com/WendelHime/ports/internal/seed"
 	"github.com/WendelHime/ports/internal/storage"
+	"github.com/WendelHime/ports/internal/webhooks"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	_ "modernc.org/sqlite"
 )
 
 func main() {
-	repository := storage.NewPortRepository()
-	svc := logic.NewPortDomainService(repository)
+	// "ports-api dump-config [flags]" prints the effective configuration
+	args := os.Args[1:]
+	dumpConfig := len(args) > 0 && args[0] == "dump-config"
+	if dumpConfig {
+		args = args[1:]
+	}
+	cfg, err := config.Load(filepath.Base(os.Args[0]), args, os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if dumpConfig {
+		err = cfg.Dump(os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	logger, err := logging.New(os.Stderr, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+
+	repository, closeRepository, err := newRepository(cfg.Storage)
+	if err != nil {
+		fatal(logger, "failed to open the storage", err)
+	}
+	// the file and sqlite backends persist the ports history along the writes
+	auditStore, _ := repository.(storage.AuditStore)
+	hub := events.NewHub(cfg.Changes.Buffer)
+	audited, err := storage.NewAuditedPortRepository(repository, auditStore, cfg.History.Retention, hub)
+	if err != nil {
+		fatal(logger, "failed to load the ports history", err)
+	}
+	reg := metrics.NewRegistry()
+	metered := storage.NewMeteredPortRepository(audited, reg)
+	svc := logic.NewMeteredPortDomainService(logic.NewPortDomainService(metered, audited), reg)
 	handlers := endpoints.NewPortHTTPHandlers(svc)
+	changeHandlers := endpoints.NewChangeHTTPHandlers(hub)
+	webhookService := webhooks.NewService(hub, webhooks.Options{
+		MaxAttempts:         cfg.Webhooks.Attempts,
+		Backoff:             cfg.Webhooks.Backoff,
+		Timeout:             cfg.Webhooks.Timeout,
+		AllowPrivateTargets: cfg.Webhooks.AllowPrivateTargets,
+	})
+	webhookHandlers := endpoints.NewWebhookHTTPHandlers(webhookService)
+	healthHandlers := endpoints.NewHealthHTTPHandlers()
 
 	// The HTTP Server
-	server := &http.Server{Addr: "0.0.0.0:8080", Handler: service(handlers)}
+	server := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           service(cfg, logger, reg, handlers, changeHandlers, webhookHandlers, healthHandlers),
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	// the change streams only end with their clients, so they're closed on
+	// shutdown instead of holding it until its timeout
+	server.RegisterOnShutdown(changeHandlers.Close)
 
 	// Server run context
 	serverCtx, serverStopCtx := context.WithCancel(context.Background())
 
+	// Background tasks run context, done once the server stops
+	runCtx, stopRunning := context.WithCancel(logging.WithLogger(context.Background(), logger))
+	var background sync.WaitGroup
+
+	// Deliver the port changes to the webhooks until the server stops
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		err := webhookService.Run(runCtx)
+		if err != nil {
+			logger.Error("webhook deliveries stopped", "error", err.Error())
+		}
+	}()
+
+	var watcher *seed.Watcher
+	if cfg.Watch.Path != "" {
+		watcher = seed.NewWatcher(svc, cfg.Watch.Path, cfg.Watch.Interval)
+	}
+
+	// Seed the catalogue while the server is up but not ready yet, then keep
+	// it synced with the watched file
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		if len(cfg.Seed.Paths) > 0 {
+			logger.Info("seeding ports", "paths", strings.Join(cfg.Seed.Paths, ","))
+			loader := seed.NewLoader(svc, logic.SyncOptions{Lenient: cfg.Seed.Lenient})
+			report, err := loader.Load(runCtx, cfg.Seed.Paths)
+			if runCtx.Err() != nil {
+				logger.Warn("seeding interrupted by the shutdown")
+				return
+			}
+			if err != nil {
+				fatal(logger, "failed to seed ports", err)
+			}
+			logger.Info("seeded ports",
+				"created", report.Created,
+				"updated", report.Updated,
+				"unchanged", report.Unchanged,
+				"failed", report.Failed,
+				"duration_ms", report.DurationMs,
+			)
+		}
+		if watcher != nil {
+			err := watcher.Load(runCtx)
+			if runCtx.Err() != nil {
+				return
+			}
+			if err != nil {
+				fatal(logger, "failed to load the watched ports file", err)
+			}
+		}
+		healthHandlers.MarkReady()
+		if watcher != nil {
+			watcher.Run(runCtx)
+		}
+	}()
+
+	// SIGHUP reloads the watched ports file
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if watcher == nil {
+				logger.Warn("no ports file is watched, nothing to reload on SIGHUP")
+				continue
+			}
+			watcher.Reload()
+		}
+	}()
+
 	// Listen for syscall signals for process to interrupt/quit
 	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	go func() {
 		<-sig
 
-		// Shutdown signal with grace period of 30 seconds
-		shutdownCtx, cancel := context.WithTimeout(serverCtx, 30*time.Second)
+		// Shutdown signal with the configured grace period
+		shutdownCtx, cancel := context.WithTimeout(serverCtx, cfg.Server.ShutdownTimeout)
 		defer cancel()
 
 		go func() {
 			<-shutdownCtx.Done()
 			if shutdownCtx.Err() == context.DeadlineExceeded {
-				log.Fatal("graceful shutdown timed out.. forcing exit.")
+				fatal(logger, "graceful shutdown timed out.. forcing exit.", shutdownCtx.Err())
 			}
 		}()
 
 		// Trigger graceful shutdown
 		err := server.Shutdown(shutdownCtx)
 		if err != nil {
-			log.Fatal(err)
+			fatal(logger, "failed to shut the server down", err)
 		}
 		serverStopCtx()
 	}()
 
 	// Run the server
-	err := server.ListenAndServe()
+	logger.Info("listening", "addr", cfg.Server.Addr)
+	err = server.ListenAndServe()
 	if err != nil && err != http.ErrServerClosed {
-		log.Fatal(err)
+		fatal(logger, "server failed", err)
 	}
 
 	// Wait for server context to be stopped
 	<-serverCtx.Done()
+
+	// the pending webhook deliveries and the seeding are given up
+	stopRunning()
+	background.Wait()
+
+	err = closeRepository()
+	if err != nil {
+		fatal(logger, "failed to close the storage", err)
+	}
 }
 
-func service(handlers *endpoints.PortHandlers) http.Handler {
+// fatal logs the error and exits
+func fatal(logger *slog.Logger, message string, err error) {
+	logger.Error(message, "error", err.Error())
+	os.Exit(1)
+}
+
+// newRepository builds the selected storage backend and returns the function
+// releasing its resources on shutdown
+func newRepository(cfg config.StorageConfig) (storage.PortRepository, func() error, error) {
+	switch cfg.Backend {
+	case "memory":
+		return storage.NewPortRepository(), func() error { return nil }, nil
+	case "file":
+		repository, err := storage.NewFilePortRepository(cfg.DataDir, cfg.CompactEvery)
+		if err != nil {
+			return nil, nil, err
+		}
+		return repository, repository.(io.Closer).Close, nil
+	case "sqlite":
+		db, err := sql.Open("sqlite", cfg.SQLitePath+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+		if err != nil {
+			return nil, nil, err
+		}
+		repository, err := storage.NewSQLPortRepository(db)
+		if err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		return repository, db.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
+
+func service(cfg config.Config, logger *slog.Logger, reg *prometheus.Registry, handlers *endpoints.PortHandlers, changeHandlers *endpoints.ChangeHandlers, webhookHandlers *endpoints.WebhookHandlers, healthHandlers *endpoints.HealthHandlers) http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
-	r.Use(middleware.Logger)
+	r.Use(metrics.Requests(reg))
+	r.Use(logging.Requests(logger, cfg.Log.Requests))
+
+	r.Get("/healthz", healthHandlers.Live)
+	r.Get("/readyz", healthHandlers.Ready)
+	r.Get("/metrics", metrics.Handler(reg).ServeHTTP)
+
+	// the sync body holds the whole catalogue, so it has its own limit, and
+	// the port writes wait for the seeding to complete
+	r.With(endpoints.LimitBody(cfg.Limits.SyncBodyBytes), healthHandlers.RequireReady).Post("/ports", handlers.SyncPorts)
+
+	r.Group(func(r chi.Router) {
+		r.Use(endpoints.LimitBody(cfg.Limits.BodyBytes))
+		r.Get("/ports", handlers.ListPorts)
+		r.Get("/ports/nearby", handlers.NearbyPorts)
+		r.Get("/ports/within", handlers.PortsWithin)
+		r.Get("/ports/search", handlers.SearchPorts)
+		r.Get("/ports/export", handlers.ExportPorts)
+		r.Get("/ports/changes", changeHandlers.StreamChanges)
+		r.Get("/ports/{unloc}", handlers.GetPortByUnloc)
+		r.Get("/ports/{unloc}/history", handlers.PortHistory)
+		r.With(healthHandlers.RequireReady).Put("/ports/{unloc}", handlers.PutPort)
+		r.With(healthHandlers.RequireReady).Patch("/ports/{unloc}", handlers.PatchPort)
+		r.With(healthHandlers.RequireReady).Delete("/ports/{unloc}", handlers.DeletePort)
 
-	r.Post("/ports", handlers.SyncPorts)
-	r.Get("/ports/{unloc}", handlers.GetPortByUnloc)
+		r.Post("/webhooks", webhookHandlers.RegisterWebhook)
+		r.Get("/webhooks", webhookHandlers.ListWebhooks)
+		r.Get("/webhooks/{id}", webhookHandlers.GetWebhook)
+		r.Delete("/webhooks/{id}", webhookHandlers.DeleteWebhook)
+		r.Get("/webhooks/{id}/deliveries", webhookHandlers.WebhookDeliveries)
+	})
 
 	return r
 }
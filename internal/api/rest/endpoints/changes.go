@@ -0,0 +1,128 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/WendelHime/ports/internal/events"
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/WendelHime/ports/internal/shared/models"
+)
+
+// keepAliveInterval is how often a comment is sent on idle change streams, so
+// proxies don't close them
+const keepAliveInterval = 15 * time.Second
+
+// ChangeHandlers holds the hub the port changes are streamed from
+type ChangeHandlers struct {
+	hub       *events.Hub
+	keepAlive time.Duration
+	// closed ends the open streams, as the server shutdown doesn't
+	closed    chan struct{}
+	closeOnce *sync.Once
+}
+
+func NewChangeHTTPHandlers(hub *events.Hub) *ChangeHandlers {
+	return &ChangeHandlers{
+		hub:       hub,
+		keepAlive: keepAliveInterval,
+		closed:    make(chan struct{}),
+		closeOnce: new(sync.Once),
+	}
+}
+
+// Close ends the open streams and the ones opened afterwards, so the server
+// shutdown doesn't wait for them. Subscribers resume from their last event.
+func (h *ChangeHandlers) Close() {
+	h.closeOnce.Do(func() {
+		close(h.closed)
+	})
+}
+
+// StreamChanges streams the port changes as Server-Sent Events identified by
+// their sequence. With the Last-Event-ID header the stream resumes after that
+// event, starting with a reset event when some changes were missed.
+func (h *ChangeHandlers) StreamChanges(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondError(w, localErrs.New(localErrs.CodeInternal, "streaming isn't supported"))
+		return
+	}
+
+	var sub *events.Subscription
+	var missed []models.PortEvent
+	complete := true
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		lastID, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			respondError(w, localErrs.New(localErrs.CodeBadRequest, "Last-Event-ID must be the sequence of an event"))
+			return
+		}
+		sub, missed, complete = h.hub.Resume(lastID)
+	} else {
+		sub = h.hub.Subscribe()
+	}
+	defer h.hub.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if !complete {
+		// the changes between the last event and the buffered ones are lost,
+		// so the subscriber must read the ports again
+		_, err := fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+		if err != nil {
+			return
+		}
+	}
+	for _, event := range missed {
+		err := writeEvent(w, event)
+		if err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(h.keepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.closed:
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				// dropped for falling behind, the subscriber resumes
+				// from its last event
+				return
+			}
+			err := writeEvent(w, event)
+			if err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			_, err := fmt.Fprint(w, ": keep-alive\n\n")
+			if err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes the event on the Server-Sent Events format
+func writeEvent(w http.ResponseWriter, event models.PortEvent) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Sequence, event.Type, b)
+	return err
+}
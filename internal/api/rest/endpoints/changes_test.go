@@ -0,0 +1,120 @@
+package endpoints
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WendelHime/ports/internal/events"
+	"github.com/WendelHime/ports/internal/shared/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func publish(hub *events.Hub, unlocs ...string) {
+	for _, unloc := range unlocs {
+		port := models.Port{Unloc: unloc}
+		hub.PortsChanged([]models.AuditEntry{{Unloc: unloc, Action: models.AuditCreated, New: &port}})
+	}
+}
+
+func TestStreamChangesResume(t *testing.T) {
+	var tests = []struct {
+		name        string
+		lastEventID string
+		assert      func(t *testing.T, w *httptest.ResponseRecorder)
+	}{
+		{
+			name:        "Resume should stream the events after the last one",
+			lastEventID: "1",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, w.Code)
+				assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+				body := w.Body.String()
+				assert.NotContains(t, body, "id: 1\n")
+				assert.Contains(t, body, "id: 2\nevent: created\ndata: {\"sequence\":2,\"type\":\"created\",\"unloc\":\"AEAUH\"")
+				assert.Contains(t, body, "id: 3\nevent: created\n")
+				assert.NotContains(t, body, "event: reset")
+			},
+		},
+		{
+			name:        "Resume from an unknown event should start with a reset",
+			lastEventID: "7",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, w.Code)
+				assert.True(t, strings.HasPrefix(w.Body.String(), "event: reset\ndata: {}\n\n"))
+			},
+		},
+		{
+			name:        "Invalid Last-Event-ID should return a bad request error",
+			lastEventID: "latest",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := events.NewHub(10)
+			publish(hub, "AEAJM", "AEAUH", "AEDXB")
+
+			// a finished request streams the missed events and returns
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			req := httptest.NewRequest(http.MethodGet, "/ports/changes", nil).WithContext(ctx)
+			req.Header.Set("Last-Event-ID", tt.lastEventID)
+			w := httptest.NewRecorder()
+			NewChangeHTTPHandlers(hub).StreamChanges(w, req)
+			tt.assert(t, w)
+		})
+	}
+}
+
+func TestStreamChangesLive(t *testing.T) {
+	hub := events.NewHub(10)
+	publish(hub, "AEAJM")
+	server := httptest.NewServer(http.HandlerFunc(NewChangeHTTPHandlers(hub).StreamChanges))
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// the stream is subscribed once its headers are received
+	publish(hub, "AEAUH")
+	reader := bufio.NewReader(res.Body)
+	var lines []string
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	assert.Equal(t, "id: 2", lines[0])
+	assert.Equal(t, "event: created", lines[1])
+	assert.Contains(t, lines[2], `"unloc":"AEAUH"`)
+}
+
+func TestStreamChangesShutdown(t *testing.T) {
+	handlers := NewChangeHTTPHandlers(events.NewHub(10))
+	server := httptest.NewServer(http.HandlerFunc(handlers.StreamChanges))
+	defer server.Close()
+	server.Config.RegisterOnShutdown(handlers.Close)
+
+	res, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// the open stream shouldn't hold the shutdown until its timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, server.Config.Shutdown(ctx))
+	_, err = io.ReadAll(res.Body)
+	assert.NoError(t, err)
+}
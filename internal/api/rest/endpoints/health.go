@@ -0,0 +1,50 @@
+package endpoints
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+)
+
+// HealthHandlers reports whether the server is alive and ready to serve
+type HealthHandlers struct {
+	ready atomic.Bool
+}
+
+// NewHealthHTTPHandlers returns the handlers of a server not ready yet
+func NewHealthHTTPHandlers() *HealthHandlers {
+	return &HealthHandlers{}
+}
+
+// MarkReady makes the readiness probe succeed from now on
+func (h *HealthHandlers) MarkReady() {
+	h.ready.Store(true)
+}
+
+// Live answers whenever the server is up
+func (h *HealthHandlers) Live(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, map[string]string{"status": "ok"})
+}
+
+// Ready answers with service unavailable until the server is marked ready,
+// e.g. while the catalogue is seeded
+func (h *HealthHandlers) Ready(w http.ResponseWriter, r *http.Request) {
+	if !h.ready.Load() {
+		respondError(w, localErrs.New(localErrs.CodeUnavailable, "the server isn't ready yet"))
+		return
+	}
+	respondJSON(w, map[string]string{"status": "ready"})
+}
+
+// RequireReady answers with service unavailable until the server is marked
+// ready, so the writes can't race with the seeding
+func (h *HealthHandlers) RequireReady(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.ready.Load() {
+			respondError(w, localErrs.New(localErrs.CodeUnavailable, "the server isn't ready to accept writes yet"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,45 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth(t *testing.T) {
+	handlers := NewHealthHTTPHandlers()
+
+	w := httptest.NewRecorder()
+	handlers.Live(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	handlers.Ready(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"unavailable"`)
+
+	handlers.MarkReady()
+	w = httptest.NewRecorder()
+	handlers.Ready(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ready"}`, w.Body.String())
+}
+
+func TestRequireReady(t *testing.T) {
+	handlers := NewHealthHTTPHandlers()
+	next := handlers.RequireReady(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	w := httptest.NewRecorder()
+	next.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/ports/UNLOC", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"unavailable"`)
+
+	handlers.MarkReady()
+	w = httptest.NewRecorder()
+	next.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/ports/UNLOC", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
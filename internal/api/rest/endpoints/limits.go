@@ -0,0 +1,26 @@
+package endpoints
+
+import (
+	"fmt"
+	"net/http"
+
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+)
+
+// LimitBody rejects the requests declaring a body larger than limit bytes and
+// cuts the longer ones, which then fail to decode. A zero limit disables it.
+func LimitBody(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				respondError(w, localErrs.New(localErrs.CodePayloadTooLarge, fmt.Sprintf("body must not be larger than %d bytes", limit)))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package endpoints
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitBody(t *testing.T) {
+	var tests = []struct {
+		name           string
+		limit          int64
+		body           string
+		chunked        bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Body within the limit should be read",
+			limit:          5,
+			body:           "ports",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "ports",
+		},
+		{
+			name:           "Body declared larger than the limit should be rejected",
+			limit:          4,
+			body:           "ports",
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "Streamed body larger than the limit should be cut",
+			limit:          4,
+			body:           "ports",
+			chunked:        true,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Zero limit shouldn't limit the body",
+			body:           "ports",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "ports",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := LimitBody(tt.limit)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, err := io.ReadAll(r.Body)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				_, _ = w.Write(b)
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/ports", strings.NewReader(tt.body))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
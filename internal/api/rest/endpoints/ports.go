@@ -2,11 +2,19 @@
 package endpoints
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/WendelHime/ports/internal/logic"
 	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/WendelHime/ports/internal/shared/models"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -21,26 +29,55 @@ func NewPortHTTPHandlers(service logic.PortDomainService) *PortHandlers {
 	}
 }
 
-// SyncPorts is an upsert endpoint that insert/update ports data
+// SyncPorts is an upsert endpoint that insert/update ports data, with the
+// mode=replace query parameter the ports missing from the body are deleted
+// and with lenient=true the records that can't be decoded are skipped
 func (h *PortHandlers) SyncPorts(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
-	err := h.service.SyncPorts(r.Context(), r.Body)
+	query := r.URL.Query()
+	opts := logic.SyncOptions{Mode: logic.SyncMode(query.Get("mode"))}
+	if lenient := query.Get("lenient"); lenient != "" {
+		var err error
+		opts.Lenient, err = strconv.ParseBool(lenient)
+		if err != nil {
+			respondError(w, localErrs.New(localErrs.CodeBadRequest, "lenient must be a boolean"))
+			return
+		}
+	}
+	report, err := h.service.SyncPorts(r.Context(), r.Body, opts)
 	if err != nil {
 		respondError(w, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+	respondJSON(w, report)
 }
 
-// GetPortByUnloc retrieves the port data based on unloc provided parameter
+// GetPortByUnloc retrieves the port data based on unloc provided parameter,
+// as it was at the as_of query parameter when provided, tagged with the port
+// version and answered with 304 when it's on If-None-Match
 func (h *PortHandlers) GetPortByUnloc(w http.ResponseWriter, r *http.Request) {
 	unloc := chi.URLParam(r, "unloc")
-	port, err := h.service.GetPort(r.Context(), unloc)
+	asOf, err := parseAsOf(r.URL.Query().Get("as_of"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	var port models.Port
+	if asOf.IsZero() {
+		port, err = h.service.GetPort(r.Context(), unloc)
+	} else {
+		port, err = h.service.GetPortAt(r.Context(), unloc, asOf)
+	}
 	if err != nil {
 		respondError(w, err)
 		return
 	}
 
+	w.Header().Set("ETag", etag(port.Version))
+	if noneMatch := r.Header.Get("If-None-Match"); noneMatch != "" && matchesETag(noneMatch, port.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 	b, err := json.Marshal(port)
 	if err != nil {
 		respondError(w, err)
@@ -55,19 +92,326 @@ func (h *PortHandlers) GetPortByUnloc(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func respondError(w http.ResponseWriter, err error) {
+// PutPort creates or replaces the port stored under the unloc provided
+// parameter. With If-Match the port is only replaced while it's still on the
+// tagged version, the version on the body being ignored.
+func (h *PortHandlers) PutPort(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	unloc := chi.URLParam(r, "unloc")
+	var port models.Port
+	err := json.NewDecoder(r.Body).Decode(&port)
+	if err != nil {
+		respondError(w, localErrs.New(localErrs.CodeBadRequest, "body must be a port JSON object"))
+		return
+	}
+
+	port.Version = 0
+	if match := r.Header.Get("If-Match"); match != "" {
+		port.Version, err = h.matchedVersion(r, unloc, match)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+	}
+
+	port, created, err := h.service.PutPort(r.Context(), unloc, port)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag(port.Version))
+	if created {
+		respondStatusJSON(w, http.StatusCreated, port)
+		return
+	}
+	respondJSON(w, port)
+}
+
+// PatchPort applies the RFC 7396 JSON merge patch on the body to the port
+// stored under the unloc provided parameter. With If-Match the port is only
+// patched while it's still on the tagged version.
+func (h *PortHandlers) PatchPort(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	unloc := chi.URLParam(r, "unloc")
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondError(w, localErrs.New(localErrs.CodeBadRequest, "failed to read the body"))
+		return
+	}
+
+	var version int64
+	if match := r.Header.Get("If-Match"); match != "" {
+		version, err = h.matchedVersion(r, unloc, match)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+	}
+
+	port, err := h.service.PatchPort(r.Context(), unloc, patch, version)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag(port.Version))
+	respondJSON(w, port)
+}
+
+// matchedVersion returns the version the If-Match header requires the port to
+// be on, * requiring the port to exist on whichever version it currently is
+func (h *PortHandlers) matchedVersion(r *http.Request, unloc, match string) (int64, error) {
+	match = strings.TrimSpace(match)
+	if match == "*" {
+		port, err := h.service.GetPort(r.Context(), unloc)
+		if errors.Is(err, localErrs.ErrNotFound) {
+			return 0, localErrs.New(localErrs.CodePreconditionFailed, fmt.Sprintf("port %s doesn't exist", unloc))
+		}
+		return port.Version, err
+	}
+	// weak tags never match on If-Match, as well as anything but a port tag
+	if len(match) < 2 || match[0] != '"' || match[len(match)-1] != '"' {
+		return 0, localErrs.New(localErrs.CodePreconditionFailed, "If-Match must be a single strong ETag of the port")
+	}
+	version, err := strconv.ParseInt(match[1:len(match)-1], 10, 64)
+	if err != nil || version <= 0 {
+		return 0, localErrs.New(localErrs.CodePreconditionFailed, "If-Match must be a single strong ETag of the port")
+	}
+	return version, nil
+}
+
+// DeletePort removes the port stored under the unloc provided parameter
+func (h *PortHandlers) DeletePort(w http.ResponseWriter, r *http.Request) {
+	unloc := chi.URLParam(r, "unloc")
+	err := h.service.DeletePort(r.Context(), unloc)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PortHistory retrieves the changes of the port stored under the unloc
+// provided parameter, oldest first
+func (h *PortHandlers) PortHistory(w http.ResponseWriter, r *http.Request) {
+	unloc := chi.URLParam(r, "unloc")
+	entries, err := h.service.PortHistory(r.Context(), unloc)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, entries)
+}
+
+// ExportPorts writes every port as they were at the as_of query parameter, or
+// the current ones, on the same JSON object format synced by SyncPorts
+func (h *PortHandlers) ExportPorts(w http.ResponseWriter, r *http.Request) {
+	asOf, err := parseAsOf(r.URL.Query().Get("as_of"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	ports, err := h.service.ExportPorts(r.Context(), asOf)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, port := range ports {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		unloc := port.Unloc
+		if unloc == "" && len(port.Unlocs) > 0 {
+			unloc = port.Unlocs[0]
+		}
+		key, err := json.Marshal(unloc)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		value, err := json.Marshal(port)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b.Bytes())
+}
+
+// ListPorts retrieves a page of ports filtered by the provided query parameters
+func (h *PortHandlers) ListPorts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.PortFilter{
+		Country:  query.Get("country"),
+		Region:   query.Get("region"),
+		Province: query.Get("province"),
+		Timezone: query.Get("timezone"),
+		Code:     query.Get("code"),
+		Cursor:   query.Get("cursor"),
+	}
+	var err error
+	filter.Limit, err = parseLimit(query.Get("limit"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	page, err := h.service.ListPorts(r.Context(), filter)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, page)
+}
+
+// NearbyPorts retrieves the ports within radius_km of the lat and lon query
+// parameters ordered by distance
+func (h *PortHandlers) NearbyPorts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var nearby models.NearbyQuery
+	var err error
+	for _, param := range []struct {
+		name  string
+		value *float64
+	}{
+		{"lat", &nearby.Latitude},
+		{"lon", &nearby.Longitude},
+		{"radius_km", &nearby.RadiusKm},
+	} {
+		*param.value, err = strconv.ParseFloat(query.Get(param.name), 64)
+		if err != nil {
+			respondError(w, localErrs.New(localErrs.CodeBadRequest, param.name+" must be a number"))
+			return
+		}
+	}
+	nearby.Limit, err = parseLimit(query.Get("limit"))
 	if err != nil {
-		var statusCode int
-		switch err {
-		case localErrs.ErrBadRequest:
-			statusCode = http.StatusBadRequest
-		case localErrs.ErrInternalServerError:
-			statusCode = http.StatusInternalServerError
-		case localErrs.ErrNotFound:
-			statusCode = http.StatusNotFound
-		default:
-			statusCode = http.StatusInternalServerError
+		respondError(w, err)
+		return
+	}
+
+	ports, err := h.service.NearbyPorts(r.Context(), nearby)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, ports)
+}
+
+// PortsWithin retrieves the ports inside the bbox query parameter, formatted
+// as min_lon,min_lat,max_lon,max_lat
+func (h *PortHandlers) PortsWithin(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	bounds := strings.Split(query.Get("bbox"), ",")
+	if len(bounds) != 4 {
+		respondError(w, localErrs.New(localErrs.CodeBadRequest, "bbox must be formatted as min_lon,min_lat,max_lon,max_lat"))
+		return
+	}
+	var box models.BoundingBox
+	var err error
+	for i, value := range []*float64{&box.MinLongitude, &box.MinLatitude, &box.MaxLongitude, &box.MaxLatitude} {
+		*value, err = strconv.ParseFloat(strings.TrimSpace(bounds[i]), 64)
+		if err != nil {
+			respondError(w, localErrs.New(localErrs.CodeBadRequest, "bbox bounds must be numbers"))
+			return
 		}
-		http.Error(w, err.Error(), statusCode)
+	}
+	limit, err := parseLimit(query.Get("limit"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	ports, err := h.service.PortsWithin(r.Context(), box, limit)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, ports)
+}
+
+// SearchPorts retrieves the ports matching the q query parameter, best matches first
+func (h *PortHandlers) SearchPorts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := parseLimit(query.Get("limit"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	ports, err := h.service.SearchPorts(r.Context(), query.Get("q"), limit)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, ports)
+}
+
+// etag returns the entity tag of a port version
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// matchesETag reports whether the If-None-Match header holds the tag of the
+// version, comparing weak tags as strong ones
+func matchesETag(header string, version int64) bool {
+	tag := etag(version)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAsOf parses the optional as_of query parameter, the zero time meaning now
+func parseAsOf(asOf string) (time.Time, error) {
+	if asOf == "" {
+		return time.Time{}, nil
+	}
+	at, err := time.Parse(time.RFC3339Nano, asOf)
+	if err != nil {
+		return time.Time{}, localErrs.New(localErrs.CodeBadRequest, "as_of must be an RFC 3339 timestamp")
+	}
+	return at, nil
+}
+
+// parseLimit parses the optional limit query parameter
+func parseLimit(limit string) (int, error) {
+	if limit == "" {
+		return 0, nil
+	}
+	value, err := strconv.Atoi(limit)
+	if err != nil {
+		return 0, localErrs.New(localErrs.CodeBadRequest, "limit must be an integer")
+	}
+	return value, nil
+}
+
+func respondJSON(w http.ResponseWriter, v interface{}) {
+	respondStatusJSON(w, http.StatusOK, v)
+}
+
+func respondStatusJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(b)
+	if err != nil {
+		respondError(w, err)
+		return
 	}
 }
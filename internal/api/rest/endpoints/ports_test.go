@@ -6,11 +6,14 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/WendelHime/ports/internal/logic"
 	localErrs "github.com/WendelHime/ports/internal/shared/errors"
 	"github.com/WendelHime/ports/internal/shared/models"
+	"github.com/WendelHime/ports/internal/storage"
 	"github.com/go-chi/chi/v5"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -26,6 +29,10 @@ func TestSyncPorts(t *testing.T) {
 			name: "Sync with success should return a ok response",
 			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
 				assert.Equal(t, http.StatusOK, w.Code)
+				report := models.SyncReport{}
+				err := json.Unmarshal(w.Body.Bytes(), &report)
+				assert.Nil(t, err)
+				assert.Equal(t, models.SyncReport{Created: 1}, report)
 			},
 			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
 				req := httptest.NewRequest(http.MethodPost, "/ports", nil)
@@ -33,7 +40,69 @@ func TestSyncPorts(t *testing.T) {
 
 				ctrl := gomock.NewController(t)
 				portService := logic.NewMockPortDomainService(ctrl)
-				portService.EXPECT().SyncPorts(req.Context(), gomock.Any()).Return(nil).Times(1)
+				portService.EXPECT().SyncPorts(req.Context(), gomock.Any(), logic.SyncOptions{}).Return(models.SyncReport{Created: 1}, nil).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+		{
+			name: "Sync with replace mode should delete the missing ports",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, w.Code)
+				report := models.SyncReport{}
+				err := json.Unmarshal(w.Body.Bytes(), &report)
+				assert.Nil(t, err)
+				assert.Equal(t, models.SyncReport{Updated: 1, Deleted: 2}, report)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodPost, "/ports?mode=replace", nil)
+				w := httptest.NewRecorder()
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().SyncPorts(req.Context(), gomock.Any(), logic.SyncOptions{Mode: logic.SyncModeReplace}).Return(models.SyncReport{Updated: 1, Deleted: 2}, nil).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+		{
+			name: "Sync with lenient mode should report the skipped records",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, w.Code)
+				report := models.SyncReport{}
+				err := json.Unmarshal(w.Body.Bytes(), &report)
+				assert.Nil(t, err)
+				assert.Equal(t, 1, report.Failed)
+				assert.Equal(t, []models.SyncError{{Unloc: "UNLOC", Offset: 10, Message: "failed to decode port"}}, report.Errors)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodPost, "/ports?lenient=true", nil)
+				w := httptest.NewRecorder()
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().SyncPorts(req.Context(), gomock.Any(), logic.SyncOptions{Lenient: true}).Return(models.SyncReport{
+					Failed: 1,
+					Errors: []models.SyncError{{Unloc: "UNLOC", Offset: 10, Message: "failed to decode port"}},
+				}, nil).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+		{
+			name: "Sync with invalid lenient parameter should return a bad request",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodPost, "/ports?lenient=maybe", nil)
+				w := httptest.NewRecorder()
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
 
 				portHTTP := NewPortHTTPHandlers(portService)
 				return portHTTP, req, w
@@ -50,7 +119,32 @@ func TestSyncPorts(t *testing.T) {
 
 				ctrl := gomock.NewController(t)
 				portService := logic.NewMockPortDomainService(ctrl)
-				portService.EXPECT().SyncPorts(req.Context(), gomock.Any()).Return(localErrs.ErrBadRequest).Times(1)
+				portService.EXPECT().SyncPorts(req.Context(), gomock.Any(), gomock.Any()).Return(models.SyncReport{}, localErrs.ErrBadRequest).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+		{
+			name: "Sync with invalid port should return an unprocessable entity with the invalid fields",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+				assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+				p := problem{}
+				err := json.Unmarshal(w.Body.Bytes(), &p)
+				assert.Nil(t, err)
+				assert.Equal(t, localErrs.CodeUnprocessableEntity, p.Code)
+				assert.Equal(t, http.StatusUnprocessableEntity, p.Status)
+				assert.Equal(t, []localErrs.FieldError{{Field: "country", Message: "must not be empty"}}, p.Errors)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodPost, "/ports", nil)
+				w := httptest.NewRecorder()
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				verr := localErrs.New(localErrs.CodeUnprocessableEntity, "invalid port", localErrs.FieldError{Field: "country", Message: "must not be empty"})
+				portService.EXPECT().SyncPorts(req.Context(), gomock.Any(), gomock.Any()).Return(models.SyncReport{}, verr).Times(1)
 
 				portHTTP := NewPortHTTPHandlers(portService)
 				return portHTTP, req, w
@@ -67,7 +161,7 @@ func TestSyncPorts(t *testing.T) {
 
 				ctrl := gomock.NewController(t)
 				portService := logic.NewMockPortDomainService(ctrl)
-				portService.EXPECT().SyncPorts(req.Context(), gomock.Any()).Return(localErrs.ErrInternalServerError).Times(1)
+				portService.EXPECT().SyncPorts(req.Context(), gomock.Any(), gomock.Any()).Return(models.SyncReport{}, localErrs.ErrInternalServerError).Times(1)
 
 				portHTTP := NewPortHTTPHandlers(portService)
 				return portHTTP, req, w
@@ -84,7 +178,7 @@ func TestSyncPorts(t *testing.T) {
 
 				ctrl := gomock.NewController(t)
 				portService := logic.NewMockPortDomainService(ctrl)
-				portService.EXPECT().SyncPorts(req.Context(), gomock.Any()).Return(errors.New("random error")).Times(1)
+				portService.EXPECT().SyncPorts(req.Context(), gomock.Any(), gomock.Any()).Return(models.SyncReport{}, errors.New("random error")).Times(1)
 
 				portHTTP := NewPortHTTPHandlers(portService)
 				return portHTTP, req, w
@@ -100,6 +194,67 @@ func TestSyncPorts(t *testing.T) {
 	}
 }
 
+func TestSyncPortsInput(t *testing.T) {
+	var tests = []struct {
+		name           string
+		body           string
+		chunked        bool
+		expectedStatus int
+		expectedCode   localErrs.Code
+	}{
+		{
+			name:           "Valid body should be synced",
+			body:           `{"AEAJM": {"name": "Ajman", "country": "AE", "unlocs": ["AEAJM"]}}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Malformed body should return a bad request",
+			body:           `{"AEAJM": {"name": }}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   localErrs.CodeBadRequest,
+		},
+		{
+			name:           "Body other than an object should return a bad request",
+			body:           `[1]`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   localErrs.CodeBadRequest,
+		},
+		{
+			name:           "Record with unexpected values should return an unprocessable entity",
+			body:           `{"AEAJM": {"name": 1}}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   localErrs.CodeUnprocessableEntity,
+		},
+		{
+			name:           "Streamed body larger than the limit should return a payload too large",
+			body:           `{"AEAJM": {"name": "Ajman", "country": "AE", "unlocs": ["AEAJM"]}, "AEAUH": {"name": "Abu Dhabi", "country": "AE", "unlocs": ["AEAUH"]}}`,
+			chunked:        true,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedCode:   localErrs.CodePayloadTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := logic.NewPortDomainService(storage.NewPortRepository(), nil)
+			handler := LimitBody(100)(http.HandlerFunc(NewPortHTTPHandlers(service).SyncPorts))
+			req := httptest.NewRequest(http.MethodPost, "/ports", strings.NewReader(tt.body))
+			if tt.chunked {
+				// the length isn't declared, so the body is only cut once read
+				req.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedCode != "" {
+				var details problem
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &details))
+				assert.Equal(t, tt.expectedCode, details.Code)
+			}
+		})
+	}
+}
+
 func TestGetPortByUnloc(t *testing.T) {
 	var tests = []struct {
 		name   string
@@ -133,6 +288,93 @@ func TestGetPortByUnloc(t *testing.T) {
 				return portHTTP, req, w
 			},
 		},
+		{
+			name: "Get port should be tagged with its version",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, w.Code)
+				assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodGet, "/ports/{unloc}", nil)
+				req.Header.Set("If-None-Match", `"2"`)
+				w := httptest.NewRecorder()
+
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("unloc", "aaaa")
+				req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().GetPort(req.Context(), "aaaa").Return(models.Port{Unlocs: []string{"aaaa"}, Version: 3}, nil).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+		{
+			name: "Get port matching If-None-Match should return a not modified response",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotModified, w.Code)
+				assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+				assert.Empty(t, w.Body.Bytes())
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodGet, "/ports/{unloc}", nil)
+				req.Header.Set("If-None-Match", `"2", W/"3"`)
+				w := httptest.NewRecorder()
+
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("unloc", "aaaa")
+				req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().GetPort(req.Context(), "aaaa").Return(models.Port{Unlocs: []string{"aaaa"}, Version: 3}, nil).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+		{
+			name: "Get port as of an instant should return it as it was",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, w.Code)
+				returnedPort := models.Port{}
+				err := json.Unmarshal(w.Body.Bytes(), &returnedPort)
+				assert.Nil(t, err)
+				assert.Equal(t, models.Port{Name: "Ajman", Version: 1}, returnedPort)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodGet, "/ports/{unloc}?as_of=2026-01-01T00:00:00Z", nil)
+				w := httptest.NewRecorder()
+
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("unloc", "aaaa")
+				req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().GetPortAt(req.Context(), "aaaa", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)).
+					Return(models.Port{Name: "Ajman", Version: 1}, nil).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+		{
+			name: "Get port with invalid as_of should return a bad request error",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodGet, "/ports/{unloc}?as_of=yesterday", nil)
+				w := httptest.NewRecorder()
+
+				ctrl := gomock.NewController(t)
+				portHTTP := NewPortHTTPHandlers(logic.NewMockPortDomainService(ctrl))
+				return portHTTP, req, w
+			},
+		},
 		{
 			name: "Port not found should return a not found error",
 			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
@@ -163,3 +405,616 @@ func TestGetPortByUnloc(t *testing.T) {
 		})
 	}
 }
+
+func TestPutPort(t *testing.T) {
+	var tests = []struct {
+		name   string
+		assert func(t *testing.T, w *httptest.ResponseRecorder)
+		setup  func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Put unknown port with success should return the created port",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusCreated, w.Code)
+				assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+				assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+				returnedPort := models.Port{}
+				err := json.Unmarshal(w.Body.Bytes(), &returnedPort)
+				assert.Nil(t, err)
+				assert.Equal(t, models.Port{Unloc: "BRSSZ", Unlocs: []string{"BRSSZ"}, Version: 1}, returnedPort)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodPut, "/ports/{unloc}", strings.NewReader(`{"name": "Santos", "version": 9}`))
+				w := httptest.NewRecorder()
+
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("unloc", "BRSSZ")
+				req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().PutPort(req.Context(), "BRSSZ", models.Port{Name: "Santos"}).
+					Return(models.Port{Unloc: "BRSSZ", Unlocs: []string{"BRSSZ"}, Version: 1}, true, nil).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+		{
+			name: "Put port with If-Match should write on the tagged version",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, w.Code)
+				assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+				assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodPut, "/ports/{unloc}", strings.NewReader(`{"name": "Santos"}`))
+				req.Header.Set("If-Match", `"3"`)
+				w := httptest.NewRecorder()
+
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("unloc", "BRSSZ")
+				req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().PutPort(req.Context(), "BRSSZ", models.Port{Name: "Santos", Version: 3}).
+					Return(models.Port{Unloc: "BRSSZ", Version: 4}, false, nil).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+		{
+			name: "Put port on a stale version should return a precondition failed error",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+				assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodPut, "/ports/{unloc}", strings.NewReader(`{"name": "Santos"}`))
+				req.Header.Set("If-Match", `"2"`)
+				w := httptest.NewRecorder()
+
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("unloc", "BRSSZ")
+				req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().PutPort(req.Context(), "BRSSZ", gomock.Any()).Return(models.Port{}, false, localErrs.ErrPreconditionFailed).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+		{
+			name: "Put port with a weak If-Match should return a precondition failed error",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodPut, "/ports/{unloc}", strings.NewReader(`{"name": "Santos"}`))
+				req.Header.Set("If-Match", `W/"2"`)
+				w := httptest.NewRecorder()
+
+				ctrl := gomock.NewController(t)
+				portHTTP := NewPortHTTPHandlers(logic.NewMockPortDomainService(ctrl))
+				return portHTTP, req, w
+			},
+		},
+		{
+			name: "Put unknown port with If-Match * should return a precondition failed error",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodPut, "/ports/{unloc}", strings.NewReader(`{"name": "Santos"}`))
+				req.Header.Set("If-Match", "*")
+				w := httptest.NewRecorder()
+
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("unloc", "BRSSZ")
+				req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().GetPort(req.Context(), "BRSSZ").Return(models.Port{}, localErrs.ErrNotFound).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+		{
+			name: "Put port with malformed body should return a bad request error",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodPut, "/ports/{unloc}", strings.NewReader(`{"name": `))
+				w := httptest.NewRecorder()
+
+				ctrl := gomock.NewController(t)
+				portHTTP := NewPortHTTPHandlers(logic.NewMockPortDomainService(ctrl))
+				return portHTTP, req, w
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portHTTP, req, w := tt.setup(t)
+			portHTTP.PutPort(w, req)
+			tt.assert(t, w)
+		})
+	}
+}
+
+func TestPatchPort(t *testing.T) {
+	var tests = []struct {
+		name   string
+		assert func(t *testing.T, w *httptest.ResponseRecorder)
+		setup  func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Patch port with success should return the updated port",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, w.Code)
+				assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+				returnedPort := models.Port{}
+				err := json.Unmarshal(w.Body.Bytes(), &returnedPort)
+				assert.Nil(t, err)
+				assert.Equal(t, models.Port{Unloc: "BRSSZ", Timezone: "America/Sao_Paulo", Version: 3}, returnedPort)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				patch := `{"timezone": "America/Sao_Paulo"}`
+				req := httptest.NewRequest(http.MethodPatch, "/ports/{unloc}", strings.NewReader(patch))
+				req.Header.Set("Content-Type", "application/merge-patch+json")
+				req.Header.Set("If-Match", `"2"`)
+				w := httptest.NewRecorder()
+
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("unloc", "BRSSZ")
+				req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().PatchPort(req.Context(), "BRSSZ", []byte(patch), int64(2)).
+					Return(models.Port{Unloc: "BRSSZ", Timezone: "America/Sao_Paulo", Version: 3}, nil).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+		{
+			name: "Patch port making it invalid should return an unprocessable entity error",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodPatch, "/ports/{unloc}", strings.NewReader(`{"timezone": "Mars/Olympus_Mons"}`))
+				w := httptest.NewRecorder()
+
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("unloc", "BRSSZ")
+				req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().PatchPort(req.Context(), "BRSSZ", gomock.Any(), int64(0)).
+					Return(models.Port{}, localErrs.New(localErrs.CodeUnprocessableEntity, "invalid port")).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portHTTP, req, w := tt.setup(t)
+			portHTTP.PatchPort(w, req)
+			tt.assert(t, w)
+		})
+	}
+}
+
+func TestDeletePort(t *testing.T) {
+	var tests = []struct {
+		name   string
+		assert func(t *testing.T, w *httptest.ResponseRecorder)
+		setup  func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Delete port with success should return a no content response",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNoContent, w.Code)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodDelete, "/ports/{unloc}", nil)
+				w := httptest.NewRecorder()
+
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("unloc", "aaaa")
+				req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().DeletePort(req.Context(), "aaaa").Return(nil).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+		{
+			name: "Port not found should return a not found error",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotFound, w.Code)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodDelete, "/ports/{unloc}", nil)
+				w := httptest.NewRecorder()
+
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("unloc", "aaaa")
+				req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().DeletePort(req.Context(), "aaaa").Return(localErrs.ErrNotFound).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portHTTP, req, w := tt.setup(t)
+			portHTTP.DeletePort(w, req)
+			tt.assert(t, w)
+		})
+	}
+}
+
+func TestPortHistory(t *testing.T) {
+	var tests = []struct {
+		name   string
+		assert func(t *testing.T, w *httptest.ResponseRecorder)
+		setup  func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder)
+	}{
+		{
+			name: "History with success should return the port entries",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, w.Code)
+				var entries []models.AuditEntry
+				err := json.Unmarshal(w.Body.Bytes(), &entries)
+				assert.Nil(t, err)
+				assert.Equal(t, []models.AuditEntry{{Unloc: "AEAJM", Action: models.AuditCreated, RequestID: "request-id"}}, entries)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodGet, "/ports/{unloc}/history", nil)
+				w := httptest.NewRecorder()
+
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("unloc", "AEAJM")
+				req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().PortHistory(req.Context(), "AEAJM").
+					Return([]models.AuditEntry{{Unloc: "AEAJM", Action: models.AuditCreated, RequestID: "request-id"}}, nil).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+		{
+			name: "History of unknown port should return a not found error",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotFound, w.Code)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodGet, "/ports/{unloc}/history", nil)
+				w := httptest.NewRecorder()
+
+				rctx := chi.NewRouteContext()
+				rctx.URLParams.Add("unloc", "AEAJM")
+				req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().PortHistory(req.Context(), "AEAJM").Return(nil, localErrs.ErrNotFound).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portHTTP, req, w := tt.setup(t)
+			portHTTP.PortHistory(w, req)
+			tt.assert(t, w)
+		})
+	}
+}
+
+func TestExportPorts(t *testing.T) {
+	var tests = []struct {
+		name   string
+		assert func(t *testing.T, w *httptest.ResponseRecorder)
+		setup  func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Export with success should return the ports keyed by unloc",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, w.Code)
+				assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+				var ports map[string]models.Port
+				err := json.Unmarshal(w.Body.Bytes(), &ports)
+				assert.Nil(t, err)
+				assert.Equal(t, map[string]models.Port{
+					"AEAJM": {Unloc: "AEAJM", Name: "Ajman"},
+					"AEAUH": {Unlocs: []string{"AEAUH"}},
+				}, ports)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodGet, "/ports/export?as_of=2026-01-01T00:00:00Z", nil)
+				w := httptest.NewRecorder()
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().ExportPorts(req.Context(), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)).
+					Return([]models.Port{{Unloc: "AEAJM", Name: "Ajman"}, {Unlocs: []string{"AEAUH"}}}, nil).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+		{
+			name: "Export before the retained history should return an unprocessable entity error",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodGet, "/ports/export?as_of=2026-01-01T00:00:00Z", nil)
+				w := httptest.NewRecorder()
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().ExportPorts(req.Context(), gomock.Any()).
+					Return(nil, localErrs.New(localErrs.CodeUnprocessableEntity, "ports history is only retained since 2026-02-01T00:00:00Z")).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portHTTP, req, w := tt.setup(t)
+			portHTTP.ExportPorts(w, req)
+			tt.assert(t, w)
+		})
+	}
+}
+
+func TestListPorts(t *testing.T) {
+	var tests = []struct {
+		name   string
+		assert func(t *testing.T, w *httptest.ResponseRecorder)
+		setup  func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder)
+	}{
+		{
+			name: "List ports with success should return a ok response",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, w.Code)
+				returnedPage := models.PortPage{}
+				err := json.Unmarshal(w.Body.Bytes(), &returnedPage)
+				assert.Nil(t, err)
+				assert.Equal(t, models.PortPage{Ports: []models.Port{{Unlocs: []string{"aaaa"}}}, NextCursor: "next"}, returnedPage)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodGet, "/ports?country=Brazil&region=South+America&cursor=abc&limit=10", nil)
+				w := httptest.NewRecorder()
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().ListPorts(req.Context(), models.PortFilter{
+					Country: "Brazil",
+					Region:  "South America",
+					Cursor:  "abc",
+					Limit:   10,
+				}).Return(models.PortPage{Ports: []models.Port{{Unlocs: []string{"aaaa"}}}, NextCursor: "next"}, nil).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+		{
+			name: "List ports with invalid limit should return a bad request",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodGet, "/ports?limit=ten", nil)
+				w := httptest.NewRecorder()
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portHTTP, req, w := tt.setup(t)
+			portHTTP.ListPorts(w, req)
+			tt.assert(t, w)
+		})
+	}
+}
+
+func TestNearbyPorts(t *testing.T) {
+	var tests = []struct {
+		name   string
+		assert func(t *testing.T, w *httptest.ResponseRecorder)
+		setup  func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Nearby ports with success should return a ok response",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, w.Code)
+				returnedPorts := []models.PortDistance{}
+				err := json.Unmarshal(w.Body.Bytes(), &returnedPorts)
+				assert.Nil(t, err)
+				assert.Equal(t, []models.PortDistance{{Port: models.Port{Unlocs: []string{"aaaa"}}, DistanceKm: 1.5}}, returnedPorts)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodGet, "/ports/nearby?lat=25.2&lon=55.3&radius_km=10&limit=5", nil)
+				w := httptest.NewRecorder()
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().NearbyPorts(req.Context(), models.NearbyQuery{Latitude: 25.2, Longitude: 55.3, RadiusKm: 10, Limit: 5}).
+					Return([]models.PortDistance{{Port: models.Port{Unlocs: []string{"aaaa"}}, DistanceKm: 1.5}}, nil).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+		{
+			name: "Nearby ports without latitude should return a bad request",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodGet, "/ports/nearby?lon=55.3&radius_km=10", nil)
+				w := httptest.NewRecorder()
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portHTTP, req, w := tt.setup(t)
+			portHTTP.NearbyPorts(w, req)
+			tt.assert(t, w)
+		})
+	}
+}
+
+func TestPortsWithin(t *testing.T) {
+	var tests = []struct {
+		name   string
+		assert func(t *testing.T, w *httptest.ResponseRecorder)
+		setup  func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Ports within a bounding box should return a ok response",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, w.Code)
+				returnedPorts := []models.Port{}
+				err := json.Unmarshal(w.Body.Bytes(), &returnedPorts)
+				assert.Nil(t, err)
+				assert.Equal(t, []models.Port{{Unlocs: []string{"aaaa"}}}, returnedPorts)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodGet, "/ports/within?bbox=54,24,56,26", nil)
+				w := httptest.NewRecorder()
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().PortsWithin(req.Context(), models.BoundingBox{MinLongitude: 54, MinLatitude: 24, MaxLongitude: 56, MaxLatitude: 26}, 0).
+					Return([]models.Port{{Unlocs: []string{"aaaa"}}}, nil).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+		{
+			name: "Ports within an incomplete bounding box should return a bad request",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodGet, "/ports/within?bbox=54,24,56", nil)
+				w := httptest.NewRecorder()
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portHTTP, req, w := tt.setup(t)
+			portHTTP.PortsWithin(w, req)
+			tt.assert(t, w)
+		})
+	}
+}
+
+func TestSearchPorts(t *testing.T) {
+	var tests = []struct {
+		name   string
+		assert func(t *testing.T, w *httptest.ResponseRecorder)
+		setup  func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Search ports with success should return a ok response",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, w.Code)
+				returnedPorts := []models.PortMatch{}
+				err := json.Unmarshal(w.Body.Bytes(), &returnedPorts)
+				assert.Nil(t, err)
+				assert.Equal(t, []models.PortMatch{{Port: models.Port{Name: "Santos"}, Score: 3}}, returnedPorts)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodGet, "/ports/search?q=santos&limit=5", nil)
+				w := httptest.NewRecorder()
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().SearchPorts(req.Context(), "santos", 5).
+					Return([]models.PortMatch{{Port: models.Port{Name: "Santos"}, Score: 3}}, nil).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+		{
+			name: "Search ports with invalid query should return a bad request",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+			},
+			setup: func(t *testing.T) (*PortHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodGet, "/ports/search", nil)
+				w := httptest.NewRecorder()
+
+				ctrl := gomock.NewController(t)
+				portService := logic.NewMockPortDomainService(ctrl)
+				portService.EXPECT().SearchPorts(req.Context(), "", 0).Return(nil, localErrs.ErrBadRequest).Times(1)
+
+				portHTTP := NewPortHTTPHandlers(portService)
+				return portHTTP, req, w
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portHTTP, req, w := tt.setup(t)
+			portHTTP.SearchPorts(w, req)
+			tt.assert(t, w)
+		})
+	}
+}
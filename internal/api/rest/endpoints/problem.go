@@ -0,0 +1,67 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+)
+
+// problem is an RFC 7807 problem details response
+type problem struct {
+	Type   string                 `json:"type"`
+	Title  string                 `json:"title"`
+	Status int                    `json:"status"`
+	Detail string                 `json:"detail,omitempty"`
+	Code   localErrs.Code         `json:"code"`
+	Errors []localErrs.FieldError `json:"errors,omitempty"`
+}
+
+// statusCodes maps the application error codes to their HTTP status
+var statusCodes = map[localErrs.Code]int{
+	localErrs.CodeBadRequest:          http.StatusBadRequest,
+	localErrs.CodeNotFound:            http.StatusNotFound,
+	localErrs.CodeConflict:            http.StatusConflict,
+	localErrs.CodePreconditionFailed:  http.StatusPreconditionFailed,
+	localErrs.CodePayloadTooLarge:     http.StatusRequestEntityTooLarge,
+	localErrs.CodeUnprocessableEntity: http.StatusUnprocessableEntity,
+	localErrs.CodeInternal:            http.StatusInternalServerError,
+	localErrs.CodeUnavailable:         http.StatusServiceUnavailable,
+}
+
+// respondError answers the error as application/problem+json. Errors that
+// aren't application errors are answered as internal errors, and the detail
+// of internal errors is never exposed.
+func respondError(w http.ResponseWriter, err error) {
+	if err == nil {
+		return
+	}
+	var appErr *localErrs.Error
+	if !errors.As(err, &appErr) {
+		appErr = localErrs.ErrInternalServerError
+	}
+	status, exists := statusCodes[appErr.Code]
+	if !exists {
+		status = http.StatusInternalServerError
+	}
+
+	p := problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: err.Error(),
+		Code:   appErr.Code,
+		Errors: appErr.Details,
+	}
+	if status == http.StatusInternalServerError {
+		p.Code = localErrs.CodeInternal
+		p.Detail = localErrs.ErrInternalServerError.Message
+	}
+
+	b, _ := json.Marshal(p)
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,89 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRespondError(t *testing.T) {
+	var tests = []struct {
+		name    string
+		err     error
+		problem problem
+	}{
+		{
+			name: "Wrapped bad request should return a bad request",
+			err:  errors.Wrap(localErrs.ErrBadRequest, "limit must be between 1 and 500"),
+			problem: problem{
+				Type:   "about:blank",
+				Title:  "Bad Request",
+				Status: http.StatusBadRequest,
+				Detail: "limit must be between 1 and 500: the provided input is invalid",
+				Code:   localErrs.CodeBadRequest,
+			},
+		},
+		{
+			name: "Not found should return a not found",
+			err:  localErrs.ErrNotFound,
+			problem: problem{
+				Type:   "about:blank",
+				Title:  "Not Found",
+				Status: http.StatusNotFound,
+				Detail: "not found",
+				Code:   localErrs.CodeNotFound,
+			},
+		},
+		{
+			name: "Invalid fields should be detailed",
+			err:  localErrs.New(localErrs.CodeUnprocessableEntity, "invalid port", localErrs.FieldError{Field: "timezone", Message: "unknown"}),
+			problem: problem{
+				Type:   "about:blank",
+				Title:  "Unprocessable Entity",
+				Status: http.StatusUnprocessableEntity,
+				Detail: "invalid port: timezone: unknown",
+				Code:   localErrs.CodeUnprocessableEntity,
+				Errors: []localErrs.FieldError{{Field: "timezone", Message: "unknown"}},
+			},
+		},
+		{
+			name: "Internal error should not expose its cause",
+			err:  localErrs.Wrap(errors.New("disk I/O error"), localErrs.CodeInternal, "failed to load port"),
+			problem: problem{
+				Type:   "about:blank",
+				Title:  "Internal Server Error",
+				Status: http.StatusInternalServerError,
+				Detail: "internal server error",
+				Code:   localErrs.CodeInternal,
+			},
+		},
+		{
+			name: "Unexpected error should return an internal server error",
+			err:  errors.New("random error"),
+			problem: problem{
+				Type:   "about:blank",
+				Title:  "Internal Server Error",
+				Status: http.StatusInternalServerError,
+				Detail: "internal server error",
+				Code:   localErrs.CodeInternal,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			respondError(w, tt.err)
+
+			assert.Equal(t, tt.problem.Status, w.Code)
+			assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+			p := problem{}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+			assert.Equal(t, tt.problem, p)
+		})
+	}
+}
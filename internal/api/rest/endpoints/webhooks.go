@@ -0,0 +1,81 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/WendelHime/ports/internal/shared/models"
+	"github.com/WendelHime/ports/internal/webhooks"
+	"github.com/go-chi/chi/v5"
+)
+
+// WebhookHandlers holds the service being used by the webhook endpoints
+type WebhookHandlers struct {
+	service webhooks.Service
+}
+
+func NewWebhookHTTPHandlers(service webhooks.Service) *WebhookHandlers {
+	return &WebhookHandlers{
+		service: service,
+	}
+}
+
+// RegisterWebhook registers the webhook, answering with its secret which
+// isn't returned anymore afterwards
+func (h *WebhookHandlers) RegisterWebhook(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var webhook models.Webhook
+	err := json.NewDecoder(r.Body).Decode(&webhook)
+	if err != nil {
+		respondError(w, localErrs.New(localErrs.CodeBadRequest, "body must be a webhook JSON object"))
+		return
+	}
+
+	webhook, err = h.service.Register(r.Context(), webhook)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondStatusJSON(w, http.StatusCreated, webhook)
+}
+
+// ListWebhooks returns the registered webhooks
+func (h *WebhookHandlers) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.service.List(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, webhooks)
+}
+
+// GetWebhook returns the webhook identified by the id parameter
+func (h *WebhookHandlers) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, err := h.service.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, webhook)
+}
+
+// DeleteWebhook stops delivering the port changes to the webhook
+func (h *WebhookHandlers) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	err := h.service.Delete(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// WebhookDeliveries returns the latest deliveries of the webhook, newest first
+func (h *WebhookHandlers) WebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := h.service.Deliveries(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+	respondJSON(w, deliveries)
+}
@@ -0,0 +1,186 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/WendelHime/ports/internal/shared/models"
+	"github.com/WendelHime/ports/internal/webhooks"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func withWebhookID(req *http.Request, id string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestRegisterWebhook(t *testing.T) {
+	var tests = []struct {
+		name   string
+		assert func(t *testing.T, w *httptest.ResponseRecorder)
+		setup  func(t *testing.T) (*WebhookHandlers, *http.Request, *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Register with success should return a created response with the secret",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusCreated, w.Code)
+				webhook := models.Webhook{}
+				err := json.Unmarshal(w.Body.Bytes(), &webhook)
+				assert.Nil(t, err)
+				assert.Equal(t, models.Webhook{ID: "id", URL: "http://example.com", Secret: "secret", Countries: []string{"AE"}}, webhook)
+			},
+			setup: func(t *testing.T) (*WebhookHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(`{"url":"http://example.com","countries":["AE"]}`))
+				w := httptest.NewRecorder()
+
+				ctrl := gomock.NewController(t)
+				service := webhooks.NewMockService(ctrl)
+				service.EXPECT().Register(req.Context(), models.Webhook{URL: "http://example.com", Countries: []string{"AE"}}).
+					Return(models.Webhook{ID: "id", URL: "http://example.com", Secret: "secret", Countries: []string{"AE"}}, nil).Times(1)
+
+				return NewWebhookHTTPHandlers(service), req, w
+			},
+		},
+		{
+			name: "Invalid body should return a bad request error",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+			},
+			setup: func(t *testing.T) (*WebhookHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(`[]`))
+				w := httptest.NewRecorder()
+
+				ctrl := gomock.NewController(t)
+				service := webhooks.NewMockService(ctrl)
+
+				return NewWebhookHTTPHandlers(service), req, w
+			},
+		},
+		{
+			name: "Invalid webhook should return an unprocessable entity error",
+			assert: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+			},
+			setup: func(t *testing.T) (*WebhookHandlers, *http.Request, *httptest.ResponseRecorder) {
+				req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(`{"url":"example.com"}`))
+				w := httptest.NewRecorder()
+
+				ctrl := gomock.NewController(t)
+				service := webhooks.NewMockService(ctrl)
+				service.EXPECT().Register(req.Context(), models.Webhook{URL: "example.com"}).
+					Return(models.Webhook{}, localErrs.New(localErrs.CodeUnprocessableEntity, "invalid webhook")).Times(1)
+
+				return NewWebhookHTTPHandlers(service), req, w
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webhookHTTP, req, w := tt.setup(t)
+			webhookHTTP.RegisterWebhook(w, req)
+			tt.assert(t, w)
+		})
+	}
+}
+
+func TestListWebhooks(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/webhooks", nil)
+	w := httptest.NewRecorder()
+
+	ctrl := gomock.NewController(t)
+	service := webhooks.NewMockService(ctrl)
+	service.EXPECT().List(req.Context()).Return([]models.Webhook{{ID: "id", URL: "http://example.com"}}, nil).Times(1)
+
+	NewWebhookHTTPHandlers(service).ListWebhooks(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"id":"id","url":"http://example.com","created_at":"0001-01-01T00:00:00Z"}]`, w.Body.String())
+}
+
+func TestGetWebhook(t *testing.T) {
+	var tests = []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{
+			name:   "Existing webhook should return a ok response",
+			status: http.StatusOK,
+		},
+		{
+			name:   "Webhook not found should return a not found error",
+			err:    localErrs.ErrNotFound,
+			status: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := withWebhookID(httptest.NewRequest(http.MethodGet, "/webhooks/{id}", nil), "id")
+			w := httptest.NewRecorder()
+
+			ctrl := gomock.NewController(t)
+			service := webhooks.NewMockService(ctrl)
+			service.EXPECT().Get(req.Context(), "id").Return(models.Webhook{ID: "id"}, tt.err).Times(1)
+
+			NewWebhookHTTPHandlers(service).GetWebhook(w, req)
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestDeleteWebhook(t *testing.T) {
+	var tests = []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{
+			name:   "Delete webhook with success should return a no content response",
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "Webhook not found should return a not found error",
+			err:    localErrs.ErrNotFound,
+			status: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := withWebhookID(httptest.NewRequest(http.MethodDelete, "/webhooks/{id}", nil), "id")
+			w := httptest.NewRecorder()
+
+			ctrl := gomock.NewController(t)
+			service := webhooks.NewMockService(ctrl)
+			service.EXPECT().Delete(req.Context(), "id").Return(tt.err).Times(1)
+
+			NewWebhookHTTPHandlers(service).DeleteWebhook(w, req)
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	req := withWebhookID(httptest.NewRequest(http.MethodGet, "/webhooks/{id}/deliveries", nil), "id")
+	w := httptest.NewRecorder()
+
+	ctrl := gomock.NewController(t)
+	service := webhooks.NewMockService(ctrl)
+	service.EXPECT().Deliveries(req.Context(), "id").Return([]models.Delivery{
+		{ID: "delivery", WebhookID: "id", Sequence: 2, Event: models.AuditUpdated, Unloc: "AEAJM", Status: models.DeliverySucceeded, Attempts: 1, StatusCode: 200},
+	}, nil).Times(1)
+
+	NewWebhookHTTPHandlers(service).WebhookDeliveries(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	deliveries := []models.Delivery{}
+	err := json.Unmarshal(w.Body.Bytes(), &deliveries)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, models.DeliverySucceeded, deliveries[0].Status)
+}
@@ -0,0 +1,373 @@
+// Package config loads the ports-api settings from its defaults, an optional
+// YAML file, the environment and the command line flags, each overriding the
+// previous ones
+package config
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes the environment variable of each flag, named after the
+// flag in upper case with dashes replaced by underscores, e.g. PORTS_ADDR
+const EnvPrefix = "PORTS_"
+
+// Config holds every ports-api setting
+type Config struct {
+	Server   ServerConfig   `yaml:"server"`
+	Limits   LimitsConfig   `yaml:"limits"`
+	Storage  StorageConfig  `yaml:"storage"`
+	History  HistoryConfig  `yaml:"history"`
+	Changes  ChangesConfig  `yaml:"changes"`
+	Webhooks WebhooksConfig `yaml:"webhooks"`
+	Seed     SeedConfig     `yaml:"seed"`
+	Watch    WatchConfig    `yaml:"watch"`
+	Log      LogConfig      `yaml:"log"`
+}
+
+// ServerConfig holds the HTTP server settings, a zero timeout meaning none
+type ServerConfig struct {
+	Addr              string        `yaml:"addr"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	// WriteTimeout also bounds the change streams, so it's disabled by default
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	// ShutdownTimeout is the grace period of the requests being served on
+	// shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// LimitsConfig holds the request body size limits in bytes, zero meaning no
+// limit
+type LimitsConfig struct {
+	BodyBytes int64 `yaml:"body_bytes"`
+	// SyncBodyBytes applies to POST /ports instead of BodyBytes
+	SyncBodyBytes int64 `yaml:"sync_body_bytes"`
+}
+
+// StorageConfig selects the storage backend and holds its options
+type StorageConfig struct {
+	Backend      string `yaml:"backend"`
+	DataDir      string `yaml:"data_dir"`
+	CompactEvery int    `yaml:"compact_every"`
+	SQLitePath   string `yaml:"sqlite_path"`
+}
+
+// HistoryConfig holds the amount of changes kept on the history of each port,
+// zero keeping every change
+type HistoryConfig struct {
+	Retention int `yaml:"retention"`
+}
+
+// ChangesConfig holds the amount of latest port changes kept for resuming the
+// change streams
+type ChangesConfig struct {
+	Buffer int `yaml:"buffer"`
+}
+
+// WebhooksConfig holds the webhook delivery settings
+type WebhooksConfig struct {
+	Attempts int           `yaml:"attempts"`
+	Backoff  time.Duration `yaml:"backoff"`
+	Timeout  time.Duration `yaml:"timeout"`
+	// AllowPrivateTargets accepts webhooks on loopback, link-local and
+	// private addresses
+	AllowPrivateTargets bool `yaml:"allow_private_targets"`
+}
+
+// SeedConfig holds the port files, or directories of them, synced at startup
+type SeedConfig struct {
+	Paths []string `yaml:"paths"`
+	// Lenient skips the records that can't be decoded or are invalid
+	Lenient bool `yaml:"lenient"`
+}
+
+// WatchConfig holds the ports file the catalogue is replaced with at startup
+// and whenever it changes, checked every Interval. The ports missing from the
+// file are deleted, the ones written through the API included.
+type WatchConfig struct {
+	Path     string        `yaml:"path"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// LogConfig holds the logging settings
+type LogConfig struct {
+	// Level is the lowest level logged: debug, info, warn or error
+	Level string `yaml:"level"`
+	// Format is the format of the log records: json or text
+	Format string `yaml:"format"`
+	// Requests enables logging every request served
+	Requests bool `yaml:"requests"`
+}
+
+// Default returns the settings used when nothing else is provided
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:              "0.0.0.0:8080",
+			ReadHeaderTimeout: 10 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Limits: LimitsConfig{
+			BodyBytes:     1 << 20,
+			SyncBodyBytes: 256 << 20,
+		},
+		Storage: StorageConfig{
+			Backend:      "memory",
+			DataDir:      "data",
+			CompactEvery: 1000,
+			SQLitePath:   "ports.db",
+		},
+		History: HistoryConfig{Retention: 100},
+		Changes: ChangesConfig{Buffer: 1000},
+		Webhooks: WebhooksConfig{
+			Attempts: 5,
+			Backoff:  time.Second,
+			Timeout:  10 * time.Second,
+		},
+		Watch: WatchConfig{Interval: 10 * time.Second},
+		Log:   LogConfig{Level: "info", Format: "json", Requests: true},
+	}
+}
+
+// Load returns the validated settings, starting from the defaults and
+// overridden by the YAML file given by the -config flag or PORTS_CONFIG, then
+// by the environment variables and at last by the args flags. It returns
+// flag.ErrHelp when the usage is requested.
+func Load(name string, args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	cfg := Default()
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configPath := fs.String("config", "", "path of the optional YAML configuration file, also read from "+EnvPrefix+"CONFIG")
+	bind(fs, &cfg)
+	err := fs.Parse(args)
+	if err != nil {
+		return Config{}, err
+	}
+	if fs.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	// the flags are set again after the file and the environment, so the
+	// values parsed so far are only kept to be reapplied
+	flags := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+	cfg = Default()
+
+	if *configPath == "" {
+		*configPath, _ = lookupEnv(EnvPrefix + "CONFIG")
+	}
+	if *configPath != "" {
+		err = loadFile(*configPath, &cfg)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	var errs []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		env := EnvPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		value, exists := lookupEnv(env)
+		if !exists {
+			return
+		}
+		err := f.Value.Set(value)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: invalid value %q", env, value))
+		}
+	})
+	if len(errs) > 0 {
+		return Config{}, fmt.Errorf("invalid environment: %s", strings.Join(errs, "; "))
+	}
+	for name, value := range flags {
+		// the values were already parsed once, so they're valid
+		_ = fs.Set(name, value)
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// bind defines a flag setting each of the cfg fields
+func bind(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.Server.Addr, "addr", cfg.Server.Addr, "address the HTTP server listens on")
+	fs.DurationVar(&cfg.Server.ReadTimeout, "read-timeout", cfg.Server.ReadTimeout, "how long reading a request, body included, may take, 0 meaning no timeout")
+	fs.DurationVar(&cfg.Server.ReadHeaderTimeout, "read-header-timeout", cfg.Server.ReadHeaderTimeout, "how long reading the request headers may take, 0 meaning no timeout")
+	fs.DurationVar(&cfg.Server.WriteTimeout, "write-timeout", cfg.Server.WriteTimeout, "how long writing a response may take, change streams included, 0 meaning no timeout")
+	fs.DurationVar(&cfg.Server.IdleTimeout, "idle-timeout", cfg.Server.IdleTimeout, "how long an idle keep-alive connection is kept open, 0 meaning no timeout")
+	fs.DurationVar(&cfg.Server.ShutdownTimeout, "shutdown-timeout", cfg.Server.ShutdownTimeout, "grace period of the requests being served on shutdown")
+	fs.Int64Var(&cfg.Limits.BodyBytes, "max-body-bytes", cfg.Limits.BodyBytes, "maximum size of the request bodies, 0 meaning no limit")
+	fs.Int64Var(&cfg.Limits.SyncBodyBytes, "max-sync-body-bytes", cfg.Limits.SyncBodyBytes, "maximum size of the POST /ports bodies, 0 meaning no limit")
+	fs.StringVar(&cfg.Storage.Backend, "storage", cfg.Storage.Backend, "storage backend to be used: memory, file or sqlite")
+	fs.StringVar(&cfg.Storage.DataDir, "data-dir", cfg.Storage.DataDir, "directory where the file storage keeps its log and snapshots")
+	fs.IntVar(&cfg.Storage.CompactEvery, "compact-every", cfg.Storage.CompactEvery, "amount of log records written before the file storage takes a snapshot")
+	fs.StringVar(&cfg.Storage.SQLitePath, "sqlite-path", cfg.Storage.SQLitePath, "path of the database file used by the sqlite storage")
+	fs.IntVar(&cfg.History.Retention, "history-retention", cfg.History.Retention, "amount of changes kept on the history of each port, 0 keeping every change")
+	fs.IntVar(&cfg.Changes.Buffer, "changes-buffer", cfg.Changes.Buffer, "amount of latest port changes kept for resuming the change streams")
+	fs.IntVar(&cfg.Webhooks.Attempts, "webhook-attempts", cfg.Webhooks.Attempts, "amount of times a webhook delivery is attempted")
+	fs.DurationVar(&cfg.Webhooks.Backoff, "webhook-backoff", cfg.Webhooks.Backoff, "wait before the first retry of a webhook delivery, doubled on each retry")
+	fs.DurationVar(&cfg.Webhooks.Timeout, "webhook-timeout", cfg.Webhooks.Timeout, "how long a webhook delivery attempt may take")
+	fs.BoolVar(&cfg.Webhooks.AllowPrivateTargets, "webhook-allow-private-targets", cfg.Webhooks.AllowPrivateTargets, "accept webhooks on loopback, link-local and private addresses")
+	fs.Var((*listValue)(&cfg.Seed.Paths), "seed", "comma separated port files, or directories of them, synced at startup")
+	fs.BoolVar(&cfg.Seed.Lenient, "seed-lenient", cfg.Seed.Lenient, "skip the seed records that can't be decoded or are invalid")
+	fs.StringVar(&cfg.Watch.Path, "watch", cfg.Watch.Path, "ports file the catalogue is replaced with at startup, whenever it changes and on SIGHUP, deleting the ports missing from it, API writes included; not allowed along -seed")
+	fs.DurationVar(&cfg.Watch.Interval, "watch-interval", cfg.Watch.Interval, "how often the watched ports file is checked for changes")
+	fs.StringVar(&cfg.Log.Level, "log-level", cfg.Log.Level, "lowest level logged: debug, info, warn or error")
+	fs.StringVar(&cfg.Log.Format, "log-format", cfg.Log.Format, "format of the log records: json or text")
+	fs.BoolVar(&cfg.Log.Requests, "log-requests", cfg.Log.Requests, "log every request served")
+}
+
+// loadFile overrides cfg with the settings of the YAML file, rejecting the
+// unknown ones
+func loadFile(path string, cfg *Config) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to read config file")
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	decoder.KnownFields(true)
+	err = decoder.Decode(cfg)
+	if err != nil && err != io.EOF {
+		return errors.Wrapf(err, "failed to parse config file %s", path)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting
+func (c Config) Validate() error {
+	var errs []string
+	invalid := func(setting, message string) {
+		errs = append(errs, setting+": "+message)
+	}
+
+	_, _, err := net.SplitHostPort(c.Server.Addr)
+	if err != nil {
+		invalid("server.addr", "must be a host:port address")
+	}
+	for setting, timeout := range map[string]time.Duration{
+		"server.read_timeout":        c.Server.ReadTimeout,
+		"server.read_header_timeout": c.Server.ReadHeaderTimeout,
+		"server.write_timeout":       c.Server.WriteTimeout,
+		"server.idle_timeout":        c.Server.IdleTimeout,
+	} {
+		if timeout < 0 {
+			invalid(setting, "must not be negative")
+		}
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		invalid("server.shutdown_timeout", "must be positive")
+	}
+	if c.Limits.BodyBytes < 0 {
+		invalid("limits.body_bytes", "must not be negative")
+	}
+	if c.Limits.SyncBodyBytes < 0 {
+		invalid("limits.sync_body_bytes", "must not be negative")
+	}
+
+	switch c.Storage.Backend {
+	case "memory":
+	case "file":
+		if c.Storage.DataDir == "" {
+			invalid("storage.data_dir", "must be provided for the file storage")
+		}
+		if c.Storage.CompactEvery <= 0 {
+			invalid("storage.compact_every", "must be positive")
+		}
+	case "sqlite":
+		if c.Storage.SQLitePath == "" {
+			invalid("storage.sqlite_path", "must be provided for the sqlite storage")
+		}
+	default:
+		invalid("storage.backend", "must be memory, file or sqlite")
+	}
+	if c.History.Retention < 0 {
+		invalid("history.retention", "must not be negative")
+	}
+	if c.Changes.Buffer <= 0 {
+		invalid("changes.buffer", "must be positive")
+	}
+	if c.Webhooks.Attempts <= 0 {
+		invalid("webhooks.attempts", "must be positive")
+	}
+	if c.Webhooks.Backoff <= 0 {
+		invalid("webhooks.backoff", "must be positive")
+	}
+	if c.Webhooks.Timeout <= 0 {
+		invalid("webhooks.timeout", "must be positive")
+	}
+	if c.Watch.Interval <= 0 {
+		invalid("watch.interval", "must be positive")
+	}
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		invalid("log.level", "must be debug, info, warn or error")
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		invalid("log.format", "must be json or text")
+	}
+	for _, path := range c.Seed.Paths {
+		if path == "" {
+			invalid("seed.paths", "must not be empty")
+			break
+		}
+	}
+	if len(c.Seed.Paths) > 0 && c.Watch.Path != "" {
+		// the watched file would delete every seeded port missing from it
+		invalid("seed.paths", "must not be provided along watch.path")
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("invalid config: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Dump writes the settings as a YAML file Load accepts
+func (c Config) Dump(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	err := encoder.Encode(c)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode config")
+	}
+	return encoder.Close()
+}
+
+// listValue is a flag holding a comma separated list
+type listValue []string
+
+func (l *listValue) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *listValue) Set(value string) error {
+	*l = nil
+	if value != "" {
+		*l = strings.Split(value, ",")
+	}
+	return nil
+}
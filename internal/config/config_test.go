@@ -0,0 +1,150 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lookup(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, exists := env[key]
+		return value, exists
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "ports.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	var tests = []struct {
+		name          string
+		file          string
+		env           map[string]string
+		args          []string
+		expected      func(cfg *Config)
+		expectedError string
+	}{
+		{
+			name:     "Nothing provided should load the defaults",
+			expected: func(cfg *Config) {},
+		},
+		{
+			name: "File should override the defaults",
+			file: "server:\n  addr: 127.0.0.1:9090\n  shutdown_timeout: 5s\nstorage:\n  backend: sqlite\n  sqlite_path: /tmp/ports.db\n",
+			expected: func(cfg *Config) {
+				cfg.Server.Addr = "127.0.0.1:9090"
+				cfg.Server.ShutdownTimeout = 5 * time.Second
+				cfg.Storage.Backend = "sqlite"
+				cfg.Storage.SQLitePath = "/tmp/ports.db"
+			},
+		},
+		{
+			name: "Environment should override the file",
+			file: "server:\n  addr: 127.0.0.1:9090\nhistory:\n  retention: 10\n",
+			env:  map[string]string{"PORTS_ADDR": ":8081", "PORTS_WEBHOOK_BACKOFF": "2s", "PORTS_LOG_REQUESTS": "false", "PORTS_LOG_LEVEL": "debug", "PORTS_SEED": "ports.json,seeds"},
+			expected: func(cfg *Config) {
+				cfg.Log.Level = "debug"
+				cfg.Seed.Paths = []string{"ports.json", "seeds"}
+				cfg.Server.Addr = ":8081"
+				cfg.History.Retention = 10
+				cfg.Webhooks.Backoff = 2 * time.Second
+				cfg.Log.Requests = false
+			},
+		},
+		{
+			name: "Flags should override the environment and the file",
+			file: "limits:\n  body_bytes: 10\nseed:\n  paths: [ports.json]\nlog:\n  format: json\n",
+			env:  map[string]string{"PORTS_ADDR": ":8081", "PORTS_MAX_BODY_BYTES": "20", "PORTS_LOG_FORMAT": "json"},
+			args: []string{"-addr", ":8082", "-max-body-bytes", "30", "-changes-buffer", "5", "-seed", "seeds", "-log-format", "text"},
+			expected: func(cfg *Config) {
+				cfg.Log.Format = "text"
+				cfg.Seed.Paths = []string{"seeds"}
+				cfg.Server.Addr = ":8082"
+				cfg.Limits.BodyBytes = 30
+				cfg.Changes.Buffer = 5
+			},
+		},
+		{
+			name:          "Unknown file setting should be rejected",
+			file:          "server:\n  address: :8080\n",
+			expectedError: "field address not found",
+		},
+		{
+			name:          "Invalid environment value should be rejected",
+			env:           map[string]string{"PORTS_HISTORY_RETENTION": "many"},
+			expectedError: "PORTS_HISTORY_RETENTION: invalid value",
+		},
+		{
+			name:          "Invalid flag value should be rejected",
+			args:          []string{"-webhook-timeout", "soon"},
+			expectedError: "invalid value",
+		},
+		{
+			name:          "Invalid settings should be reported together",
+			args:          []string{"-storage", "postgres", "-addr", "8080", "-webhook-attempts", "0", "-watch-interval", "0s", "-log-level", "verbose", "-log-format", "xml"},
+			expectedError: "invalid config: log.format: must be json or text; log.level: must be debug, info, warn or error; server.addr: must be a host:port address; storage.backend: must be memory, file or sqlite; watch.interval: must be positive; webhooks.attempts: must be positive",
+		},
+		{
+			name:          "Seeding along a watched file should be rejected",
+			file:          "seed:\n  paths: [seeds]\n",
+			args:          []string{"-watch", "ports.json"},
+			expectedError: "invalid config: seed.paths: must not be provided along watch.path",
+		},
+		{
+			name:          "Missing file should be reported",
+			env:           map[string]string{"PORTS_CONFIG": "/nonexistent/ports.yaml"},
+			expectedError: "failed to read config file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, tt.file)}, args...)
+			}
+			if tt.env == nil {
+				tt.env = map[string]string{}
+			}
+			cfg, err := Load("ports-api", args, lookup(tt.env))
+			if tt.expectedError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			expected := Default()
+			tt.expected(&expected)
+			assert.Equal(t, expected, cfg)
+		})
+	}
+}
+
+func TestLoadHelp(t *testing.T) {
+	_, err := Load("ports-api", []string{"-h"}, lookup(nil))
+	assert.ErrorIs(t, err, flag.ErrHelp)
+}
+
+func TestDump(t *testing.T) {
+	cfg, err := Load("ports-api", []string{"-storage", "file", "-webhook-backoff", "3s", "-seed", "a.json,b.json"}, lookup(nil))
+	require.NoError(t, err)
+
+	var b bytes.Buffer
+	require.NoError(t, cfg.Dump(&b))
+	assert.Contains(t, b.String(), "backend: file\n")
+	assert.Contains(t, b.String(), "backoff: 3s\n")
+
+	// the dumped config should load back into the same settings
+	loaded, err := Load("ports-api", []string{"-config", writeFile(t, b.String())}, lookup(nil))
+	require.NoError(t, err)
+	assert.Equal(t, cfg, loaded)
+}
@@ -0,0 +1,139 @@
+// Package events publishes the port changes to in-process subscribers
+package events
+
+import (
+	"sync"
+
+	"github.com/WendelHime/ports/internal/shared/models"
+)
+
+const (
+	// DefaultBufferSize is the amount of latest events kept for resuming
+	DefaultBufferSize = 1000
+
+	// subscriberBuffer is the amount of events a subscriber may fall behind
+	// before being dropped
+	subscriberBuffer = 256
+)
+
+// Hub numbers the port changes it's notified of and publishes them to its
+// subscribers, keeping the latest ones so subscribers can resume from them
+type Hub struct {
+	sequence uint64
+	// buffer holds the latest events, oldest first
+	buffer      []models.PortEvent
+	size        int
+	subscribers map[*Subscription]struct{}
+	mutex       *sync.Mutex
+}
+
+// Subscription receives the events published after it's created. Its channel
+// is closed once unsubscribed or when it falls too far behind, in which case
+// it should resume from the last event received.
+type Subscription struct {
+	events chan models.PortEvent
+}
+
+// Events returns the channel the events are received on
+func (s *Subscription) Events() <-chan models.PortEvent {
+	return s.events
+}
+
+// NewHub returns a hub keeping the latest bufferSize events
+func NewHub(bufferSize int) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Hub{
+		size:        bufferSize,
+		subscribers: make(map[*Subscription]struct{}),
+		mutex:       new(sync.Mutex),
+	}
+}
+
+// PortsChanged publishes an event for each entry
+func (h *Hub) PortsChanged(entries []models.AuditEntry) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, entry := range entries {
+		h.sequence++
+		event := models.PortEvent{
+			Sequence:  h.sequence,
+			Type:      entry.Action,
+			Unloc:     entry.Unloc,
+			Timestamp: entry.Timestamp,
+			RequestID: entry.RequestID,
+			Changes:   entry.Changes,
+		}
+		if entry.New != nil {
+			event.Port = *entry.New
+		} else if entry.Previous != nil {
+			event.Port = *entry.Previous
+		}
+
+		if len(h.buffer) == h.size {
+			h.buffer = h.buffer[1:]
+		}
+		h.buffer = append(h.buffer, event)
+
+		for sub := range h.subscribers {
+			select {
+			case sub.events <- event:
+			default:
+				// a subscriber falling behind is dropped instead of
+				// holding the writes
+				h.drop(sub)
+			}
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events published from now on
+func (h *Hub) Subscribe() *Subscription {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.subscribe()
+}
+
+// Resume returns a subscription to the events published from now on and the
+// buffered events after the last one received, with the sequence lastID.
+// complete is false when some events after lastID aren't buffered anymore, or
+// lastID was never published, so the subscriber missed changes.
+func (h *Hub) Resume(lastID uint64) (sub *Subscription, missed []models.PortEvent, complete bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	sub = h.subscribe()
+
+	complete = lastID <= h.sequence
+	if len(h.buffer) > 0 && lastID+1 < h.buffer[0].Sequence {
+		complete = false
+	}
+	for _, event := range h.buffer {
+		if event.Sequence > lastID {
+			missed = append(missed, event)
+		}
+	}
+	return sub, missed, complete
+}
+
+// Unsubscribe stops publishing events to the subscription
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if _, exists := h.subscribers[sub]; exists {
+		h.drop(sub)
+	}
+}
+
+// subscribe adds a subscription, the caller must hold the mutex
+func (h *Hub) subscribe() *Subscription {
+	sub := &Subscription{events: make(chan models.PortEvent, subscriberBuffer)}
+	h.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// drop removes the subscription, the caller must hold the mutex
+func (h *Hub) drop(sub *Subscription) {
+	delete(h.subscribers, sub)
+	close(sub.events)
+}
@@ -0,0 +1,108 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/WendelHime/ports/internal/shared/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func entries(unlocs ...string) []models.AuditEntry {
+	entries := make([]models.AuditEntry, 0, len(unlocs))
+	for _, unloc := range unlocs {
+		port := models.Port{Unloc: unloc, Unlocs: []string{unloc}}
+		entries = append(entries, models.AuditEntry{Unloc: unloc, Action: models.AuditCreated, New: &port})
+	}
+	return entries
+}
+
+func sequences(events []models.PortEvent) []uint64 {
+	sequences := make([]uint64, 0, len(events))
+	for _, event := range events {
+		sequences = append(sequences, event.Sequence)
+	}
+	return sequences
+}
+
+func TestHubPublish(t *testing.T) {
+	hub := NewHub(10)
+	sub := hub.Subscribe()
+	hub.PortsChanged(entries("AEAJM", "AEAUH"))
+	deleted := models.Port{Unloc: "AEAJM", Name: "Ajman"}
+	hub.PortsChanged([]models.AuditEntry{{Unloc: "AEAJM", Action: models.AuditDeleted, Previous: &deleted}})
+
+	var received []models.PortEvent
+	for i := 0; i < 3; i++ {
+		received = append(received, <-sub.Events())
+	}
+	assert.Equal(t, []uint64{1, 2, 3}, sequences(received))
+	assert.Equal(t, "AEAUH", received[1].Unloc)
+	assert.Equal(t, models.AuditDeleted, received[2].Type)
+	assert.Equal(t, "Ajman", received[2].Port.Name)
+
+	hub.Unsubscribe(sub)
+	_, open := <-sub.Events()
+	assert.False(t, open)
+}
+
+func TestHubResume(t *testing.T) {
+	var tests = []struct {
+		name             string
+		lastID           uint64
+		expectedMissed   []uint64
+		expectedComplete bool
+	}{
+		{
+			name:             "Resume should return the events after the last one",
+			lastID:           3,
+			expectedMissed:   []uint64{4, 5},
+			expectedComplete: true,
+		},
+		{
+			name:             "Resume from the latest event should miss nothing",
+			lastID:           5,
+			expectedMissed:   []uint64{},
+			expectedComplete: true,
+		},
+		{
+			name:             "Resume from an event no longer buffered should be incomplete",
+			lastID:           1,
+			expectedMissed:   []uint64{3, 4, 5},
+			expectedComplete: false,
+		},
+		{
+			name:             "Resume from an event never published should be incomplete",
+			lastID:           9,
+			expectedMissed:   []uint64{},
+			expectedComplete: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := NewHub(3)
+			hub.PortsChanged(entries("AEAJM", "AEAUH", "AEDXB", "FJSUV", "BRSSZ"))
+			sub, missed, complete := hub.Resume(tt.lastID)
+			defer hub.Unsubscribe(sub)
+			assert.Equal(t, tt.expectedMissed, sequences(missed))
+			assert.Equal(t, tt.expectedComplete, complete)
+		})
+	}
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	hub := NewHub(10)
+	slow := hub.Subscribe()
+	unlocs := make([]string, subscriberBuffer+1)
+	for i := range unlocs {
+		unlocs[i] = "AEAJM"
+	}
+	hub.PortsChanged(entries(unlocs...))
+
+	received := 0
+	for range slow.Events() {
+		received++
+	}
+	assert.Equal(t, subscriberBuffer, received)
+	// unsubscribing a dropped subscriber is a no-op
+	hub.Unsubscribe(slow)
+}
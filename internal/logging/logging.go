@@ -0,0 +1,105 @@
+// Package logging builds the structured logger and carries it on the context,
+// enriched with the request being served
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Formats of the log records
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+type contextKey struct{}
+
+// New returns a logger writing the records of the level and above to w on the
+// format, json or text
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+// ParseLevel parses debug, info, warn or error, case insensitively
+func ParseLevel(level string) (slog.Level, error) {
+	var lvl slog.Level
+	switch strings.ToLower(level) {
+	case "debug", "info", "warn", "error":
+		err := lvl.UnmarshalText([]byte(level))
+		return lvl, err
+	default:
+		return lvl, fmt.Errorf("unknown log level %q", level)
+	}
+}
+
+// WithLogger returns a copy of ctx carrying the logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default one
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Requests returns the middleware carrying the logger on the request context,
+// enriched with the request ID set by middleware.RequestID, and, when
+// logRequests is set, logging every request once served
+func Requests(logger *slog.Logger, logRequests bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestLogger := logger
+			if requestID := middleware.GetReqID(r.Context()); requestID != "" {
+				requestLogger = logger.With("request_id", requestID)
+			}
+			r = r.WithContext(WithLogger(r.Context(), requestLogger))
+			if !logRequests {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			level := slog.LevelInfo
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			requestLogger.Log(r.Context(), level, "request served",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", status,
+				"bytes", ww.BytesWritten(),
+				"duration_ms", time.Since(start).Milliseconds(),
+				"remote_addr", r.RemoteAddr,
+			)
+		})
+	}
+}
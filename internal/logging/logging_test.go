@@ -0,0 +1,144 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	var tests = []struct {
+		name          string
+		format        string
+		level         string
+		expected      string
+		expectedError string
+	}{
+		{
+			name:     "JSON format should write JSON records",
+			format:   FormatJSON,
+			level:    "info",
+			expected: `"msg":"shown"`,
+		},
+		{
+			name:     "Text format should write key=value records",
+			format:   FormatText,
+			level:    "INFO",
+			expected: "msg=shown",
+		},
+		{
+			name:     "Records under the level shouldn't be written",
+			format:   FormatText,
+			level:    "error",
+			expected: "",
+		},
+		{
+			name:          "Unknown format should be rejected",
+			format:        "xml",
+			level:         "info",
+			expectedError: `unknown log format "xml"`,
+		},
+		{
+			name:          "Unknown level should be rejected",
+			format:        FormatJSON,
+			level:         "verbose",
+			expectedError: `unknown log level "verbose"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := new(bytes.Buffer)
+			logger, err := New(logs, tt.format, tt.level)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			logger.Debug("hidden")
+			logger.Info("shown")
+			assert.NotContains(t, logs.String(), "hidden")
+			if tt.expected == "" {
+				assert.Empty(t, logs.String())
+			} else {
+				assert.Contains(t, logs.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	logger, err := New(new(bytes.Buffer), FormatJSON, "info")
+	require.NoError(t, err)
+	assert.Same(t, logger, FromContext(WithLogger(context.Background(), logger)))
+	assert.NotNil(t, FromContext(context.Background()))
+}
+
+func TestRequests(t *testing.T) {
+	var tests = []struct {
+		name          string
+		logRequests   bool
+		status        int
+		expectedLevel string
+	}{
+		{
+			name:          "Served request should be logged",
+			logRequests:   true,
+			status:        http.StatusOK,
+			expectedLevel: "INFO",
+		},
+		{
+			name:          "Request failing on the server should be logged as an error",
+			logRequests:   true,
+			status:        http.StatusInternalServerError,
+			expectedLevel: "ERROR",
+		},
+		{
+			name:   "Requests shouldn't be logged unless asked",
+			status: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := new(bytes.Buffer)
+			logger, err := New(logs, FormatJSON, "info")
+			require.NoError(t, err)
+			handler := middleware.RequestID(Requests(logger, tt.logRequests)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				FromContext(r.Context()).Info("handling")
+				w.WriteHeader(tt.status)
+			})))
+			req := httptest.NewRequest(http.MethodGet, "/ports", nil)
+			req.Header.Set(middleware.RequestIDHeader, "request-1")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			var records []map[string]interface{}
+			decoder := json.NewDecoder(logs)
+			for decoder.More() {
+				var record map[string]interface{}
+				require.NoError(t, decoder.Decode(&record))
+				records = append(records, record)
+			}
+			expected := 1
+			if tt.logRequests {
+				expected = 2
+			}
+			require.Len(t, records, expected)
+			// the handler logs carry the request ID
+			assert.Equal(t, "handling", records[0]["msg"])
+			assert.Equal(t, "request-1", records[0]["request_id"])
+			if tt.logRequests {
+				assert.Equal(t, "request served", records[1]["msg"])
+				assert.Equal(t, tt.expectedLevel, records[1]["level"])
+				assert.Equal(t, "request-1", records[1]["request_id"])
+				assert.Equal(t, "/ports", records[1]["path"])
+				assert.Equal(t, float64(tt.status), records[1]["status"])
+			}
+		})
+	}
+}
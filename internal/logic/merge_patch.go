@@ -0,0 +1,64 @@
+package logic
+
+import (
+	"encoding/json"
+	"fmt"
+
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/WendelHime/ports/internal/shared/models"
+)
+
+// patchPort applies the RFC 7396 JSON merge patch to the port
+func patchPort(port models.Port, patch []byte) (models.Port, error) {
+	var changes interface{}
+	err := json.Unmarshal(patch, &changes)
+	if err != nil {
+		return models.Port{}, localErrs.New(localErrs.CodeBadRequest, "patch must be a JSON merge patch")
+	}
+	if _, ok := changes.(map[string]interface{}); !ok {
+		return models.Port{}, localErrs.New(localErrs.CodeBadRequest, "patch must be a JSON object")
+	}
+
+	b, err := json.Marshal(port)
+	if err != nil {
+		return models.Port{}, err
+	}
+	var document interface{}
+	err = json.Unmarshal(b, &document)
+	if err != nil {
+		return models.Port{}, err
+	}
+
+	b, err = json.Marshal(mergePatch(document, changes))
+	if err != nil {
+		return models.Port{}, err
+	}
+	var patched models.Port
+	err = json.Unmarshal(b, &patched)
+	if err != nil {
+		return models.Port{}, localErrs.New(localErrs.CodeUnprocessableEntity, fmt.Sprintf("patched port is invalid: %v", err))
+	}
+	return patched, nil
+}
+
+// mergePatch merges the patch into the target as defined by RFC 7396: null
+// members are removed, objects are merged recursively and any other value
+// replaces the target one
+func mergePatch(target, patch interface{}) interface{} {
+	changes, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	document, ok := target.(map[string]interface{})
+	if !ok {
+		document = make(map[string]interface{})
+	}
+	for name, value := range changes {
+		if value == nil {
+			delete(document, name)
+			continue
+		}
+		document[name] = mergePatch(document[name], value)
+	}
+	return document
+}
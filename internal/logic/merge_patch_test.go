@@ -0,0 +1,126 @@
+package logic
+
+import (
+	"testing"
+
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/WendelHime/ports/internal/shared/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPortMergePatch(t *testing.T) {
+	storedPort := func() models.Port {
+		return models.Port{
+			Unloc:       "BRSSZ",
+			Name:        "Santos",
+			Country:     "Brazil",
+			Alias:       []string{"Porto de Santos"},
+			Coordinates: []decimal.Decimal{decimal.RequireFromString("-46.33"), decimal.RequireFromString("-23.96")},
+			Timezone:    "America/Sao_Paulo",
+			Unlocs:      []string{"BRSSZ"},
+			Version:     2,
+		}
+	}
+	var tests = []struct {
+		name   string
+		patch  string
+		assert func(t *testing.T, port models.Port, err error)
+	}{
+		{
+			name:  "patch should replace the given fields only",
+			patch: `{"alias": ["Santos Port"], "timezone": "America/Recife"}`,
+			assert: func(t *testing.T, port models.Port, err error) {
+				assert.NoError(t, err)
+				expected := storedPort()
+				expected.Alias = []string{"Santos Port"}
+				expected.Timezone = "America/Recife"
+				assert.True(t, expected.Equal(port))
+			},
+		},
+		{
+			name:  "null members should be removed",
+			patch: `{"alias": null, "coordinates": null}`,
+			assert: func(t *testing.T, port models.Port, err error) {
+				assert.NoError(t, err)
+				assert.Nil(t, port.Alias)
+				assert.Nil(t, port.Coordinates)
+				assert.Equal(t, "Santos", port.Name)
+			},
+		},
+		{
+			name:  "empty patch should keep the port",
+			patch: `{}`,
+			assert: func(t *testing.T, port models.Port, err error) {
+				assert.NoError(t, err)
+				assert.True(t, storedPort().Equal(port))
+			},
+		},
+		{
+			name:  "patch other than an object should fail",
+			patch: `["alias"]`,
+			assert: func(t *testing.T, _ models.Port, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrBadRequest)
+			},
+		},
+		{
+			name:  "malformed patch should fail",
+			patch: `{"alias": `,
+			assert: func(t *testing.T, _ models.Port, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrBadRequest)
+			},
+		},
+		{
+			name:  "patch with mistyped fields should fail",
+			patch: `{"alias": "Santos Port"}`,
+			assert: func(t *testing.T, _ models.Port, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrUnprocessableEntity)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, err := patchPort(storedPort(), []byte(tt.patch))
+			tt.assert(t, port, err)
+		})
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	var tests = []struct {
+		name     string
+		target   interface{}
+		patch    interface{}
+		expected interface{}
+	}{
+		{
+			name:     "nested objects should be merged",
+			target:   map[string]interface{}{"a": map[string]interface{}{"b": "c", "d": "e"}},
+			patch:    map[string]interface{}{"a": map[string]interface{}{"b": "f"}},
+			expected: map[string]interface{}{"a": map[string]interface{}{"b": "f", "d": "e"}},
+		},
+		{
+			name:     "null members should be removed",
+			target:   map[string]interface{}{"a": "b", "c": "d"},
+			patch:    map[string]interface{}{"a": nil},
+			expected: map[string]interface{}{"c": "d"},
+		},
+		{
+			name:     "arrays should be replaced",
+			target:   map[string]interface{}{"a": []interface{}{"b", "c"}},
+			patch:    map[string]interface{}{"a": []interface{}{"d"}},
+			expected: map[string]interface{}{"a": []interface{}{"d"}},
+		},
+		{
+			name:     "objects should replace other values",
+			target:   map[string]interface{}{"a": "b"},
+			patch:    map[string]interface{}{"a": map[string]interface{}{"c": nil, "d": "e"}},
+			expected: map[string]interface{}{"a": map[string]interface{}{"d": "e"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, mergePatch(tt.target, tt.patch))
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package logic
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/WendelHime/ports/internal/metrics"
+	"github.com/WendelHime/ports/internal/shared/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// syncBuckets are the upper bounds, in seconds, of the sync latency histogram
+var syncBuckets = []float64{.01, .05, .1, .5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// meteredPortLogic measures the syncs of the service
+type meteredPortLogic struct {
+	PortDomainService
+	syncs          *prometheus.CounterVec
+	syncLatency    *prometheus.HistogramVec
+	bytesRead      prometheus.Counter
+	ports          *prometheus.CounterVec
+	lastThroughput prometheus.Gauge
+}
+
+// NewMeteredPortDomainService measures on the registry the syncs of service,
+// their latency and throughput, in ports decoded and bytes read
+func NewMeteredPortDomainService(service PortDomainService, reg prometheus.Registerer) PortDomainService {
+	factory := promauto.With(reg)
+	return &meteredPortLogic{
+		PortDomainService: service,
+		syncs: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "ports_sync_total",
+			Help: "Amount of port syncs.",
+		}, []string{"mode", "result"}),
+		syncLatency: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ports_sync_duration_seconds",
+			Help:    "Latency of the port syncs.",
+			Buckets: syncBuckets,
+		}, []string{"mode"}),
+		bytesRead: factory.NewCounter(prometheus.CounterOpts{
+			Name: "ports_sync_bytes_read_total",
+			Help: "Bytes read from the sync inputs.",
+		}),
+		ports: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "ports_sync_ports_total",
+			Help: "Ports decoded by the syncs, per outcome.",
+		}, []string{"outcome"}),
+		lastThroughput: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "ports_sync_last_ports_per_second",
+			Help: "Ports decoded per second by the last successful sync.",
+		}),
+	}
+}
+
+func (l *meteredPortLogic) SyncPorts(ctx context.Context, ports io.Reader, opts SyncOptions) (models.SyncReport, error) {
+	mode := string(opts.Mode)
+	if mode == "" {
+		mode = string(SyncModeUpsert)
+	}
+	reader := metrics.NewCountingReader(ports)
+	start := time.Now()
+	report, err := l.PortDomainService.SyncPorts(ctx, reader, opts)
+	elapsed := time.Since(start)
+
+	l.bytesRead.Add(float64(reader.Count()))
+	l.syncLatency.WithLabelValues(mode).Observe(elapsed.Seconds())
+	if err != nil {
+		l.syncs.WithLabelValues(mode, "error").Inc()
+		return report, err
+	}
+	l.syncs.WithLabelValues(mode, "ok").Inc()
+	l.ports.WithLabelValues("created").Add(float64(report.Created))
+	l.ports.WithLabelValues("updated").Add(float64(report.Updated))
+	l.ports.WithLabelValues("unchanged").Add(float64(report.Unchanged))
+	l.ports.WithLabelValues("deleted").Add(float64(report.Deleted))
+	l.ports.WithLabelValues("failed").Add(float64(report.Failed))
+	if elapsed > 0 {
+		decoded := report.Created + report.Updated + report.Unchanged + report.Failed
+		l.lastThroughput.Set(float64(decoded) / elapsed.Seconds())
+	}
+	return report, nil
+}
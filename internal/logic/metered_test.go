@@ -0,0 +1,53 @@
+package logic
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/WendelHime/ports/internal/metrics"
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/WendelHime/ports/internal/shared/models"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeteredSyncPorts(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	service := NewMockPortDomainService(ctrl)
+	service.EXPECT().SyncPorts(ctx, gomock.Any(), SyncOptions{}).
+		DoAndReturn(func(ctx context.Context, ports io.Reader, opts SyncOptions) (models.SyncReport, error) {
+			_, err := io.ReadAll(ports)
+			return models.SyncReport{Created: 2, Unchanged: 1, Failed: 1}, err
+		}).Times(1)
+	service.EXPECT().SyncPorts(ctx, gomock.Any(), SyncOptions{Mode: SyncModeReplace}).
+		Return(models.SyncReport{}, localErrs.ErrBadRequest).Times(1)
+	service.EXPECT().GetPort(ctx, "AEAJM").Return(models.Port{Unloc: "AEAJM"}, nil).Times(1)
+
+	reg := metrics.NewRegistry()
+	metered := NewMeteredPortDomainService(service, reg)
+	report, err := metered.SyncPorts(ctx, strings.NewReader(`{"AEAJM":{}}`), SyncOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, models.SyncReport{Created: 2, Unchanged: 1, Failed: 1}, report)
+	_, err = metered.SyncPorts(ctx, strings.NewReader(""), SyncOptions{Mode: SyncModeReplace})
+	assert.ErrorIs(t, err, localErrs.ErrBadRequest)
+	port, err := metered.GetPort(ctx, "AEAJM")
+	require.NoError(t, err)
+	assert.Equal(t, "AEAJM", port.Unloc)
+
+	w := httptest.NewRecorder()
+	metrics.Handler(reg).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	exposition := w.Body.String()
+	assert.Contains(t, exposition, `ports_sync_total{mode="upsert",result="ok"} 1`)
+	assert.Contains(t, exposition, `ports_sync_total{mode="replace",result="error"} 1`)
+	assert.Contains(t, exposition, "ports_sync_bytes_read_total 12\n")
+	assert.Contains(t, exposition, `ports_sync_ports_total{outcome="created"} 2`)
+	assert.Contains(t, exposition, `ports_sync_ports_total{outcome="failed"} 1`)
+	assert.Contains(t, exposition, `ports_sync_duration_seconds_count{mode="upsert"} 1`)
+	assert.Contains(t, exposition, "ports_sync_last_ports_per_second ")
+}
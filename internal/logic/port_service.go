@@ -8,26 +8,76 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
+	"github.com/WendelHime/ports/internal/logging"
 	localErrs "github.com/WendelHime/ports/internal/shared/errors"
 	"github.com/WendelHime/ports/internal/shared/models"
 	"github.com/WendelHime/ports/internal/storage"
 )
 
+const (
+	// DefaultPageSize is the amount of ports listed when no limit is provided
+	DefaultPageSize = 50
+	// MaxPageSize is the maximum amount of ports listed per page
+	MaxPageSize = 500
+	// MaxRadiusKm is half of the earth circumference, enough to reach any point
+	MaxRadiusKm = 20038
+	// maxPatchAttempts is how many times an unconditional patch is applied
+	// when the port keeps being changed concurrently
+	maxPatchAttempts = 3
+)
+
+// SyncMode defines how SyncPorts handles the stored ports missing from the input
+type SyncMode string
+
+const (
+	// SyncModeUpsert creates and updates the input ports, keeping the missing ones
+	SyncModeUpsert SyncMode = "upsert"
+	// SyncModeReplace creates and updates the input ports, deleting the missing ones
+	SyncModeReplace SyncMode = "replace"
+)
+
+// SyncOptions holds the settings of a single SyncPorts call
+type SyncOptions struct {
+	// Mode defaults to SyncModeUpsert
+	Mode SyncMode
+	// Lenient skips the records that can't be decoded or are invalid,
+	// reporting them as failed, instead of aborting the sync
+	Lenient bool
+}
+
 type PortDomainService interface {
-	SyncPorts(ctx context.Context, ports io.Reader) error
+	SyncPorts(ctx context.Context, ports io.Reader, opts SyncOptions) (models.SyncReport, error)
 	GetPort(ctx context.Context, unloc string) (models.Port, error)
+	GetPortAt(ctx context.Context, unloc string, at time.Time) (models.Port, error)
+	ExportPorts(ctx context.Context, at time.Time) ([]models.Port, error)
+	PutPort(ctx context.Context, unloc string, port models.Port) (models.Port, bool, error)
+	PatchPort(ctx context.Context, unloc string, patch []byte, version int64) (models.Port, error)
+	DeletePort(ctx context.Context, unloc string) error
+	PortHistory(ctx context.Context, unloc string) ([]models.AuditEntry, error)
+	ListPorts(ctx context.Context, filter models.PortFilter) (models.PortPage, error)
+	NearbyPorts(ctx context.Context, query models.NearbyQuery) ([]models.PortDistance, error)
+	PortsWithin(ctx context.Context, box models.BoundingBox, limit int) ([]models.Port, error)
+	SearchPorts(ctx context.Context, query string, limit int) ([]models.PortMatch, error)
 }
 
 type portLogic struct {
 	repository storage.PortRepository
+	history    storage.PortHistory
 }
 
-func NewPortDomainService(repo storage.PortRepository) PortDomainService {
+// NewPortDomainService returns the service managing the ports on repo, whose
+// changes are retrieved from history when it isn't nil
+func NewPortDomainService(repo storage.PortRepository, history storage.PortHistory) PortDomainService {
 	return &portLogic{
 		repository: repo,
+		history:    history,
 	}
 }
 
@@ -39,57 +89,510 @@ func (l portLogic) GetPort(ctx context.Context, unloc string) (models.Port, erro
 	return port, err
 }
 
+// GetPortAt returns the port stored under the unloc as it was at the instant
+func (l portLogic) GetPortAt(ctx context.Context, unloc string, at time.Time) (models.Port, error) {
+	if unloc == "" {
+		return models.Port{}, errors.Wrap(localErrs.ErrBadRequest, "invalid unloc provided")
+	}
+	if l.history == nil {
+		return models.Port{}, errNoHistory
+	}
+	return l.history.PortAt(ctx, unloc, at)
+}
+
+// ExportPorts returns every port ordered by unloc as they were at the instant,
+// the zero instant exporting the current ports
+func (l portLogic) ExportPorts(ctx context.Context, at time.Time) ([]models.Port, error) {
+	if at.IsZero() {
+		page, err := l.repository.List(ctx, models.PortFilter{})
+		return page.Ports, err
+	}
+	if l.history == nil {
+		return nil, errNoHistory
+	}
+	return l.history.PortsAt(ctx, at)
+}
+
+// errNoHistory is returned when reading past ports without a history
+var errNoHistory = localErrs.New(localErrs.CodeUnprocessableEntity, "ports history isn't recorded")
+
+// PutPort creates or replaces the port stored under the unloc, returning it
+// as stored and whether it was created. A stored port keeps its primary
+// unloc, even when replaced by another of its unlocs. A port with a version
+// only replaces the stored one while it's still on that version.
+func (l portLogic) PutPort(ctx context.Context, unloc string, port models.Port) (models.Port, bool, error) {
+	if unloc == "" {
+		return models.Port{}, false, errors.Wrap(localErrs.ErrBadRequest, "invalid unloc provided")
+	}
+	port = canonicalPort(unloc, port)
+
+	stored, err := l.repository.Get(ctx, unloc)
+	created := errors.Is(err, localErrs.ErrNotFound)
+	if err != nil && !created {
+		return models.Port{}, false, repositoryError(ctx, "unexpected error when retrieving port info from database", err, "unloc", unloc)
+	}
+	if !created && len(stored.Unlocs) > 0 {
+		port = canonicalPort(stored.Unlocs[0], port)
+	}
+	err = validatePort(port)
+	if err != nil {
+		return models.Port{}, false, err
+	}
+
+	if created {
+		err = l.repository.Create(ctx, port)
+	} else {
+		err = l.repository.Update(ctx, port)
+	}
+	if err != nil {
+		return models.Port{}, false, err
+	}
+	port, err = l.repository.Get(ctx, port.Unloc)
+	return port, created, err
+}
+
+// PatchPort applies the JSON merge patch to the port stored under the unloc,
+// returning it as stored. A version other than zero only patches the port
+// while it's still on that version.
+func (l portLogic) PatchPort(ctx context.Context, unloc string, patch []byte, version int64) (models.Port, error) {
+	if unloc == "" {
+		return models.Port{}, errors.Wrap(localErrs.ErrBadRequest, "invalid unloc provided")
+	}
+	for attempt := 1; ; attempt++ {
+		stored, err := l.repository.Get(ctx, unloc)
+		if err != nil {
+			return models.Port{}, err
+		}
+		if version != 0 && stored.Version != version {
+			return models.Port{}, localErrs.New(localErrs.CodePreconditionFailed, fmt.Sprintf("port %s isn't on version %d", unloc, version))
+		}
+
+		port, err := patchPort(stored, patch)
+		if err != nil {
+			return models.Port{}, err
+		}
+		// the patch is written over the read port, whatever version or
+		// canonical unloc it claims, as the port may be read by another unloc
+		port.Version = stored.Version
+		if len(stored.Unlocs) > 0 {
+			port = canonicalPort(stored.Unlocs[0], port)
+		}
+		err = validatePort(port)
+		if err != nil {
+			return models.Port{}, err
+		}
+
+		err = l.repository.Update(ctx, port)
+		if version == 0 && attempt < maxPatchAttempts && errors.Is(err, localErrs.ErrPreconditionFailed) {
+			continue
+		}
+		if err != nil {
+			return models.Port{}, err
+		}
+		return l.repository.Get(ctx, port.Unloc)
+	}
+}
+
+// DeletePort removes the port from every one of its unlocs
+func (l portLogic) DeletePort(ctx context.Context, unloc string) error {
+	if unloc == "" {
+		return errors.Wrap(localErrs.ErrBadRequest, "invalid unloc provided")
+	}
+	return l.repository.Delete(ctx, unloc)
+}
+
+// PortHistory returns the recorded changes of the port that is, or was, stored
+// under the unloc, oldest first
+func (l portLogic) PortHistory(ctx context.Context, unloc string) ([]models.AuditEntry, error) {
+	if unloc == "" {
+		return nil, errors.Wrap(localErrs.ErrBadRequest, "invalid unloc provided")
+	}
+	entries := []models.AuditEntry{}
+	if l.history != nil {
+		var err error
+		entries, err = l.history.History(ctx, unloc)
+		if err != nil {
+			return nil, repositoryError(ctx, "unexpected error when retrieving port history", err, "unloc", unloc)
+		}
+	}
+	// a port without changes recorded still has an empty history
+	if len(entries) == 0 {
+		_, err := l.repository.Get(ctx, unloc)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// ListPorts returns a page of ports matching the filter ordered by unloc
+func (l portLogic) ListPorts(ctx context.Context, filter models.PortFilter) (models.PortPage, error) {
+	var err error
+	filter.Limit, err = pageLimit(filter.Limit)
+	if err != nil {
+		return models.PortPage{}, err
+	}
+	return l.repository.List(ctx, filter)
+}
+
+// NearbyPorts returns the ports within the query radius ordered by distance
+func (l portLogic) NearbyPorts(ctx context.Context, query models.NearbyQuery) ([]models.PortDistance, error) {
+	err := validateLocation(query.Latitude, query.Longitude)
+	if err != nil {
+		return nil, err
+	}
+	if query.RadiusKm <= 0 || query.RadiusKm > MaxRadiusKm {
+		return nil, errors.Wrap(localErrs.ErrBadRequest, fmt.Sprintf("radius must be between 0 and %d km", MaxRadiusKm))
+	}
+	query.Limit, err = pageLimit(query.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return l.repository.Nearby(ctx, query)
+}
+
+// PortsWithin returns the ports inside the bounding box ordered by unloc
+func (l portLogic) PortsWithin(ctx context.Context, box models.BoundingBox, limit int) ([]models.Port, error) {
+	err := validateLocation(box.MinLatitude, box.MinLongitude)
+	if err != nil {
+		return nil, err
+	}
+	err = validateLocation(box.MaxLatitude, box.MaxLongitude)
+	if err != nil {
+		return nil, err
+	}
+	if box.MinLatitude > box.MaxLatitude {
+		return nil, errors.Wrap(localErrs.ErrBadRequest, "minimum latitude must not be greater than maximum latitude")
+	}
+	limit, err = pageLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	return l.repository.Within(ctx, box, limit)
+}
+
+// SearchPorts returns the ports whose name, city, alias or province match the
+// query, tolerating typos, diacritics and partial words, best matches first
+func (l portLogic) SearchPorts(ctx context.Context, query string, limit int) ([]models.PortMatch, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, errors.Wrap(localErrs.ErrBadRequest, "empty search query provided")
+	}
+	limit, err := pageLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	return l.repository.Search(ctx, query, limit)
+}
+
+// pageLimit validates the provided limit, falling back to the default page size
+func pageLimit(limit int) (int, error) {
+	if limit < 0 || limit > MaxPageSize {
+		return 0, errors.Wrap(localErrs.ErrBadRequest, fmt.Sprintf("limit must be between 1 and %d", MaxPageSize))
+	}
+	if limit == 0 {
+		return DefaultPageSize, nil
+	}
+	return limit, nil
+}
+
+func validateLocation(lat, lon float64) error {
+	if lat < -90 || lat > 90 {
+		return errors.Wrap(localErrs.ErrBadRequest, "latitude must be between -90 and 90")
+	}
+	if lon < -180 || lon > 180 {
+		return errors.Wrap(localErrs.ErrBadRequest, "longitude must be between -180 and 180")
+	}
+	return nil
+}
+
 // SyncPorts validate and decode the provided ports input without loading
-// the entire input
-func (l portLogic) SyncPorts(ctx context.Context, ports io.Reader) error {
+// the entire input. On replace mode, the ports missing from the input are
+// deleted once the whole input was synced. Every write happens on a single
+// transaction, so a failing input leaves the storage untouched and only its
+// failures are reported. The sync and its failures are logged through the
+// context logger.
+func (l portLogic) SyncPorts(ctx context.Context, ports io.Reader, opts SyncOptions) (models.SyncReport, error) {
+	if opts.Mode == "" {
+		opts.Mode = SyncModeUpsert
+	}
+	logger := logging.FromContext(ctx).With("mode", opts.Mode, "lenient", opts.Lenient)
+	logger.Info("sync started")
+	report, err := l.sync(ctx, ports, opts)
+	if err != nil {
+		level := slog.LevelWarn
+		if errors.Is(err, localErrs.ErrInternalServerError) {
+			level = slog.LevelError
+		}
+		logger.Log(ctx, level, "sync failed",
+			"failed", report.Failed,
+			"duration_ms", report.DurationMs,
+			"error", err.Error(),
+		)
+		return report, err
+	}
+	logger.Info("sync finished",
+		"created", report.Created,
+		"updated", report.Updated,
+		"unchanged", report.Unchanged,
+		"deleted", report.Deleted,
+		"failed", report.Failed,
+		"duration_ms", report.DurationMs,
+	)
+	return report, nil
+}
+
+// sync runs SyncPorts on the mode already defaulted
+func (l portLogic) sync(ctx context.Context, ports io.Reader, opts SyncOptions) (models.SyncReport, error) {
+	start := time.Now()
+	var report models.SyncReport
+	if opts.Mode != SyncModeUpsert && opts.Mode != SyncModeReplace {
+		return report, errors.Wrap(localErrs.ErrBadRequest, fmt.Sprintf("unknown sync mode %q", opts.Mode))
+	}
+
 	decoder := json.NewDecoder(ports)
 	portsIsEmpty := decoder.More()
 	if !portsIsEmpty {
-		return errors.Wrap(localErrs.ErrBadRequest, "port input is empty")
+		return report, errors.Wrap(localErrs.ErrBadRequest, "port input is empty")
 	}
 
 	// getting first token "{"
-	_, err := decoder.Token()
+	token, err := decoder.Token()
+	if err != nil {
+		return report, inputError("couldn't acquire first token from input", err)
+	}
+	if token != json.Delim('{') {
+		return report, errors.Wrap(localErrs.ErrBadRequest, "port input must be a JSON object")
+	}
+
+	tx, err := l.repository.Begin(ctx)
+	if err != nil {
+		return report, repositoryError(ctx, "failed to begin transaction", err)
+	}
+	err = l.syncPorts(ctx, tx, decoder, opts, &report)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		report = models.SyncReport{Failed: report.Failed, Errors: report.Errors}
+		report.DurationMs = time.Since(start).Milliseconds()
+		return report, err
+	}
+	err = tx.Commit(ctx)
+	if errors.Is(err, localErrs.ErrConflict) || errors.Is(err, localErrs.ErrPreconditionFailed) {
+		// a concurrent write changed the ports synced, the sync may be retried
+		return models.SyncReport{}, err
+	}
 	if err != nil {
-		return errors.Wrap(localErrs.ErrBadRequest, fmt.Sprintf("couldn't acquire first token from input: %+v", err))
+		return models.SyncReport{}, repositoryError(ctx, "failed to commit transaction", err)
 	}
+	report.DurationMs = time.Since(start).Milliseconds()
+	return report, nil
+}
 
+// syncPorts writes every port left on the decoder through the transaction,
+// counting the outcome of each record on the report
+func (l portLogic) syncPorts(ctx context.Context, tx storage.PortTransaction, decoder *json.Decoder, opts SyncOptions, report *models.SyncReport) error {
+	// unlocs present on the input, used for removing the missing ones on replace mode
+	seen := make(map[string]struct{})
+	// canonical unloc of the input record owning each unloc
+	owners := make(map[string]string)
 	for decoder.More() {
 		// retrieving unloc
 		unlocToken, err := decoder.Token()
 		if err != nil {
-			return errors.Wrap(localErrs.ErrInternalServerError, fmt.Sprintf("failed to acquire unloc: %+v", err))
+			return failRecord(ctx, report, "", decoder.InputOffset(), "failed to acquire unloc", err)
+		}
+		unloc, ok := unlocToken.(string)
+		if !ok {
+			return failRecord(ctx, report, "", decoder.InputOffset(), "failed to acquire unloc", fmt.Errorf("unexpected %v", unlocToken))
+		}
+		seen[unloc] = struct{}{}
+
+		// reading the whole object before decoding it, so a record with
+		// unexpected values can be skipped while a malformed input can't
+		var raw json.RawMessage
+		err = decoder.Decode(&raw)
+		if err != nil {
+			return failRecord(ctx, report, unloc, decoder.InputOffset(), "failed to read port", err)
 		}
-		unloc := unlocToken.(string)
+		offset := decoder.InputOffset() - int64(len(raw))
 
 		// decoding object
 		var port models.Port
-		err = decoder.Decode(&port)
+		err = json.Unmarshal(raw, &port)
 		if err != nil {
-			return errors.Wrap(localErrs.ErrInternalServerError, fmt.Sprintf("failed to decode port: %+v", err))
+			message := fmt.Sprintf("failed to decode port: %v", err)
+			reportFailure(ctx, report, unloc, offset, message)
+			err = errors.Wrap(localErrs.ErrUnprocessableEntity, message)
+			if opts.Lenient {
+				continue
+			}
+			return err
 		}
-
-		// checking if port/unloc exists on database
-		_, err = l.repository.Get(ctx, unloc)
-		if err != nil && err != localErrs.ErrNotFound {
-			return errors.Wrap(localErrs.ErrInternalServerError, fmt.Sprintf("unexpected error when retrieving port info from database: %+v", err))
+		// synced ports always overwrite the stored ones, whatever their version
+		port.Version = 0
+		port = canonicalPort(unloc, port)
+		for _, portUnloc := range port.Unlocs {
+			seen[portUnloc] = struct{}{}
 		}
 
-		// if port doesn't exist, let's create!
-		if err == localErrs.ErrNotFound {
-			err = l.repository.Create(ctx, port)
-			if err != nil {
-				return errors.Wrap(localErrs.ErrInternalServerError, fmt.Sprintf("failed to create port [%+v] on storage: %+v", port, err))
+		err = validatePort(port)
+		if err == nil {
+			err = claimUnlocs(owners, port)
+		}
+		if err == nil {
+			err = writePort(ctx, tx, port, report)
+		}
+		if err != nil {
+			reportFailure(ctx, report, unloc, offset, err.Error())
+			if opts.Lenient && isRecordError(err) {
+				continue
 			}
-			continue
+			return err
 		}
+	}
 
-		// if port already exists, let's update
-		err = l.repository.Update(ctx, port)
+	// the closing "}", missing when the input was cut
+	_, err := decoder.Token()
+	if err != nil {
+		return failRecord(ctx, report, "", decoder.InputOffset(), "failed to read the end of the input", err)
+	}
+
+	if opts.Mode == SyncModeReplace {
+		return deleteMissing(ctx, tx, seen, report)
+	}
+	return nil
+}
+
+// writePort creates or updates the port, counting the outcome on the report
+func writePort(ctx context.Context, tx storage.PortTransaction, port models.Port, report *models.SyncReport) error {
+	// checking if port/unloc exists on database
+	stored, err := tx.Get(ctx, port.Unloc)
+	if err != nil && !errors.Is(err, localErrs.ErrNotFound) {
+		return repositoryError(ctx, "unexpected error when retrieving port info from database", err, "unloc", port.Unloc)
+	}
+
+	// if port doesn't exist, let's create!
+	if errors.Is(err, localErrs.ErrNotFound) {
+		err = tx.Create(ctx, port)
+		if errors.Is(err, localErrs.ErrConflict) {
+			return err
+		}
 		if err != nil {
-			return errors.Wrap(localErrs.ErrInternalServerError, fmt.Sprintf("failed to update port [%+v] on storage: %+v", port, err))
+			return repositoryError(ctx, "failed to create port on storage", err, "unloc", port.Unloc)
 		}
+		report.Created++
+		return nil
+	}
+
+	// if port already exists with the same data, there is nothing to write
+	if stored.Equal(port) {
+		report.Unchanged++
+		return nil
 	}
 
+	// if port already exists, let's update
+	err = tx.Update(ctx, port)
+	if errors.Is(err, localErrs.ErrConflict) {
+		return err
+	}
+	if err != nil {
+		return repositoryError(ctx, "failed to update port on storage", err, "unloc", port.Unloc)
+	}
+	report.Updated++
 	return nil
 }
+
+// isRecordError reports whether the error is caused by the record itself,
+// so lenient syncs can skip it
+func isRecordError(err error) bool {
+	return errors.Is(err, localErrs.ErrUnprocessableEntity) || errors.Is(err, localErrs.ErrConflict)
+}
+
+// canonicalPort makes the unloc the port is keyed by on the input its
+// canonical unloc, placing it first on its unlocs
+func canonicalPort(unloc string, port models.Port) models.Port {
+	unlocs := make([]string, 0, len(port.Unlocs)+1)
+	unlocs = append(unlocs, unloc)
+	for _, other := range port.Unlocs {
+		if other != unloc {
+			unlocs = append(unlocs, other)
+		}
+	}
+	port.Unloc = unloc
+	port.Unlocs = unlocs
+	return port
+}
+
+// claimUnlocs records the port as the owner of its unlocs, failing when one
+// of them already belongs to another record of the input
+func claimUnlocs(owners map[string]string, port models.Port) error {
+	for _, unloc := range port.Unlocs {
+		if owner, exists := owners[unloc]; exists && owner != port.Unloc {
+			return localErrs.New(localErrs.CodeConflict, fmt.Sprintf("unloc %s belongs to both %s and %s", unloc, owner, port.Unloc))
+		}
+	}
+	for _, unloc := range port.Unlocs {
+		owners[unloc] = port.Unloc
+	}
+	return nil
+}
+
+// failRecord reports the failure of the record found at the input offset,
+// returning it as the failure of the whole input
+func failRecord(ctx context.Context, report *models.SyncReport, unloc string, offset int64, message string, err error) error {
+	reportFailure(ctx, report, unloc, offset, fmt.Sprintf("%s: %v", message, err))
+	return inputError(message, err)
+}
+
+// inputError returns the failure to read the input as a bad request, or as a
+// payload too large when the input was cut at the body limit
+func inputError(message string, err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return localErrs.New(localErrs.CodePayloadTooLarge, fmt.Sprintf("input must not be larger than %d bytes", maxBytesErr.Limit))
+	}
+	return errors.Wrap(localErrs.ErrBadRequest, fmt.Sprintf("%s: %v", message, err))
+}
+
+// reportFailure counts the failure of the record on the report and logs it
+func reportFailure(ctx context.Context, report *models.SyncReport, unloc string, offset int64, message string) {
+	logging.FromContext(ctx).Warn("sync record failed", "unloc", unloc, "offset", offset, "error", message)
+	report.Failed++
+	report.Errors = append(report.Errors, models.SyncError{Unloc: unloc, Offset: offset, Message: message})
+}
+
+// deleteMissing removes every stored port without any of its unlocs in seen
+func deleteMissing(ctx context.Context, tx storage.PortTransaction, seen map[string]struct{}, report *models.SyncReport) error {
+	page, err := tx.List(ctx, models.PortFilter{})
+	if err != nil {
+		return repositoryError(ctx, "failed to list ports from storage", err)
+	}
+
+	for _, port := range page.Ports {
+		if containsAny(seen, port.Unlocs) {
+			continue
+		}
+		err = tx.Delete(ctx, port.Unlocs[0])
+		if err != nil && !errors.Is(err, localErrs.ErrNotFound) {
+			reportFailure(ctx, report, port.Unlocs[0], 0, fmt.Sprintf("failed to delete port from storage: %+v", err))
+			return repositoryError(ctx, "failed to delete port from storage", err, "unloc", port.Unlocs[0])
+		}
+		report.Deleted++
+	}
+	return nil
+}
+
+func containsAny(set map[string]struct{}, values []string) bool {
+	for _, value := range values {
+		if _, exists := set[value]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+// repositoryError logs the unexpected error returned by the storage along with
+// the attributes, returning it as an internal error
+func repositoryError(ctx context.Context, message string, err error, attrs ...interface{}) error {
+	logging.FromContext(ctx).Error(message, append(attrs, "error", err.Error())...)
+	return errors.Wrap(localErrs.ErrInternalServerError, fmt.Sprintf("%s: %+v", message, err))
+}
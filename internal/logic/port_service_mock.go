@@ -8,6 +8,7 @@ import (
 	context "context"
 	io "io"
 	reflect "reflect"
+	time "time"
 
 	models "github.com/WendelHime/ports/internal/shared/models"
 	gomock "github.com/golang/mock/gomock"
@@ -36,6 +37,35 @@ func (m *MockPortDomainService) EXPECT() *MockPortDomainServiceMockRecorder {
 	return m.recorder
 }
 
+// DeletePort mocks base method.
+func (m *MockPortDomainService) DeletePort(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeletePort", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeletePort indicates an expected call of DeletePort.
+func (mr *MockPortDomainServiceMockRecorder) DeletePort(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePort", reflect.TypeOf((*MockPortDomainService)(nil).DeletePort), arg0, arg1)
+}
+
+// ExportPorts mocks base method.
+func (m *MockPortDomainService) ExportPorts(arg0 context.Context, arg1 time.Time) ([]models.Port, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportPorts", arg0, arg1)
+	ret0, _ := ret[0].([]models.Port)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExportPorts indicates an expected call of ExportPorts.
+func (mr *MockPortDomainServiceMockRecorder) ExportPorts(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportPorts", reflect.TypeOf((*MockPortDomainService)(nil).ExportPorts), arg0, arg1)
+}
+
 // GetPort mocks base method.
 func (m *MockPortDomainService) GetPort(arg0 context.Context, arg1 string) (models.Port, error) {
 	m.ctrl.T.Helper()
@@ -51,16 +81,138 @@ func (mr *MockPortDomainServiceMockRecorder) GetPort(arg0, arg1 interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPort", reflect.TypeOf((*MockPortDomainService)(nil).GetPort), arg0, arg1)
 }
 
+// GetPortAt mocks base method.
+func (m *MockPortDomainService) GetPortAt(arg0 context.Context, arg1 string, arg2 time.Time) (models.Port, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPortAt", arg0, arg1, arg2)
+	ret0, _ := ret[0].(models.Port)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPortAt indicates an expected call of GetPortAt.
+func (mr *MockPortDomainServiceMockRecorder) GetPortAt(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPortAt", reflect.TypeOf((*MockPortDomainService)(nil).GetPortAt), arg0, arg1, arg2)
+}
+
+// ListPorts mocks base method.
+func (m *MockPortDomainService) ListPorts(arg0 context.Context, arg1 models.PortFilter) (models.PortPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListPorts", arg0, arg1)
+	ret0, _ := ret[0].(models.PortPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListPorts indicates an expected call of ListPorts.
+func (mr *MockPortDomainServiceMockRecorder) ListPorts(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPorts", reflect.TypeOf((*MockPortDomainService)(nil).ListPorts), arg0, arg1)
+}
+
+// NearbyPorts mocks base method.
+func (m *MockPortDomainService) NearbyPorts(arg0 context.Context, arg1 models.NearbyQuery) ([]models.PortDistance, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NearbyPorts", arg0, arg1)
+	ret0, _ := ret[0].([]models.PortDistance)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NearbyPorts indicates an expected call of NearbyPorts.
+func (mr *MockPortDomainServiceMockRecorder) NearbyPorts(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NearbyPorts", reflect.TypeOf((*MockPortDomainService)(nil).NearbyPorts), arg0, arg1)
+}
+
+// PatchPort mocks base method.
+func (m *MockPortDomainService) PatchPort(arg0 context.Context, arg1 string, arg2 []byte, arg3 int64) (models.Port, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PatchPort", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(models.Port)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PatchPort indicates an expected call of PatchPort.
+func (mr *MockPortDomainServiceMockRecorder) PatchPort(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PatchPort", reflect.TypeOf((*MockPortDomainService)(nil).PatchPort), arg0, arg1, arg2, arg3)
+}
+
+// PortHistory mocks base method.
+func (m *MockPortDomainService) PortHistory(arg0 context.Context, arg1 string) ([]models.AuditEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PortHistory", arg0, arg1)
+	ret0, _ := ret[0].([]models.AuditEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PortHistory indicates an expected call of PortHistory.
+func (mr *MockPortDomainServiceMockRecorder) PortHistory(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PortHistory", reflect.TypeOf((*MockPortDomainService)(nil).PortHistory), arg0, arg1)
+}
+
+// PortsWithin mocks base method.
+func (m *MockPortDomainService) PortsWithin(arg0 context.Context, arg1 models.BoundingBox, arg2 int) ([]models.Port, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PortsWithin", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]models.Port)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PortsWithin indicates an expected call of PortsWithin.
+func (mr *MockPortDomainServiceMockRecorder) PortsWithin(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PortsWithin", reflect.TypeOf((*MockPortDomainService)(nil).PortsWithin), arg0, arg1, arg2)
+}
+
+// PutPort mocks base method.
+func (m *MockPortDomainService) PutPort(arg0 context.Context, arg1 string, arg2 models.Port) (models.Port, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutPort", arg0, arg1, arg2)
+	ret0, _ := ret[0].(models.Port)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// PutPort indicates an expected call of PutPort.
+func (mr *MockPortDomainServiceMockRecorder) PutPort(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutPort", reflect.TypeOf((*MockPortDomainService)(nil).PutPort), arg0, arg1, arg2)
+}
+
+// SearchPorts mocks base method.
+func (m *MockPortDomainService) SearchPorts(arg0 context.Context, arg1 string, arg2 int) ([]models.PortMatch, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchPorts", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]models.PortMatch)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchPorts indicates an expected call of SearchPorts.
+func (mr *MockPortDomainServiceMockRecorder) SearchPorts(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchPorts", reflect.TypeOf((*MockPortDomainService)(nil).SearchPorts), arg0, arg1, arg2)
+}
+
 // SyncPorts mocks base method.
-func (m *MockPortDomainService) SyncPorts(arg0 context.Context, arg1 io.Reader) error {
+func (m *MockPortDomainService) SyncPorts(arg0 context.Context, arg1 io.Reader, arg2 SyncOptions) (models.SyncReport, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SyncPorts", arg0, arg1)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "SyncPorts", arg0, arg1, arg2)
+	ret0, _ := ret[0].(models.SyncReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // SyncPorts indicates an expected call of SyncPorts.
-func (mr *MockPortDomainServiceMockRecorder) SyncPorts(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockPortDomainServiceMockRecorder) SyncPorts(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SyncPorts", reflect.TypeOf((*MockPortDomainService)(nil).SyncPorts), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SyncPorts", reflect.TypeOf((*MockPortDomainService)(nil).SyncPorts), arg0, arg1, arg2)
 }
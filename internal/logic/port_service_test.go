@@ -1,17 +1,25 @@
 package logic
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/WendelHime/ports/internal/logging"
 	localErrs "github.com/WendelHime/ports/internal/shared/errors"
 	"github.com/WendelHime/ports/internal/shared/models"
 	"github.com/WendelHime/ports/internal/storage"
 	gomock "github.com/golang/mock/gomock"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSyncPorts(t *testing.T) {
@@ -30,7 +38,7 @@ func TestSyncPorts(t *testing.T) {
 				ctrl := gomock.NewController(t)
 				portRepo := storage.NewMockPortRepository(ctrl)
 
-				return strings.NewReader(""), NewPortDomainService(portRepo)
+				return strings.NewReader(""), NewPortDomainService(portRepo, nil)
 			},
 		},
 		{
@@ -42,31 +50,84 @@ func TestSyncPorts(t *testing.T) {
 				ctrl := gomock.NewController(t)
 				portRepo := storage.NewMockPortRepository(ctrl)
 
-				return strings.NewReader("test"), NewPortDomainService(portRepo)
+				return strings.NewReader("test"), NewPortDomainService(portRepo, nil)
 			},
 		},
 		{
-			name: "invalid unloc should return a internal server error",
+			name: "invalid unloc should return a bad request",
 			assert: func(t *testing.T, err error) {
-				assert.ErrorIs(t, err, localErrs.ErrInternalServerError)
+				assert.ErrorIs(t, err, localErrs.ErrBadRequest)
 			},
 			setup: func(t *testing.T) (io.Reader, PortDomainService) {
 				ctrl := gomock.NewController(t)
 				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Rollback(gomock.Any()).Return(nil).Times(1)
 
-				return strings.NewReader("{1: {}}"), NewPortDomainService(portRepo)
+				return strings.NewReader("{1: {}}"), NewPortDomainService(portRepo, nil)
 			},
 		},
 		{
-			name: "invalid object to decode should return an internal server error",
+			name: "invalid object to decode should return an unprocessable entity",
 			assert: func(t *testing.T, err error) {
-				assert.ErrorIs(t, err, localErrs.ErrInternalServerError)
+				assert.ErrorIs(t, err, localErrs.ErrUnprocessableEntity)
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Rollback(gomock.Any()).Return(nil).Times(1)
+
+				return strings.NewReader(`{"1": ""`), NewPortDomainService(portRepo, nil)
+			},
+		},
+		{
+			name: "input other than an object should return a bad request",
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrBadRequest)
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+
+				return strings.NewReader("[1]"), NewPortDomainService(portRepo, nil)
+			},
+		},
+		{
+			name: "truncated input should return a bad request",
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrBadRequest)
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), "AEAJM").Return(models.Port{}, localErrs.ErrNotFound).Times(1)
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+				tx.EXPECT().Rollback(gomock.Any()).Return(nil).Times(1)
+
+				return strings.NewReader(`{"AEAJM": {"name": "Ajman", "country": "AE", "unlocs": ["AEAJM"]}`), NewPortDomainService(portRepo, nil)
+			},
+		},
+		{
+			name: "input cut at the body limit should return a payload too large",
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrPayloadTooLarge)
 			},
 			setup: func(t *testing.T) (io.Reader, PortDomainService) {
 				ctrl := gomock.NewController(t)
 				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), gomock.Any()).Return(models.Port{}, localErrs.ErrNotFound).AnyTimes()
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+				tx.EXPECT().Rollback(gomock.Any()).Return(nil).Times(1)
 
-				return strings.NewReader(`{"1": ""`), NewPortDomainService(portRepo)
+				body := io.NopCloser(strings.NewReader(threeRandomPorts()))
+				return http.MaxBytesReader(httptest.NewRecorder(), body, 100), NewPortDomainService(portRepo, nil)
 			},
 		},
 		{
@@ -77,9 +138,12 @@ func TestSyncPorts(t *testing.T) {
 			setup: func(t *testing.T) (io.Reader, PortDomainService) {
 				ctrl := gomock.NewController(t)
 				portRepo := storage.NewMockPortRepository(ctrl)
-				portRepo.EXPECT().Get(gomock.Any(), gomock.Any()).Return(models.Port{}, errors.New("random error")).MaxTimes(1)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), gomock.Any()).Return(models.Port{}, errors.New("random error")).MaxTimes(1)
+				tx.EXPECT().Rollback(gomock.Any()).Return(nil).Times(1)
 
-				return strings.NewReader(threeRandomPorts()), NewPortDomainService(portRepo)
+				return strings.NewReader(threeRandomPorts()), NewPortDomainService(portRepo, nil)
 			},
 		},
 		{
@@ -90,10 +154,13 @@ func TestSyncPorts(t *testing.T) {
 			setup: func(t *testing.T) (io.Reader, PortDomainService) {
 				ctrl := gomock.NewController(t)
 				portRepo := storage.NewMockPortRepository(ctrl)
-				portRepo.EXPECT().Get(gomock.Any(), gomock.Any()).Return(models.Port{}, localErrs.ErrNotFound).MaxTimes(3)
-				portRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil).MaxTimes(3)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), gomock.Any()).Return(models.Port{}, localErrs.ErrNotFound).MaxTimes(3)
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil).MaxTimes(3)
+				tx.EXPECT().Commit(gomock.Any()).Return(nil).Times(1)
 
-				return strings.NewReader(threeRandomPorts()), NewPortDomainService(portRepo)
+				return strings.NewReader(threeRandomPorts()), NewPortDomainService(portRepo, nil)
 			},
 		},
 		{
@@ -104,10 +171,13 @@ func TestSyncPorts(t *testing.T) {
 			setup: func(t *testing.T) (io.Reader, PortDomainService) {
 				ctrl := gomock.NewController(t)
 				portRepo := storage.NewMockPortRepository(ctrl)
-				portRepo.EXPECT().Get(gomock.Any(), gomock.Any()).Return(models.Port{}, localErrs.ErrNotFound).MaxTimes(3)
-				portRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(errors.New("random error")).MaxTimes(1)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), gomock.Any()).Return(models.Port{}, localErrs.ErrNotFound).MaxTimes(3)
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).Return(errors.New("random error")).MaxTimes(1)
+				tx.EXPECT().Rollback(gomock.Any()).Return(nil).Times(1)
 
-				return strings.NewReader(threeRandomPorts()), NewPortDomainService(portRepo)
+				return strings.NewReader(threeRandomPorts()), NewPortDomainService(portRepo, nil)
 			},
 		},
 		{
@@ -118,67 +188,1276 @@ func TestSyncPorts(t *testing.T) {
 			setup: func(t *testing.T) (io.Reader, PortDomainService) {
 				ctrl := gomock.NewController(t)
 				portRepo := storage.NewMockPortRepository(ctrl)
-				portRepo.EXPECT().Get(gomock.Any(), gomock.Any()).Return(models.Port{}, nil).MaxTimes(3)
-				portRepo.EXPECT().Update(gomock.Any(), gomock.Any()).Return(errors.New("random error")).MaxTimes(1)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), gomock.Any()).Return(models.Port{}, nil).MaxTimes(3)
+				tx.EXPECT().Update(gomock.Any(), gomock.Any()).Return(errors.New("random error")).MaxTimes(1)
+				tx.EXPECT().Rollback(gomock.Any()).Return(nil).Times(1)
+
+				return strings.NewReader(threeRandomPorts()), NewPortDomainService(portRepo, nil)
+			},
+		},
+		{
+			name: "malformed record after valid ports should rollback the synced ports",
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrUnprocessableEntity)
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), "AEAJM").Return(models.Port{}, localErrs.ErrNotFound).Times(1)
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+				tx.EXPECT().Rollback(gomock.Any()).Return(nil).Times(1)
+
+				return strings.NewReader(`{"AEAJM": {"name": "Ajman", "country": "AE", "unlocs": ["AEAJM"]}, "AEAUH": {"name": 1}}`), NewPortDomainService(portRepo, nil)
+			},
+		},
+		{
+			name: "invalid port should return an unprocessable entity",
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrUnprocessableEntity)
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Rollback(gomock.Any()).Return(nil).Times(1)
+
+				return strings.NewReader(`{"AEAJM": {"country": "Brazil", "unlocs": ["AEAJM"]}}`), NewPortDomainService(portRepo, nil)
+			},
+		},
+		{
+			name: "unloc belonging to another stored port should return a conflict",
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrConflict)
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), gomock.Any()).Return(models.Port{}, localErrs.ErrNotFound).Times(1)
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).Return(localErrs.New(localErrs.CodeConflict, "unloc AEAUH already belongs to the port AEDXB")).Times(1)
+				tx.EXPECT().Rollback(gomock.Any()).Return(nil).Times(1)
+
+				return strings.NewReader(threeRandomPorts()), NewPortDomainService(portRepo, nil)
+			},
+		},
+		{
+			name: "failure to begin transaction should return an internal server error",
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrInternalServerError)
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(nil, errors.New("random error")).Times(1)
+
+				return strings.NewReader(threeRandomPorts()), NewPortDomainService(portRepo, nil)
+			},
+		},
+		{
+			name: "failure to commit transaction should return an internal server error",
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrInternalServerError)
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), gomock.Any()).Return(models.Port{}, localErrs.ErrNotFound).Times(3)
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil).Times(3)
+				tx.EXPECT().Commit(gomock.Any()).Return(errors.New("random error")).Times(1)
+
+				return strings.NewReader(threeRandomPorts()), NewPortDomainService(portRepo, nil)
+			},
+		},
+		{
+			name: "commit after a concurrent write to the synced ports should return a precondition failure",
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrPreconditionFailed)
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), gomock.Any()).Return(models.Port{}, localErrs.ErrNotFound).Times(3)
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil).Times(3)
+				tx.EXPECT().Commit(gomock.Any()).Return(localErrs.New(localErrs.CodePreconditionFailed, "port AEAJM was written since the transaction read it")).Times(1)
 
-				return strings.NewReader(threeRandomPorts()), NewPortDomainService(portRepo)
+				return strings.NewReader(threeRandomPorts()), NewPortDomainService(portRepo, nil)
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			input, service := tt.setup(t)
-			err := service.SyncPorts(ctx, input)
+			_, err := service.SyncPorts(ctx, input, SyncOptions{})
 			tt.assert(t, err)
 		})
 	}
 }
 
-func TestGetPort(t *testing.T) {
+func TestSyncPortsReport(t *testing.T) {
 	ctx := context.Background()
 	var tests = []struct {
-		name       string
-		assert     func(t *testing.T, port models.Port, err error)
-		setup      func(t *testing.T) PortDomainService
-		givenUnloc string
+		name   string
+		assert func(t *testing.T, report models.SyncReport, err error)
+		setup  func(t *testing.T) (io.Reader, PortDomainService)
 	}{
 		{
-			name: "get port with success should return no error",
-			assert: func(t *testing.T, port models.Port, err error) {
+			name: "ports equal to the stored ones should be counted as unchanged",
+			assert: func(t *testing.T, report models.SyncReport, err error) {
 				assert.Nil(t, err)
-				expectedPort := models.Port{Unlocs: []string{"UNLOC"}}
-				assert.Equal(t, expectedPort, port)
+				report.DurationMs = 0
+				assert.Equal(t, models.SyncReport{Created: 1, Updated: 1, Unchanged: 1}, report)
 			},
-			setup: func(t *testing.T) PortDomainService {
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
 				ctrl := gomock.NewController(t)
 				portRepo := storage.NewMockPortRepository(ctrl)
-				portRepo.EXPECT().Get(gomock.Any(), gomock.Any()).Return(models.Port{Unlocs: []string{"UNLOC"}}, nil).MaxTimes(1)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), "AEAJM").Return(models.Port{
+					Unloc:       "AEAJM",
+					Name:        "Ajman",
+					City:        "Ajman",
+					Country:     "United Arab Emirates",
+					Alias:       []string{},
+					Regions:     []string{},
+					Coordinates: []decimal.Decimal{decimal.RequireFromString("55.5136433"), decimal.RequireFromString("25.4052165")},
+					Province:    "Ajman",
+					Timezone:    "Asia/Dubai",
+					Unlocs:      []string{"AEAJM"},
+					Code:        "52000",
+				}, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), "AEAUH").Return(models.Port{Name: "Abu Dhabi"}, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), "AEDXB").Return(models.Port{}, localErrs.ErrNotFound).Times(1)
+				tx.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+				tx.EXPECT().Commit(gomock.Any()).Return(nil).Times(1)
 
-				service := NewPortDomainService(portRepo)
-				return service
+				return strings.NewReader(threeRandomPorts()), NewPortDomainService(portRepo, nil)
 			},
-			givenUnloc: "UNLOC",
 		},
 		{
-			name: "get port with invalid unloc should return bad request error",
-			assert: func(t *testing.T, _ models.Port, err error) {
+			name: "failed record should be reported without any write",
+			assert: func(t *testing.T, report models.SyncReport, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrInternalServerError)
+				assert.Equal(t, 0, report.Created)
+				assert.Equal(t, 1, report.Failed)
+				if assert.Len(t, report.Errors, 1) {
+					assert.Equal(t, "AEAUH", report.Errors[0].Unloc)
+					assert.Contains(t, report.Errors[0].Message, "failed to create port")
+				}
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), gomock.Any()).Return(models.Port{}, localErrs.ErrNotFound).Times(2)
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).Return(errors.New("random error")).Times(1)
+				tx.EXPECT().Rollback(gomock.Any()).Return(nil).Times(1)
+
+				return strings.NewReader(threeRandomPorts()), NewPortDomainService(portRepo, nil)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, service := tt.setup(t)
+			report, err := service.SyncPorts(ctx, input, SyncOptions{})
+			tt.assert(t, report, err)
+		})
+	}
+}
+
+func TestSyncPortsLenientMode(t *testing.T) {
+	ctx := context.Background()
+	var tests = []struct {
+		name   string
+		assert func(t *testing.T, report models.SyncReport, err error)
+		setup  func(t *testing.T) (io.Reader, PortDomainService)
+	}{
+		{
+			name: "records that can't be decoded should be skipped",
+			assert: func(t *testing.T, report models.SyncReport, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 2, report.Created)
+				assert.Equal(t, 1, report.Failed)
+				if assert.Len(t, report.Errors, 1) {
+					assert.Equal(t, "AEAUH", report.Errors[0].Unloc)
+					assert.Equal(t, int64(59), report.Errors[0].Offset)
+					assert.Contains(t, report.Errors[0].Message, "failed to decode port")
+				}
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), gomock.Any()).Return(models.Port{}, localErrs.ErrNotFound).Times(2)
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+				tx.EXPECT().Commit(gomock.Any()).Return(nil).Times(1)
+
+				input := `{"AEAJM": {"country": "AE", "unlocs": ["AEAJM"]}, "AEAUH": {"name": 1}, "AEDXB": {"country": "AE", "unlocs": ["AEDXB"]}}`
+				return strings.NewReader(input), NewPortDomainService(portRepo, nil)
+			},
+		},
+		{
+			name: "invalid records should be skipped",
+			assert: func(t *testing.T, report models.SyncReport, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 1, report.Created)
+				assert.Equal(t, 1, report.Failed)
+				if assert.Len(t, report.Errors, 1) {
+					assert.Equal(t, "AEAUH", report.Errors[0].Unloc)
+					assert.Contains(t, report.Errors[0].Message, "country")
+				}
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), "AEAJM").Return(models.Port{}, localErrs.ErrNotFound).Times(1)
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+				tx.EXPECT().Commit(gomock.Any()).Return(nil).Times(1)
+
+				input := `{"AEAJM": {"country": "AE", "unlocs": ["AEAJM"]}, "AEAUH": {"country": "Brazil", "unlocs": ["AEAUH"]}}`
+				return strings.NewReader(input), NewPortDomainService(portRepo, nil)
+			},
+		},
+		{
+			name: "records conflicting with stored ports should be skipped",
+			assert: func(t *testing.T, report models.SyncReport, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 2, report.Created)
+				assert.Equal(t, 1, report.Failed)
+				if assert.Len(t, report.Errors, 1) {
+					assert.Equal(t, "AEAUH", report.Errors[0].Unloc)
+				}
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), gomock.Any()).Return(models.Port{}, localErrs.ErrNotFound).Times(3)
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, port models.Port) error {
+					if port.Unloc == "AEAUH" {
+						return localErrs.New(localErrs.CodeConflict, "unloc AEAUH already belongs to the port AEDXB")
+					}
+					return nil
+				}).Times(3)
+				tx.EXPECT().Commit(gomock.Any()).Return(nil).Times(1)
+
+				return strings.NewReader(threeRandomPorts()), NewPortDomainService(portRepo, nil)
+			},
+		},
+		{
+			name: "malformed input should still abort the sync",
+			assert: func(t *testing.T, report models.SyncReport, err error) {
 				assert.ErrorIs(t, err, localErrs.ErrBadRequest)
+				assert.Equal(t, 0, report.Created)
+				assert.Equal(t, 1, report.Failed)
 			},
-			setup: func(t *testing.T) PortDomainService {
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
 				ctrl := gomock.NewController(t)
 				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), gomock.Any()).Return(models.Port{}, localErrs.ErrNotFound).Times(1)
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+				tx.EXPECT().Rollback(gomock.Any()).Return(nil).Times(1)
 
-				service := NewPortDomainService(portRepo)
-				return service
+				input := `{"AEAJM": {"country": "AE", "unlocs": ["AEAJM"]}, "AEAUH": {"name": }}`
+				return strings.NewReader(input), NewPortDomainService(portRepo, nil)
 			},
-			givenUnloc: "",
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			service := tt.setup(t)
-			port, err := service.GetPort(ctx, tt.givenUnloc)
-			tt.assert(t, port, err)
+			input, service := tt.setup(t)
+			report, err := service.SyncPorts(ctx, input, SyncOptions{Lenient: true})
+			tt.assert(t, report, err)
+		})
+	}
+}
+
+func TestSyncPortsCanonicalUnloc(t *testing.T) {
+	ctx := context.Background()
+	var tests = []struct {
+		name   string
+		opts   SyncOptions
+		assert func(t *testing.T, report models.SyncReport, err error)
+		setup  func(t *testing.T) (io.Reader, PortDomainService)
+	}{
+		{
+			name: "key should be merged into the unlocs as the canonical unloc",
+			assert: func(t *testing.T, report models.SyncReport, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 1, report.Created)
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), "BRSSZ").Return(models.Port{}, localErrs.ErrNotFound).Times(1)
+				tx.EXPECT().Create(gomock.Any(), models.Port{
+					Unloc:   "BRSSZ",
+					Country: "Brazil",
+					Unlocs:  []string{"BRSSZ", "BRSTS"},
+				}).Return(nil).Times(1)
+				tx.EXPECT().Commit(gomock.Any()).Return(nil).Times(1)
+
+				return strings.NewReader(`{"BRSSZ": {"country": "Brazil", "unlocs": ["BRSTS"]}}`), NewPortDomainService(portRepo, nil)
+			},
+		},
+		{
+			name: "unloc claimed by two records should return a conflict",
+			assert: func(t *testing.T, report models.SyncReport, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrConflict)
+				assert.Equal(t, 1, report.Failed)
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), "BRSSZ").Return(models.Port{}, localErrs.ErrNotFound).Times(1)
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+				tx.EXPECT().Rollback(gomock.Any()).Return(nil).Times(1)
+
+				input := `{"BRSSZ": {"country": "Brazil", "unlocs": ["BRSTS"]}, "BRSTS": {"country": "Brazil"}}`
+				return strings.NewReader(input), NewPortDomainService(portRepo, nil)
+			},
+		},
+		{
+			name: "conflicting record should be skipped on lenient mode",
+			opts: SyncOptions{Lenient: true},
+			assert: func(t *testing.T, report models.SyncReport, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 1, report.Created)
+				if assert.Len(t, report.Errors, 1) {
+					assert.Equal(t, "BRSTS", report.Errors[0].Unloc)
+					assert.Contains(t, report.Errors[0].Message, "unloc BRSTS belongs to both BRSSZ and BRSTS")
+				}
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), "BRSSZ").Return(models.Port{}, localErrs.ErrNotFound).Times(1)
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+				tx.EXPECT().Commit(gomock.Any()).Return(nil).Times(1)
+
+				input := `{"BRSSZ": {"country": "Brazil", "unlocs": ["BRSTS"]}, "BRSTS": {"country": "Brazil"}}`
+				return strings.NewReader(input), NewPortDomainService(portRepo, nil)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, service := tt.setup(t)
+			report, err := service.SyncPorts(ctx, input, tt.opts)
+			tt.assert(t, report, err)
+		})
+	}
+}
+
+func TestSyncPortsReplaceMode(t *testing.T) {
+	ctx := context.Background()
+	var tests = []struct {
+		name   string
+		assert func(t *testing.T, report models.SyncReport, err error)
+		setup  func(t *testing.T) (io.Reader, PortDomainService)
+	}{
+		{
+			name: "ports missing from the input should be deleted",
+			assert: func(t *testing.T, report models.SyncReport, err error) {
+				assert.Nil(t, err)
+				report.DurationMs = 0
+				assert.Equal(t, models.SyncReport{Created: 2, Updated: 1, Deleted: 1}, report)
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), "AEAJM").Return(models.Port{}, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), gomock.Any()).Return(models.Port{}, localErrs.ErrNotFound).Times(2)
+				tx.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+				tx.EXPECT().List(gomock.Any(), models.PortFilter{}).Return(models.PortPage{Ports: []models.Port{
+					{Unlocs: []string{"AEAJM"}},
+					{Unlocs: []string{"AEAUH"}},
+					{Unlocs: []string{"AEDXB"}},
+					{Unlocs: []string{"BRSSZ"}},
+				}}, nil).Times(1)
+				tx.EXPECT().Delete(gomock.Any(), "BRSSZ").Return(nil).Times(1)
+				tx.EXPECT().Commit(gomock.Any()).Return(nil).Times(1)
+
+				return strings.NewReader(threeRandomPorts()), NewPortDomainService(portRepo, nil)
+			},
+		},
+		{
+			name: "failure to delete missing port should return an internal server error",
+			assert: func(t *testing.T, _ models.SyncReport, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrInternalServerError)
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), gomock.Any()).Return(models.Port{}, localErrs.ErrNotFound).Times(3)
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil).Times(3)
+				tx.EXPECT().List(gomock.Any(), models.PortFilter{}).Return(models.PortPage{Ports: []models.Port{
+					{Unlocs: []string{"BRSSZ"}},
+				}}, nil).Times(1)
+				tx.EXPECT().Delete(gomock.Any(), "BRSSZ").Return(errors.New("random error")).Times(1)
+				tx.EXPECT().Rollback(gomock.Any()).Return(nil).Times(1)
+
+				return strings.NewReader(threeRandomPorts()), NewPortDomainService(portRepo, nil)
+			},
+		},
+		{
+			name: "decode failure should not delete any port",
+			assert: func(t *testing.T, _ models.SyncReport, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrUnprocessableEntity)
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Rollback(gomock.Any()).Return(nil).Times(1)
+
+				return strings.NewReader(`{"1": ""`), NewPortDomainService(portRepo, nil)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, service := tt.setup(t)
+			report, err := service.SyncPorts(ctx, input, SyncOptions{Mode: SyncModeReplace})
+			tt.assert(t, report, err)
+		})
+	}
+}
+
+func TestSyncPortsLogging(t *testing.T) {
+	var tests = []struct {
+		name     string
+		opts     SyncOptions
+		expected []map[string]interface{}
+		setup    func(t *testing.T) (io.Reader, PortDomainService)
+	}{
+		{
+			name: "sync should be logged with its counts",
+			expected: []map[string]interface{}{
+				{"level": "INFO", "msg": "sync started", "mode": "upsert"},
+				{"level": "INFO", "msg": "sync finished", "mode": "upsert", "created": float64(1), "failed": float64(0)},
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), "AEAJM").Return(models.Port{}, localErrs.ErrNotFound).Times(1)
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+				tx.EXPECT().Commit(gomock.Any()).Return(nil).Times(1)
+
+				return strings.NewReader(`{"AEAJM": {"country": "AE", "unlocs": ["AEAJM"]}}`), NewPortDomainService(portRepo, nil)
+			},
+		},
+		{
+			name: "skipped records should be logged as warnings",
+			opts: SyncOptions{Lenient: true},
+			expected: []map[string]interface{}{
+				{"level": "INFO", "msg": "sync started", "lenient": true},
+				{"level": "WARN", "msg": "sync record failed", "unloc": "AEAUH", "offset": float64(59)},
+				{"level": "INFO", "msg": "sync finished", "created": float64(1), "failed": float64(1)},
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), "AEAJM").Return(models.Port{}, localErrs.ErrNotFound).Times(1)
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+				tx.EXPECT().Commit(gomock.Any()).Return(nil).Times(1)
+
+				input := `{"AEAJM": {"country": "AE", "unlocs": ["AEAJM"]}, "AEAUH": {"name": 1}}`
+				return strings.NewReader(input), NewPortDomainService(portRepo, nil)
+			},
+		},
+		{
+			name: "repository errors should be logged as errors",
+			expected: []map[string]interface{}{
+				{"level": "INFO", "msg": "sync started"},
+				{"level": "ERROR", "msg": "failed to create port on storage", "unloc": "AEAJM", "error": "storage is down"},
+				{"level": "WARN", "msg": "sync record failed", "unloc": "AEAJM"},
+				{"level": "ERROR", "msg": "sync failed", "failed": float64(1)},
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				tx := storage.NewMockPortTransaction(ctrl)
+				portRepo.EXPECT().Begin(gomock.Any()).Return(tx, nil).Times(1)
+				tx.EXPECT().Get(gomock.Any(), "AEAJM").Return(models.Port{}, localErrs.ErrNotFound).Times(1)
+				tx.EXPECT().Create(gomock.Any(), gomock.Any()).Return(errors.New("storage is down")).Times(1)
+				tx.EXPECT().Rollback(gomock.Any()).Return(nil).Times(1)
+
+				return strings.NewReader(`{"AEAJM": {"country": "AE", "unlocs": ["AEAJM"]}}`), NewPortDomainService(portRepo, nil)
+			},
+		},
+		{
+			name: "invalid input should be logged as a warning",
+			expected: []map[string]interface{}{
+				{"level": "INFO", "msg": "sync started"},
+				{"level": "WARN", "msg": "sync failed"},
+			},
+			setup: func(t *testing.T) (io.Reader, PortDomainService) {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+
+				return strings.NewReader("test"), NewPortDomainService(portRepo, nil)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := new(bytes.Buffer)
+			logger, err := logging.New(logs, logging.FormatJSON, "debug")
+			require.NoError(t, err)
+			ctx := logging.WithLogger(context.Background(), logger)
+
+			input, service := tt.setup(t)
+			_, _ = service.SyncPorts(ctx, input, tt.opts)
+
+			var records []map[string]interface{}
+			decoder := json.NewDecoder(logs)
+			for decoder.More() {
+				var record map[string]interface{}
+				require.NoError(t, decoder.Decode(&record))
+				records = append(records, record)
+			}
+			require.Len(t, records, len(tt.expected))
+			for i, expected := range tt.expected {
+				for key, value := range expected {
+					assert.Equal(t, value, records[i][key], "record %d key %s", i, key)
+				}
+			}
+		})
+	}
+}
+
+func TestGetPort(t *testing.T) {
+	ctx := context.Background()
+	var tests = []struct {
+		name       string
+		assert     func(t *testing.T, port models.Port, err error)
+		setup      func(t *testing.T) PortDomainService
+		givenUnloc string
+	}{
+		{
+			name: "get port with success should return no error",
+			assert: func(t *testing.T, port models.Port, err error) {
+				assert.Nil(t, err)
+				expectedPort := models.Port{Unlocs: []string{"UNLOC"}}
+				assert.Equal(t, expectedPort, port)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				portRepo.EXPECT().Get(gomock.Any(), gomock.Any()).Return(models.Port{Unlocs: []string{"UNLOC"}}, nil).MaxTimes(1)
+
+				service := NewPortDomainService(portRepo, nil)
+				return service
+			},
+			givenUnloc: "UNLOC",
+		},
+		{
+			name: "get port with invalid unloc should return bad request error",
+			assert: func(t *testing.T, _ models.Port, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrBadRequest)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+
+				service := NewPortDomainService(portRepo, nil)
+				return service
+			},
+			givenUnloc: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := tt.setup(t)
+			port, err := service.GetPort(ctx, tt.givenUnloc)
+			tt.assert(t, port, err)
+		})
+	}
+}
+
+func TestGetPortAt(t *testing.T) {
+	ctx := context.Background()
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var tests = []struct {
+		name       string
+		assert     func(t *testing.T, port models.Port, err error)
+		setup      func(t *testing.T) PortDomainService
+		givenUnloc string
+	}{
+		{
+			name: "get port at an instant should return it from the history",
+			assert: func(t *testing.T, port models.Port, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, models.Port{Unloc: "AEAJM", Version: 2}, port)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				history := storage.NewMockPortHistory(ctrl)
+				history.EXPECT().PortAt(gomock.Any(), "AEAJM", at).Return(models.Port{Unloc: "AEAJM", Version: 2}, nil).Times(1)
+				return NewPortDomainService(storage.NewMockPortRepository(ctrl), history)
+			},
+			givenUnloc: "AEAJM",
+		},
+		{
+			name: "get port at an instant without history should return unprocessable entity error",
+			assert: func(t *testing.T, _ models.Port, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrUnprocessableEntity)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				return NewPortDomainService(storage.NewMockPortRepository(ctrl), nil)
+			},
+			givenUnloc: "AEAJM",
+		},
+		{
+			name: "get port at an instant with invalid unloc should return bad request error",
+			assert: func(t *testing.T, _ models.Port, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrBadRequest)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				return NewPortDomainService(storage.NewMockPortRepository(ctrl), storage.NewMockPortHistory(ctrl))
+			},
+			givenUnloc: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := tt.setup(t)
+			port, err := service.GetPortAt(ctx, tt.givenUnloc, at)
+			tt.assert(t, port, err)
+		})
+	}
+}
+
+func TestExportPorts(t *testing.T) {
+	ctx := context.Background()
+	var tests = []struct {
+		name    string
+		assert  func(t *testing.T, ports []models.Port, err error)
+		setup   func(t *testing.T) PortDomainService
+		givenAt time.Time
+	}{
+		{
+			name: "export without instant should return the current ports",
+			assert: func(t *testing.T, ports []models.Port, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, []models.Port{{Unloc: "AEAJM"}}, ports)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				portRepo.EXPECT().List(gomock.Any(), models.PortFilter{}).Return(models.PortPage{Ports: []models.Port{{Unloc: "AEAJM"}}}, nil).Times(1)
+				return NewPortDomainService(portRepo, storage.NewMockPortHistory(ctrl))
+			},
+		},
+		{
+			name: "export at an instant should return the ports from the history",
+			assert: func(t *testing.T, ports []models.Port, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, []models.Port{{Unloc: "AEAUH"}}, ports)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				history := storage.NewMockPortHistory(ctrl)
+				history.EXPECT().PortsAt(gomock.Any(), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)).Return([]models.Port{{Unloc: "AEAUH"}}, nil).Times(1)
+				return NewPortDomainService(storage.NewMockPortRepository(ctrl), history)
+			},
+			givenAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := tt.setup(t)
+			ports, err := service.ExportPorts(ctx, tt.givenAt)
+			tt.assert(t, ports, err)
+		})
+	}
+}
+
+func TestPutPort(t *testing.T) {
+	ctx := context.Background()
+	var tests = []struct {
+		name       string
+		assert     func(t *testing.T, port models.Port, created bool, err error)
+		setup      func(t *testing.T) PortDomainService
+		givenUnloc string
+		givenPort  models.Port
+	}{
+		{
+			name: "put unknown port should create it",
+			assert: func(t *testing.T, port models.Port, created bool, err error) {
+				assert.NoError(t, err)
+				assert.True(t, created)
+				assert.Equal(t, int64(1), port.Version)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				gomock.InOrder(
+					portRepo.EXPECT().Get(gomock.Any(), "BRSSZ").Return(models.Port{}, localErrs.ErrNotFound).Times(1),
+					portRepo.EXPECT().Create(gomock.Any(), models.Port{Unloc: "BRSSZ", Country: "Brazil", Unlocs: []string{"BRSSZ", "BRSTS"}}).Return(nil).Times(1),
+					portRepo.EXPECT().Get(gomock.Any(), "BRSSZ").Return(models.Port{Unloc: "BRSSZ", Version: 1}, nil).Times(1),
+				)
+				return NewPortDomainService(portRepo, nil)
+			},
+			givenUnloc: "BRSSZ",
+			givenPort:  models.Port{Country: "Brazil", Unlocs: []string{"BRSTS"}},
+		},
+		{
+			name: "put stored port should update it on the given version",
+			assert: func(t *testing.T, port models.Port, created bool, err error) {
+				assert.NoError(t, err)
+				assert.False(t, created)
+				assert.Equal(t, int64(3), port.Version)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				gomock.InOrder(
+					portRepo.EXPECT().Get(gomock.Any(), "BRSSZ").Return(models.Port{Unloc: "BRSSZ", Version: 2}, nil).Times(1),
+					portRepo.EXPECT().Update(gomock.Any(), models.Port{Unloc: "BRSSZ", Country: "BR", Unlocs: []string{"BRSSZ"}, Version: 2}).Return(nil).Times(1),
+					portRepo.EXPECT().Get(gomock.Any(), "BRSSZ").Return(models.Port{Unloc: "BRSSZ", Version: 3}, nil).Times(1),
+				)
+				return NewPortDomainService(portRepo, nil)
+			},
+			givenUnloc: "BRSSZ",
+			givenPort:  models.Port{Country: "BR", Version: 2},
+		},
+		{
+			name: "put stored port by a secondary unloc should keep its primary unloc",
+			assert: func(t *testing.T, port models.Port, created bool, err error) {
+				assert.NoError(t, err)
+				assert.False(t, created)
+				assert.Equal(t, "BRSSZ", port.Unloc)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				gomock.InOrder(
+					portRepo.EXPECT().Get(gomock.Any(), "BRSTS").Return(models.Port{Unloc: "BRSSZ", Unlocs: []string{"BRSSZ", "BRSTS"}, Version: 2}, nil).Times(1),
+					portRepo.EXPECT().Update(gomock.Any(), models.Port{Unloc: "BRSSZ", Country: "BR", Unlocs: []string{"BRSSZ", "BRSTS"}, Version: 2}).Return(nil).Times(1),
+					portRepo.EXPECT().Get(gomock.Any(), "BRSSZ").Return(models.Port{Unloc: "BRSSZ", Version: 3}, nil).Times(1),
+				)
+				return NewPortDomainService(portRepo, nil)
+			},
+			givenUnloc: "BRSTS",
+			givenPort:  models.Port{Country: "BR", Version: 2},
+		},
+		{
+			name: "put port on a stale version should return precondition failed error",
+			assert: func(t *testing.T, _ models.Port, _ bool, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrPreconditionFailed)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				portRepo.EXPECT().Get(gomock.Any(), "BRSSZ").Return(models.Port{Unloc: "BRSSZ", Version: 2}, nil).Times(1)
+				portRepo.EXPECT().Update(gomock.Any(), gomock.Any()).Return(localErrs.ErrPreconditionFailed).Times(1)
+				return NewPortDomainService(portRepo, nil)
+			},
+			givenUnloc: "BRSSZ",
+			givenPort:  models.Port{Country: "BR", Version: 1},
+		},
+		{
+			name: "put invalid port should return unprocessable entity error",
+			assert: func(t *testing.T, _ models.Port, _ bool, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrUnprocessableEntity)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				portRepo.EXPECT().Get(gomock.Any(), "BRSSZ").Return(models.Port{}, localErrs.ErrNotFound).Times(1)
+				return NewPortDomainService(portRepo, nil)
+			},
+			givenUnloc: "BRSSZ",
+			givenPort:  models.Port{Country: "Argentina"},
+		},
+		{
+			name: "put port with invalid unloc should return bad request error",
+			assert: func(t *testing.T, _ models.Port, _ bool, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrBadRequest)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				return NewPortDomainService(storage.NewMockPortRepository(ctrl), nil)
+			},
+			givenUnloc: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := tt.setup(t)
+			port, created, err := service.PutPort(ctx, tt.givenUnloc, tt.givenPort)
+			tt.assert(t, port, created, err)
+		})
+	}
+}
+
+func TestPatchPort(t *testing.T) {
+	ctx := context.Background()
+	storedPort := models.Port{Unloc: "BRSSZ", Name: "Santos", Country: "Brazil", Unlocs: []string{"BRSSZ", "BRSTS"}, Version: 2}
+	var tests = []struct {
+		name         string
+		assert       func(t *testing.T, port models.Port, err error)
+		setup        func(t *testing.T) PortDomainService
+		givenUnloc   string
+		givenPatch   string
+		givenVersion int64
+	}{
+		{
+			name: "patch port should update it on the read version",
+			assert: func(t *testing.T, port models.Port, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, int64(3), port.Version)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				gomock.InOrder(
+					portRepo.EXPECT().Get(gomock.Any(), "BRSTS").Return(storedPort, nil).Times(1),
+					portRepo.EXPECT().Update(gomock.Any(), models.Port{
+						Unloc: "BRSSZ", Name: "Santos", Country: "Brazil", Timezone: "America/Sao_Paulo", Unlocs: []string{"BRSSZ", "BRSTS"}, Version: 2,
+					}).Return(nil).Times(1),
+					portRepo.EXPECT().Get(gomock.Any(), "BRSSZ").Return(models.Port{Unloc: "BRSSZ", Version: 3}, nil).Times(1),
+				)
+				return NewPortDomainService(portRepo, nil)
+			},
+			givenUnloc: "BRSTS",
+			givenPatch: `{"timezone": "America/Sao_Paulo", "version": 9}`,
+		},
+		{
+			name: "unconditional patch should be retried on concurrent writes",
+			assert: func(t *testing.T, port models.Port, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, int64(4), port.Version)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				concurrentPort := storedPort
+				concurrentPort.Version = 3
+				gomock.InOrder(
+					portRepo.EXPECT().Get(gomock.Any(), "BRSSZ").Return(storedPort, nil).Times(1),
+					portRepo.EXPECT().Update(gomock.Any(), gomock.Any()).Return(localErrs.ErrPreconditionFailed).Times(1),
+					portRepo.EXPECT().Get(gomock.Any(), "BRSSZ").Return(concurrentPort, nil).Times(1),
+					portRepo.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil).Times(1),
+					portRepo.EXPECT().Get(gomock.Any(), "BRSSZ").Return(models.Port{Unloc: "BRSSZ", Version: 4}, nil).Times(1),
+				)
+				return NewPortDomainService(portRepo, nil)
+			},
+			givenUnloc: "BRSSZ",
+			givenPatch: `{"name": "Porto de Santos"}`,
+		},
+		{
+			name: "patch on a stale version should return precondition failed error",
+			assert: func(t *testing.T, _ models.Port, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrPreconditionFailed)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				portRepo.EXPECT().Get(gomock.Any(), "BRSSZ").Return(storedPort, nil).Times(1)
+				return NewPortDomainService(portRepo, nil)
+			},
+			givenUnloc:   "BRSSZ",
+			givenPatch:   `{"name": "Porto de Santos"}`,
+			givenVersion: 1,
+		},
+		{
+			name: "patch making the port invalid should return unprocessable entity error",
+			assert: func(t *testing.T, _ models.Port, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrUnprocessableEntity)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				portRepo.EXPECT().Get(gomock.Any(), "BRSSZ").Return(storedPort, nil).Times(1)
+				return NewPortDomainService(portRepo, nil)
+			},
+			givenUnloc: "BRSSZ",
+			givenPatch: `{"timezone": "Mars/Olympus_Mons"}`,
+		},
+		{
+			name: "patch unknown port should return not found error",
+			assert: func(t *testing.T, _ models.Port, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrNotFound)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				portRepo.EXPECT().Get(gomock.Any(), "BRSSZ").Return(models.Port{}, localErrs.ErrNotFound).Times(1)
+				return NewPortDomainService(portRepo, nil)
+			},
+			givenUnloc: "BRSSZ",
+			givenPatch: `{}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := tt.setup(t)
+			port, err := service.PatchPort(ctx, tt.givenUnloc, []byte(tt.givenPatch), tt.givenVersion)
+			tt.assert(t, port, err)
+		})
+	}
+}
+
+func TestDeletePort(t *testing.T) {
+	ctx := context.Background()
+	var tests = []struct {
+		name       string
+		assert     func(t *testing.T, err error)
+		setup      func(t *testing.T) PortDomainService
+		givenUnloc string
+	}{
+		{
+			name: "delete port with success should return no error",
+			assert: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				portRepo.EXPECT().Delete(gomock.Any(), "UNLOC").Return(nil).Times(1)
+
+				return NewPortDomainService(portRepo, nil)
+			},
+			givenUnloc: "UNLOC",
+		},
+		{
+			name: "delete unknown port should return not found error",
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrNotFound)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				portRepo.EXPECT().Delete(gomock.Any(), "UNLOC").Return(localErrs.ErrNotFound).Times(1)
+
+				return NewPortDomainService(portRepo, nil)
+			},
+			givenUnloc: "UNLOC",
+		},
+		{
+			name: "delete port with invalid unloc should return bad request error",
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrBadRequest)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				return NewPortDomainService(storage.NewMockPortRepository(ctrl), nil)
+			},
+			givenUnloc: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := tt.setup(t)
+			err := service.DeletePort(ctx, tt.givenUnloc)
+			tt.assert(t, err)
+		})
+	}
+}
+
+func TestPortHistory(t *testing.T) {
+	ctx := context.Background()
+	var tests = []struct {
+		name       string
+		assert     func(t *testing.T, entries []models.AuditEntry, err error)
+		setup      func(t *testing.T) PortDomainService
+		givenUnloc string
+	}{
+		{
+			name: "history should return the recorded entries",
+			assert: func(t *testing.T, entries []models.AuditEntry, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, []models.AuditEntry{{Unloc: "AEAJM", Action: models.AuditDeleted}}, entries)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				history := storage.NewMockPortHistory(ctrl)
+				history.EXPECT().History(gomock.Any(), "AEAJM").Return([]models.AuditEntry{{Unloc: "AEAJM", Action: models.AuditDeleted}}, nil).Times(1)
+				return NewPortDomainService(storage.NewMockPortRepository(ctrl), history)
+			},
+			givenUnloc: "AEAJM",
+		},
+		{
+			name: "port without recorded entries should have an empty history",
+			assert: func(t *testing.T, entries []models.AuditEntry, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, []models.AuditEntry{}, entries)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				portRepo.EXPECT().Get(gomock.Any(), "AEAJM").Return(models.Port{Unloc: "AEAJM"}, nil).Times(1)
+				history := storage.NewMockPortHistory(ctrl)
+				history.EXPECT().History(gomock.Any(), "AEAJM").Return([]models.AuditEntry{}, nil).Times(1)
+				return NewPortDomainService(portRepo, history)
+			},
+			givenUnloc: "AEAJM",
+		},
+		{
+			name: "unknown port should return not found error",
+			assert: func(t *testing.T, _ []models.AuditEntry, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrNotFound)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				portRepo.EXPECT().Get(gomock.Any(), "AEAJM").Return(models.Port{}, localErrs.ErrNotFound).Times(1)
+				history := storage.NewMockPortHistory(ctrl)
+				history.EXPECT().History(gomock.Any(), "AEAJM").Return([]models.AuditEntry{}, nil).Times(1)
+				return NewPortDomainService(portRepo, history)
+			},
+			givenUnloc: "AEAJM",
+		},
+		{
+			name: "history with invalid unloc should return bad request error",
+			assert: func(t *testing.T, _ []models.AuditEntry, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrBadRequest)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				return NewPortDomainService(storage.NewMockPortRepository(ctrl), storage.NewMockPortHistory(ctrl))
+			},
+			givenUnloc: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := tt.setup(t)
+			entries, err := service.PortHistory(ctx, tt.givenUnloc)
+			tt.assert(t, entries, err)
+		})
+	}
+}
+
+func TestListPorts(t *testing.T) {
+	ctx := context.Background()
+	var tests = []struct {
+		name        string
+		assert      func(t *testing.T, page models.PortPage, err error)
+		setup       func(t *testing.T) PortDomainService
+		givenFilter models.PortFilter
+	}{
+		{
+			name: "list ports without limit should use the default page size",
+			assert: func(t *testing.T, page models.PortPage, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, models.PortPage{Ports: []models.Port{{Unlocs: []string{"UNLOC"}}}}, page)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				portRepo.EXPECT().List(gomock.Any(), models.PortFilter{Country: "Brazil", Limit: DefaultPageSize}).
+					Return(models.PortPage{Ports: []models.Port{{Unlocs: []string{"UNLOC"}}}}, nil).Times(1)
+
+				return NewPortDomainService(portRepo, nil)
+			},
+			givenFilter: models.PortFilter{Country: "Brazil"},
+		},
+		{
+			name: "list ports with limit above maximum should return bad request error",
+			assert: func(t *testing.T, _ models.PortPage, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrBadRequest)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+
+				return NewPortDomainService(portRepo, nil)
+			},
+			givenFilter: models.PortFilter{Limit: MaxPageSize + 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := tt.setup(t)
+			page, err := service.ListPorts(ctx, tt.givenFilter)
+			tt.assert(t, page, err)
+		})
+	}
+}
+
+func TestNearbyPorts(t *testing.T) {
+	ctx := context.Background()
+	var tests = []struct {
+		name       string
+		assert     func(t *testing.T, ports []models.PortDistance, err error)
+		setup      func(t *testing.T) PortDomainService
+		givenQuery models.NearbyQuery
+	}{
+		{
+			name: "nearby ports with success should use the default page size",
+			assert: func(t *testing.T, ports []models.PortDistance, err error) {
+				assert.Nil(t, err)
+				assert.Len(t, ports, 1)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				portRepo.EXPECT().Nearby(gomock.Any(), models.NearbyQuery{Latitude: 25, Longitude: 55, RadiusKm: 10, Limit: DefaultPageSize}).
+					Return([]models.PortDistance{{DistanceKm: 1}}, nil).Times(1)
+
+				return NewPortDomainService(portRepo, nil)
+			},
+			givenQuery: models.NearbyQuery{Latitude: 25, Longitude: 55, RadiusKm: 10},
+		},
+		{
+			name: "nearby ports with invalid latitude should return bad request error",
+			assert: func(t *testing.T, _ []models.PortDistance, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrBadRequest)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				return NewPortDomainService(storage.NewMockPortRepository(ctrl), nil)
+			},
+			givenQuery: models.NearbyQuery{Latitude: 91, Longitude: 55, RadiusKm: 10},
+		},
+		{
+			name: "nearby ports without radius should return bad request error",
+			assert: func(t *testing.T, _ []models.PortDistance, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrBadRequest)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				return NewPortDomainService(storage.NewMockPortRepository(ctrl), nil)
+			},
+			givenQuery: models.NearbyQuery{Latitude: 25, Longitude: 55},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := tt.setup(t)
+			ports, err := service.NearbyPorts(ctx, tt.givenQuery)
+			tt.assert(t, ports, err)
+		})
+	}
+}
+
+func TestPortsWithin(t *testing.T) {
+	ctx := context.Background()
+	var tests = []struct {
+		name     string
+		assert   func(t *testing.T, ports []models.Port, err error)
+		setup    func(t *testing.T) PortDomainService
+		givenBox models.BoundingBox
+	}{
+		{
+			name: "ports within a box crossing the antimeridian should be returned",
+			assert: func(t *testing.T, ports []models.Port, err error) {
+				assert.Nil(t, err)
+				assert.Len(t, ports, 1)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				portRepo.EXPECT().Within(gomock.Any(), models.BoundingBox{MinLongitude: 170, MinLatitude: -20, MaxLongitude: -170, MaxLatitude: -10}, DefaultPageSize).
+					Return([]models.Port{{Unlocs: []string{"FJSUV"}}}, nil).Times(1)
+
+				return NewPortDomainService(portRepo, nil)
+			},
+			givenBox: models.BoundingBox{MinLongitude: 170, MinLatitude: -20, MaxLongitude: -170, MaxLatitude: -10},
+		},
+		{
+			name: "ports within an inverted latitude range should return bad request error",
+			assert: func(t *testing.T, _ []models.Port, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrBadRequest)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				return NewPortDomainService(storage.NewMockPortRepository(ctrl), nil)
+			},
+			givenBox: models.BoundingBox{MinLongitude: 0, MinLatitude: 10, MaxLongitude: 10, MaxLatitude: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := tt.setup(t)
+			ports, err := service.PortsWithin(ctx, tt.givenBox, 0)
+			tt.assert(t, ports, err)
+		})
+	}
+}
+
+func TestSearchPorts(t *testing.T) {
+	ctx := context.Background()
+	var tests = []struct {
+		name       string
+		assert     func(t *testing.T, ports []models.PortMatch, err error)
+		setup      func(t *testing.T) PortDomainService
+		givenQuery string
+	}{
+		{
+			name: "search ports with success should use the default page size",
+			assert: func(t *testing.T, ports []models.PortMatch, err error) {
+				assert.Nil(t, err)
+				assert.Len(t, ports, 1)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				portRepo := storage.NewMockPortRepository(ctrl)
+				portRepo.EXPECT().Search(gomock.Any(), "santos", DefaultPageSize).
+					Return([]models.PortMatch{{Port: models.Port{Name: "Santos"}, Score: 3}}, nil).Times(1)
+
+				return NewPortDomainService(portRepo, nil)
+			},
+			givenQuery: "santos",
+		},
+		{
+			name: "search ports with blank query should return bad request error",
+			assert: func(t *testing.T, _ []models.PortMatch, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrBadRequest)
+			},
+			setup: func(t *testing.T) PortDomainService {
+				ctrl := gomock.NewController(t)
+				return NewPortDomainService(storage.NewMockPortRepository(ctrl), nil)
+			},
+			givenQuery: "  ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := tt.setup(t)
+			ports, err := service.SearchPorts(ctx, tt.givenQuery, 0)
+			tt.assert(t, ports, err)
 		})
 	}
 }
@@ -0,0 +1,128 @@
+package logic
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	// embedding the time zone database, so time zones are validated the same
+	// way regardless of the host
+	_ "time/tzdata"
+
+	"github.com/shopspring/decimal"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/WendelHime/ports/internal/shared/models"
+)
+
+// unlocPattern matches a UN/LOCODE, the ISO 3166-1 country code followed by
+// three letters or digits from 2 to 9
+var unlocPattern = regexp.MustCompile(`^[A-Z]{2}[A-Z2-9]{3}$`)
+
+var (
+	minLongitude = decimal.NewFromInt(-180)
+	maxLongitude = decimal.NewFromInt(180)
+	minLatitude  = decimal.NewFromInt(-90)
+	maxLatitude  = decimal.NewFromInt(90)
+)
+
+// fieldErrors collects the invalid fields of an input
+type fieldErrors []localErrs.FieldError
+
+func (f *fieldErrors) add(field, message string) {
+	*f = append(*f, localErrs.FieldError{Field: field, Message: message})
+}
+
+// validatePort checks the port, returning an unprocessable entity error
+// detailing every invalid field
+func validatePort(port models.Port) error {
+	var verr fieldErrors
+
+	if len(port.Unlocs) == 0 {
+		verr.add("unlocs", "must not be empty")
+	}
+	found := false
+	for i, portUnloc := range port.Unlocs {
+		if !unlocPattern.MatchString(portUnloc) {
+			verr.add(fmt.Sprintf("unlocs[%d]", i), fmt.Sprintf("%q is not a valid UN/LOCODE", portUnloc))
+			continue
+		}
+		if _, exists := countryNames[portUnloc[:2]]; !exists {
+			verr.add(fmt.Sprintf("unlocs[%d]", i), fmt.Sprintf("%q has an unknown country code", portUnloc))
+		}
+		found = found || portUnloc == port.Unloc
+	}
+	if !unlocPattern.MatchString(port.Unloc) {
+		verr.add("unloc", fmt.Sprintf("%q is not a valid UN/LOCODE", port.Unloc))
+	} else if len(port.Unlocs) > 0 && !found {
+		verr.add("unlocs", fmt.Sprintf("must contain the unloc %q", port.Unloc))
+	}
+
+	if port.Country == "" {
+		verr.add("country", "must not be empty")
+	} else if unlocPattern.MatchString(port.Unloc) && !matchesCountry(port.Unloc[:2], port.Country) {
+		verr.add("country", fmt.Sprintf("%q doesn't match the unloc country %s", port.Country, port.Unloc[:2]))
+	}
+
+	switch len(port.Coordinates) {
+	case 0:
+		// the port location is unknown
+	case 2:
+		lon, lat := port.Coordinates[0], port.Coordinates[1]
+		if lon.LessThan(minLongitude) || lon.GreaterThan(maxLongitude) {
+			verr.add("coordinates[0]", "longitude must be between -180 and 180")
+		}
+		if lat.LessThan(minLatitude) || lat.GreaterThan(maxLatitude) {
+			verr.add("coordinates[1]", "latitude must be between -90 and 90")
+		}
+	default:
+		verr.add("coordinates", "must hold the longitude and latitude")
+	}
+
+	if port.Timezone != "" {
+		if _, err := time.LoadLocation(port.Timezone); err != nil || port.Timezone == "Local" {
+			verr.add("timezone", fmt.Sprintf("%q is not an IANA time zone", port.Timezone))
+		}
+	}
+
+	if len(verr) > 0 {
+		return localErrs.New(localErrs.CodeUnprocessableEntity, "invalid port", verr...)
+	}
+	return nil
+}
+
+// matchesCountry reports whether the country is the ISO 3166-1 alpha-2 code
+// or one of the names of the country
+func matchesCountry(code, country string) bool {
+	if strings.EqualFold(code, country) {
+		return true
+	}
+	folded := foldCountry(country)
+	for _, name := range countryNames[code] {
+		if foldCountry(name) == folded {
+			return true
+		}
+	}
+	return false
+}
+
+// foldCountry keeps only the lower cased letters and digits of the country
+// name, without diacritics
+func foldCountry(name string) string {
+	t := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)))
+	folded, _, err := transform.String(t, name)
+	if err != nil {
+		folded = name
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, folded)
+}
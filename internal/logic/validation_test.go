@@ -0,0 +1,146 @@
+package logic
+
+import (
+	"testing"
+
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/WendelHime/ports/internal/shared/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePort(t *testing.T) {
+	validPort := func() models.Port {
+		return models.Port{
+			Unloc:       "BRSSZ",
+			Name:        "Santos",
+			Country:     "Brazil",
+			Coordinates: []decimal.Decimal{decimal.RequireFromString("-46.33"), decimal.RequireFromString("-23.96")},
+			Timezone:    "America/Sao_Paulo",
+			Unlocs:      []string{"BRSSZ"},
+		}
+	}
+	var tests = []struct {
+		name   string
+		fields []string
+		port   func() models.Port
+	}{
+		{
+			name: "valid port should pass",
+			port: validPort,
+		},
+		{
+			name: "country code, alternative names and missing location should pass",
+			port: func() models.Port {
+				port := validPort()
+				port.Country = "br"
+				port.Coordinates = nil
+				port.Timezone = ""
+				port.Unlocs = []string{"BRSSZ", "BRSTS"}
+				return port
+			},
+		},
+		{
+			name: "country names should be compared without case, punctuation and diacritics",
+			port: func() models.Port {
+				port := validPort()
+				port.Country = "cote d’ivoire"
+				port.Unloc = "CIABJ"
+				port.Unlocs = []string{"CIABJ"}
+				port.Coordinates = nil
+				port.Timezone = "Africa/Abidjan"
+				return port
+			},
+		},
+		{
+			name:   "empty unlocs should fail",
+			fields: []string{"unlocs"},
+			port: func() models.Port {
+				port := validPort()
+				port.Unlocs = nil
+				return port
+			},
+		},
+		{
+			name:   "malformed unloc and missing key should fail",
+			fields: []string{"unlocs[0]", "unlocs"},
+			port: func() models.Port {
+				port := validPort()
+				port.Unlocs = []string{"br-ssz"}
+				return port
+			},
+		},
+		{
+			name:   "missing canonical unloc should fail",
+			fields: []string{"unloc"},
+			port: func() models.Port {
+				port := validPort()
+				port.Unloc = ""
+				return port
+			},
+		},
+		{
+			name:   "unknown country code should fail",
+			fields: []string{"unlocs[1]"},
+			port: func() models.Port {
+				port := validPort()
+				port.Unlocs = []string{"BRSSZ", "ZZSSZ"}
+				return port
+			},
+		},
+		{
+			name:   "country inconsistent with the unloc should fail",
+			fields: []string{"country"},
+			port: func() models.Port {
+				port := validPort()
+				port.Country = "Argentina"
+				return port
+			},
+		},
+		{
+			name:   "single coordinate should fail",
+			fields: []string{"coordinates"},
+			port: func() models.Port {
+				port := validPort()
+				port.Coordinates = port.Coordinates[:1]
+				return port
+			},
+		},
+		{
+			name:   "coordinates out of range should fail",
+			fields: []string{"coordinates[0]", "coordinates[1]"},
+			port: func() models.Port {
+				port := validPort()
+				port.Coordinates = []decimal.Decimal{decimal.NewFromInt(181), decimal.NewFromInt(-91)}
+				return port
+			},
+		},
+		{
+			name:   "unknown time zone should fail",
+			fields: []string{"timezone"},
+			port: func() models.Port {
+				port := validPort()
+				port.Timezone = "America/Santos"
+				return port
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePort(tt.port())
+			if len(tt.fields) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, localErrs.ErrUnprocessableEntity)
+			var verr *localErrs.Error
+			if assert.ErrorAs(t, err, &verr) {
+				fields := make([]string, 0, len(verr.Details))
+				for _, field := range verr.Details {
+					fields = append(fields, field.Field)
+				}
+				assert.Equal(t, tt.fields, fields)
+			}
+		})
+	}
+}
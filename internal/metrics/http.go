@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// unmatchedRoute labels the requests not matching any route, so unknown paths
+// don't create series
+const unmatchedRoute = "unmatched"
+
+// Requests returns the middleware counting the requests and observing their
+// latency per method, chi route pattern and status
+func Requests(reg prometheus.Registerer) func(http.Handler) http.Handler {
+	labels := []string{"method", "route", "status"}
+	requests := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "ports_http_requests_total",
+		Help: "Amount of HTTP requests served.",
+	}, labels)
+	latency := promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ports_http_request_duration_seconds",
+		Help:    "Latency of the HTTP requests served, change streams included.",
+		Buckets: DefaultBuckets,
+	}, labels)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			route := unmatchedRoute
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+			status := ww.Status()
+			if status == 0 {
+				// nothing was written, so net/http answers with ok
+				status = http.StatusOK
+			}
+			values := []string{r.Method, route, strconv.Itoa(status)}
+			requests.WithLabelValues(values...).Inc()
+			latency.WithLabelValues(values...).Observe(time.Since(start).Seconds())
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// Package metrics collects the service metrics through the Prometheus client
+// and exposes them on the Prometheus text format
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the latency histograms
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// NewRegistry returns a registry exposing the Go runtime and process metrics
+// along the ones registered by the service
+func NewRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return reg
+}
+
+// Handler serves the metrics gathered by reg on the Prometheus text format
+func Handler(reg prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
+
+// CountingReader counts the bytes read through it, the count may be read
+// while another goroutine reads
+type CountingReader struct {
+	reader io.Reader
+	read   atomic.Int64
+}
+
+func NewCountingReader(reader io.Reader) *CountingReader {
+	return &CountingReader{reader: reader}
+}
+
+func (r *CountingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read.Add(int64(n))
+	return n, err
+}
+
+// Count returns the amount of bytes read so far
+func (r *CountingReader) Count() int64 {
+	return r.read.Load()
+}
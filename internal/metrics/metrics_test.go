@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequests(t *testing.T) {
+	reg := NewRegistry()
+	r := chi.NewRouter()
+	r.Use(Requests(reg))
+	r.Get("/ports/{unloc}", func(w http.ResponseWriter, r *http.Request) {
+		if chi.URLParam(r, "unloc") == "XXXXX" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("{}"))
+	})
+	r.Get("/metrics", Handler(reg).ServeHTTP)
+
+	for _, path := range []string{"/ports/AEAJM", "/ports/AEAUH", "/ports/XXXXX", "/unknown"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain; version=0.0.4")
+	body := w.Body.String()
+	assert.Contains(t, body, `ports_http_requests_total{method="GET",route="/ports/{unloc}",status="200"} 2`)
+	assert.Contains(t, body, `ports_http_requests_total{method="GET",route="/ports/{unloc}",status="404"} 1`)
+	assert.Contains(t, body, `ports_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, body, `ports_http_request_duration_seconds_count{method="GET",route="/ports/{unloc}",status="200"} 2`)
+	// the runtime metrics are exposed too
+	assert.Contains(t, body, "go_goroutines ")
+}
+
+func TestCountingReader(t *testing.T) {
+	reader := NewCountingReader(strings.NewReader("ports"))
+	assert.Equal(t, int64(0), reader.Count())
+	read, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "ports", string(read))
+	assert.Equal(t, int64(5), reader.Count())
+}
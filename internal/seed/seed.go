@@ -0,0 +1,158 @@
+// Package seed loads port files into the catalogue, at startup or whenever
+// they change
+package seed
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/WendelHime/ports/internal/logging"
+	"github.com/WendelHime/ports/internal/logic"
+	"github.com/WendelHime/ports/internal/metrics"
+	"github.com/WendelHime/ports/internal/shared/models"
+	"github.com/pkg/errors"
+)
+
+// progressInterval is how often the progress of a file being loaded is logged
+const progressInterval = 5 * time.Second
+
+// Loader syncs the port files through the domain service
+type Loader struct {
+	service  logic.PortDomainService
+	opts     logic.SyncOptions
+	interval time.Duration
+}
+
+func NewLoader(service logic.PortDomainService, opts logic.SyncOptions) *Loader {
+	return &Loader{
+		service:  service,
+		opts:     opts,
+		interval: progressInterval,
+	}
+}
+
+// Load syncs each of the files at the paths in order, the directories
+// contributing their .json files ordered by name, and returns the sum of
+// their reports. It stops at the first file failing to sync, the previous ones
+// staying loaded. The progress is logged through the context logger.
+func (l *Loader) Load(ctx context.Context, paths []string) (models.SyncReport, error) {
+	var total models.SyncReport
+	logger := logging.FromContext(ctx)
+	start := time.Now()
+	files, err := Files(paths)
+	if err != nil {
+		return total, err
+	}
+
+	for i, file := range files {
+		report, err := l.loadFile(ctx, file)
+		if err != nil {
+			return total, errors.Wrapf(err, "failed to seed %s", file)
+		}
+		logger.Info("seeded file",
+			"file", file,
+			"position", i+1,
+			"files", len(files),
+			"created", report.Created,
+			"updated", report.Updated,
+			"unchanged", report.Unchanged,
+			"failed", report.Failed,
+			"duration_ms", report.DurationMs,
+		)
+		total.Created += report.Created
+		total.Updated += report.Updated
+		total.Unchanged += report.Unchanged
+		total.Deleted += report.Deleted
+		total.Failed += report.Failed
+		total.Errors = append(total.Errors, report.Errors...)
+	}
+	total.DurationMs = time.Since(start).Milliseconds()
+	return total, nil
+}
+
+// loadFile syncs the file, logging how much of it was read until it's done
+func (l *Loader) loadFile(ctx context.Context, path string) (models.SyncReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return models.SyncReport{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return models.SyncReport{}, err
+	}
+
+	reader := metrics.NewCountingReader(f)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(l.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				read := reader.Count()
+				logging.FromContext(ctx).Info("seeding progress",
+					"file", path,
+					"percent", percent(read, info.Size()),
+					"read_bytes", read,
+					"size_bytes", info.Size(),
+				)
+			}
+		}
+	}()
+
+	return l.service.SyncPorts(ctx, reader, l.opts)
+}
+
+// Files expands the paths into the files to be loaded, replacing each
+// directory by its .json files ordered by name
+func Files(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read seed path")
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read seed directory")
+		}
+		var found []string
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), ".json") {
+				found = append(found, filepath.Join(path, entry.Name()))
+			}
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("seed directory %s has no .json files", path)
+		}
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+func percent(read, size int64) int64 {
+	if size <= 0 {
+		return 100
+	}
+	return read * 100 / size
+}
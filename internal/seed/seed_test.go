@@ -0,0 +1,145 @@
+package seed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/WendelHime/ports/internal/logging"
+	"github.com/WendelHime/ports/internal/logic"
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/WendelHime/ports/internal/shared/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedDir writes the files, named after their content, and returns the dir
+func seedDir(t *testing.T, names ...string) string {
+	dir := t.TempDir()
+	for _, name := range names {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o600))
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	var tests = []struct {
+		name            string
+		setup           func(t *testing.T) []string
+		results         []error
+		expectedSynced  []string
+		expectedReport  models.SyncReport
+		expectedErrorIs error
+		expectedError   string
+	}{
+		{
+			name: "Files should be synced in the given order",
+			setup: func(t *testing.T) []string {
+				dir := seedDir(t, "b.json", "a.json")
+				return []string{filepath.Join(dir, "b.json"), filepath.Join(dir, "a.json")}
+			},
+			results:        []error{nil, nil},
+			expectedSynced: []string{"b.json", "a.json"},
+			expectedReport: models.SyncReport{Created: 2, Updated: 2},
+		},
+		{
+			name: "Directory should be synced as its json files ordered by name",
+			setup: func(t *testing.T) []string {
+				return []string{seedDir(t, "2.json", "README.md", "1.JSON")}
+			},
+			results:        []error{nil, nil},
+			expectedSynced: []string{"1.JSON", "2.json"},
+			expectedReport: models.SyncReport{Created: 2, Updated: 2},
+		},
+		{
+			name: "Failing file should stop the seeding",
+			setup: func(t *testing.T) []string {
+				return []string{seedDir(t, "1.json", "2.json", "3.json")}
+			},
+			results:         []error{nil, localErrs.ErrBadRequest},
+			expectedSynced:  []string{"1.json", "2.json"},
+			expectedReport:  models.SyncReport{Created: 1, Updated: 1},
+			expectedErrorIs: localErrs.ErrBadRequest,
+		},
+		{
+			name: "Missing path should be reported",
+			setup: func(t *testing.T) []string {
+				return []string{filepath.Join(t.TempDir(), "ports.json")}
+			},
+			expectedError: "failed to read seed path",
+		},
+		{
+			name: "Directory without json files should be reported",
+			setup: func(t *testing.T) []string {
+				return []string{seedDir(t, "ports.csv")}
+			},
+			expectedError: "has no .json files",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths := tt.setup(t)
+			ctrl := gomock.NewController(t)
+			service := logic.NewMockPortDomainService(ctrl)
+			var synced []string
+			for _, result := range tt.results {
+				result := result
+				service.EXPECT().SyncPorts(gomock.Any(), gomock.Any(), logic.SyncOptions{Lenient: true}).
+					DoAndReturn(func(ctx context.Context, ports io.Reader, opts logic.SyncOptions) (models.SyncReport, error) {
+						b, err := io.ReadAll(ports)
+						require.NoError(t, err)
+						synced = append(synced, string(b))
+						if result != nil {
+							return models.SyncReport{}, result
+						}
+						return models.SyncReport{Created: 1, Updated: 1}, nil
+					}).Times(1)
+			}
+
+			loader := NewLoader(service, logic.SyncOptions{Lenient: true})
+			report, err := loader.Load(context.Background(), paths)
+			if tt.expectedErrorIs != nil || tt.expectedError != "" {
+				require.Error(t, err)
+				if tt.expectedErrorIs != nil {
+					assert.True(t, errors.Is(err, tt.expectedErrorIs))
+				}
+				assert.Contains(t, err.Error(), tt.expectedError)
+			} else {
+				require.NoError(t, err)
+			}
+			report.DurationMs = 0
+			assert.Equal(t, tt.expectedReport, report)
+			assert.Equal(t, tt.expectedSynced, synced)
+		})
+	}
+}
+
+func TestLoadProgress(t *testing.T) {
+	dir := seedDir(t, "ports.json")
+	ctrl := gomock.NewController(t)
+	service := logic.NewMockPortDomainService(ctrl)
+	service.EXPECT().SyncPorts(gomock.Any(), gomock.Any(), logic.SyncOptions{}).
+		DoAndReturn(func(ctx context.Context, ports io.Reader, opts logic.SyncOptions) (models.SyncReport, error) {
+			_, err := io.ReadAll(ports)
+			require.NoError(t, err)
+			// a slow sync should have its progress logged
+			time.Sleep(20 * time.Millisecond)
+			return models.SyncReport{Created: 1}, nil
+		}).Times(1)
+
+	loader := NewLoader(service, logic.SyncOptions{})
+	loader.interval = 5 * time.Millisecond
+	logs := new(bytes.Buffer)
+	logger, err := logging.New(logs, logging.FormatJSON, "info")
+	require.NoError(t, err)
+	_, err = loader.Load(logging.WithLogger(context.Background(), logger), []string{dir})
+	require.NoError(t, err)
+	assert.Contains(t, logs.String(), `"msg":"seeding progress"`)
+	assert.Contains(t, logs.String(), `"msg":"seeded file"`)
+}
@@ -0,0 +1,114 @@
+package seed
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/WendelHime/ports/internal/logging"
+	"github.com/WendelHime/ports/internal/logic"
+)
+
+// DefaultWatchInterval is how often the watched file is checked for changes
+const DefaultWatchInterval = 10 * time.Second
+
+// Watcher keeps the catalogue synced with a ports file, replacing it with the
+// file content whenever the file changes. A changed file is only loaded once
+// it's left unchanged for a whole interval, so a file still being written
+// isn't. A sync is atomic, so a file failing to parse leaves the previous
+// catalogue live.
+type Watcher struct {
+	loader   *Loader
+	path     string
+	interval time.Duration
+	reload   chan struct{}
+	// state is the file as it was on the last load
+	state fileState
+	// changed is the file as it was on the last check, when it differed from
+	// state
+	changed fileState
+}
+
+// fileState identifies a version of the file
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func NewWatcher(service logic.PortDomainService, path string, interval time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	return &Watcher{
+		loader:   NewLoader(service, logic.SyncOptions{Mode: logic.SyncModeReplace}),
+		path:     path,
+		interval: interval,
+		reload:   make(chan struct{}, 1),
+	}
+}
+
+// Load replaces the catalogue with the file content
+func (w *Watcher) Load(ctx context.Context) error {
+	w.state, _ = w.stat()
+	w.changed = fileState{}
+	_, err := w.loader.Load(ctx, []string{w.path})
+	return err
+}
+
+// Reload asks Run to load the file again even if it didn't change
+func (w *Watcher) Reload() {
+	select {
+	case w.reload <- struct{}{}:
+	default:
+		// a reload is already pending
+	}
+}
+
+// Run loads the file whenever it changes, once the change is seen on two
+// checks in a row, or a reload is asked, until the context is done. The
+// failures are logged and the file is only loaded again once it changes.
+func (w *Watcher) Run(ctx context.Context) {
+	logger := logging.FromContext(ctx).With("file", w.path)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.reload:
+			logger.Info("reloading ports file")
+		case <-ticker.C:
+			state, err := w.stat()
+			if err != nil {
+				if w.state != (fileState{}) {
+					logger.Warn("failed to check ports file for changes, keeping the current ports", "error", err.Error())
+				}
+				w.state = fileState{}
+				continue
+			}
+			if state == w.state {
+				w.changed = fileState{}
+				continue
+			}
+			if state != w.changed {
+				// the file may still be being written
+				w.changed = state
+				continue
+			}
+			logger.Info("ports file changed, reloading it")
+		}
+
+		err := w.Load(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Error("failed to reload ports file, keeping the current ports", "error", err.Error())
+		}
+	}
+}
+
+func (w *Watcher) stat() (fileState, error) {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return fileState{}, err
+	}
+	return fileState{modTime: info.ModTime(), size: info.Size()}, nil
+}
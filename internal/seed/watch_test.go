@@ -0,0 +1,81 @@
+package seed
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/WendelHime/ports/internal/logic"
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/WendelHime/ports/internal/shared/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ports.json")
+	// the fixtures are renamed into place, like a tool replacing the file would
+	write := func(content string) {
+		tmp := filepath.Join(dir, "ports.json.tmp")
+		require.NoError(t, os.WriteFile(tmp, []byte(content), 0o600))
+		require.NoError(t, os.Rename(tmp, path))
+	}
+	write("first")
+
+	synced := make(chan string, 10)
+	ctrl := gomock.NewController(t)
+	service := logic.NewMockPortDomainService(ctrl)
+	service.EXPECT().SyncPorts(gomock.Any(), gomock.Any(), logic.SyncOptions{Mode: logic.SyncModeReplace}).
+		DoAndReturn(func(ctx context.Context, ports io.Reader, opts logic.SyncOptions) (models.SyncReport, error) {
+			b, err := io.ReadAll(ports)
+			require.NoError(t, err)
+			synced <- string(b)
+			if string(b) == "invalid" {
+				return models.SyncReport{}, localErrs.ErrBadRequest
+			}
+			return models.SyncReport{Updated: 1}, nil
+		}).AnyTimes()
+
+	watcher := NewWatcher(service, path, time.Millisecond)
+	require.NoError(t, watcher.Load(context.Background()))
+	assert.Equal(t, "first", <-synced)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watcher.Run(ctx)
+	}()
+
+	expectSynced := func(expected string) {
+		select {
+		case content := <-synced:
+			assert.Equal(t, expected, content)
+		case <-time.After(time.Second):
+			t.Fatalf("%q wasn't synced", expected)
+		}
+	}
+
+	// a changed file should be synced
+	write("second")
+	expectSynced("second")
+
+	// a file failing to sync should only be synced again once changed
+	write("invalid")
+	expectSynced("invalid")
+	assert.Never(t, func() bool { return len(synced) > 0 }, 20*time.Millisecond, time.Millisecond)
+
+	// a reload should sync the file even if it didn't change
+	write("third")
+	expectSynced("third")
+	watcher.Reload()
+	expectSynced("third")
+
+	cancel()
+	<-done
+}
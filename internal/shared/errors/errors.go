@@ -1,7 +1,78 @@
+// Package errors holds the application error type and its sentinel values
 package errors
 
-import "errors"
+import "strings"
 
-var ErrBadRequest = errors.New("the provided input is invalid")
-var ErrInternalServerError = errors.New("internal server error")
-var ErrNotFound = errors.New("not found")
+// Code classifies an application error, each code is answered with its own
+// HTTP status
+type Code string
+
+const (
+	CodeBadRequest          Code = "bad_request"
+	CodeNotFound            Code = "not_found"
+	CodeConflict            Code = "conflict"
+	CodePreconditionFailed  Code = "precondition_failed"
+	CodePayloadTooLarge     Code = "payload_too_large"
+	CodeUnprocessableEntity Code = "unprocessable_entity"
+	CodeInternal            Code = "internal"
+	CodeUnavailable         Code = "unavailable"
+)
+
+var ErrBadRequest = New(CodeBadRequest, "the provided input is invalid")
+var ErrInternalServerError = New(CodeInternal, "internal server error")
+var ErrNotFound = New(CodeNotFound, "not found")
+var ErrConflict = New(CodeConflict, "the provided input conflicts with the stored data")
+var ErrPreconditionFailed = New(CodePreconditionFailed, "the stored data doesn't match the expected version")
+var ErrUnprocessableEntity = New(CodeUnprocessableEntity, "the provided input failed validation")
+var ErrPayloadTooLarge = New(CodePayloadTooLarge, "the provided input is too large")
+
+// FieldError describes why a field of the input is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an application error. It matches, through errors.Is, any other
+// *Error with the same code, so errors.Is(err, ErrNotFound) holds for every
+// not found error.
+type Error struct {
+	Code    Code
+	Message string
+	// Details holds the invalid fields of the input, if any
+	Details []FieldError
+	Cause   error
+}
+
+// New returns an error with the code and message, detailing the invalid fields
+func New(code Code, message string, details ...FieldError) *Error {
+	return &Error{Code: code, Message: message, Details: details}
+}
+
+// Wrap returns an error with the code and message caused by cause
+func Wrap(cause error, code Code, message string) *Error {
+	return &Error{Code: code, Message: message, Cause: cause}
+}
+
+func (e *Error) Error() string {
+	message := e.Message
+	if len(e.Details) > 0 {
+		details := make([]string, 0, len(e.Details))
+		for _, detail := range e.Details {
+			details = append(details, detail.Field+": "+detail.Message)
+		}
+		message += ": " + strings.Join(details, "; ")
+	}
+	if e.Cause != nil {
+		message += ": " + e.Cause.Error()
+	}
+	return message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditAction is the kind of write recorded by an AuditEntry
+type AuditAction string
+
+const (
+	AuditCreated AuditAction = "created"
+	AuditUpdated AuditAction = "updated"
+	AuditDeleted AuditAction = "deleted"
+)
+
+// AuditEntry records a single write of the port identified by Unloc, holding
+// the port before and after the write, none before a creation and none after a
+// deletion, and the fields it changed
+type AuditEntry struct {
+	Unloc     string        `json:"unloc"`
+	Action    AuditAction   `json:"action"`
+	Timestamp time.Time     `json:"timestamp"`
+	RequestID string        `json:"request_id,omitempty"`
+	Previous  *Port         `json:"previous,omitempty"`
+	New       *Port         `json:"new,omitempty"`
+	Changes   []FieldChange `json:"changes,omitempty"`
+}
+
+// FieldChange is the change of a single port field, holding its JSON values
+// before and after the write
+type FieldChange struct {
+	Field    string          `json:"field"`
+	Previous json.RawMessage `json:"previous"`
+	New      json.RawMessage `json:"new"`
+}
+
+// PortEvent is a port change streamed to the subscribers, numbered by an ever
+// increasing Sequence. Port holds the port after the change, or before it when
+// it's deleted.
+type PortEvent struct {
+	Sequence  uint64        `json:"sequence"`
+	Type      AuditAction   `json:"type"`
+	Unloc     string        `json:"unloc"`
+	Timestamp time.Time     `json:"timestamp"`
+	RequestID string        `json:"request_id,omitempty"`
+	Port      Port          `json:"port"`
+	Changes   []FieldChange `json:"changes,omitempty"`
+}
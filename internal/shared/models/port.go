@@ -3,8 +3,13 @@ package models
 
 import "github.com/shopspring/decimal"
 
-// Port represents a harbor and contain correlated data
+// Port represents a harbor and contain correlated data. Unloc is the
+// canonical unloc identifying the port, always the first of its Unlocs, and
+// Coordinates hold the longitude and latitude, in this order. Version is
+// increased by the storage on every write, a write providing a Version only
+// succeeds when it's still the stored one.
 type Port struct {
+	Unloc       string            `json:"unloc"`
 	Name        string            `json:"name"`
 	City        string            `json:"city"`
 	Country     string            `json:"country"`
@@ -15,4 +20,108 @@ type Port struct {
 	Timezone    string            `json:"timezone"`
 	Unlocs      []string          `json:"unlocs"`
 	Code        string            `json:"code"`
+	Version     int64             `json:"version"`
+}
+
+// Equal reports whether both ports hold the same data, regardless of their
+// versions. Nil and empty lists are considered equal and coordinates are
+// compared by value.
+func (p Port) Equal(other Port) bool {
+	if p.Unloc != other.Unloc || p.Name != other.Name || p.City != other.City || p.Country != other.Country ||
+		p.Province != other.Province || p.Timezone != other.Timezone || p.Code != other.Code {
+		return false
+	}
+	if !equalStrings(p.Alias, other.Alias) || !equalStrings(p.Regions, other.Regions) || !equalStrings(p.Unlocs, other.Unlocs) {
+		return false
+	}
+	if len(p.Coordinates) != len(other.Coordinates) {
+		return false
+	}
+	for i := range p.Coordinates {
+		if !p.Coordinates[i].Equal(other.Coordinates[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// PortFilter narrows down and paginates a listing of ports, empty fields are
+// not applied and text fields are compared case insensitively
+type PortFilter struct {
+	Country  string
+	Region   string
+	Province string
+	Timezone string
+	Code     string
+	// Cursor is the opaque NextCursor of the previous page, empty for the first page
+	Cursor string
+	Limit  int
+}
+
+// PortPage is a page of ports ordered by their primary unloc
+type PortPage struct {
+	Ports []Port `json:"ports"`
+	// NextCursor is empty when there are no more pages
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// NearbyQuery looks for ports within RadiusKm of a point
+type NearbyQuery struct {
+	Latitude  float64
+	Longitude float64
+	RadiusKm  float64
+	Limit     int
+}
+
+// PortDistance is a port and its great-circle distance to the queried point
+type PortDistance struct {
+	Port       Port    `json:"port"`
+	DistanceKm float64 `json:"distance_km"`
+}
+
+// BoundingBox is a geographic rectangle, a MinLongitude greater than the
+// MaxLongitude means the box crosses the antimeridian
+type BoundingBox struct {
+	MinLongitude float64
+	MinLatitude  float64
+	MaxLongitude float64
+	MaxLatitude  float64
+}
+
+// PortMatch is a port found by a search and its relevance score
+type PortMatch struct {
+	Port  Port    `json:"port"`
+	Score float64 `json:"score"`
+}
+
+// SyncReport summarizes what a sync did to the stored ports
+type SyncReport struct {
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Deleted   int `json:"deleted"`
+	Failed    int `json:"failed"`
+	// Errors describes each one of the failed records
+	Errors     []SyncError `json:"errors,omitempty"`
+	DurationMs int64       `json:"duration_ms"`
+}
+
+// SyncError is the reason a record of the sync input failed
+type SyncError struct {
+	Unloc string `json:"unloc,omitempty"`
+	// Offset is the position of the record object on the input, in bytes
+	Offset  int64  `json:"offset"`
+	Message string `json:"message"`
 }
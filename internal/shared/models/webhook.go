@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Webhook is an URL the port changes are delivered to, only the ones whose
+// port matches any of the Countries, either by name or code, or any of the
+// Unlocs when any is provided. The deliveries are signed with the Secret,
+// which is only returned when the webhook is registered.
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Countries []string  `json:"countries,omitempty"`
+	Unlocs    []string  `json:"unlocs,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DeliveryStatus is the state of a webhook delivery
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// Delivery records the attempts of delivering a port change to a webhook
+type Delivery struct {
+	ID         string         `json:"id"`
+	WebhookID  string         `json:"webhook_id"`
+	Sequence   uint64         `json:"sequence"`
+	Event      AuditAction    `json:"event"`
+	Unloc      string         `json:"unloc"`
+	Status     DeliveryStatus `json:"status"`
+	Attempts   int            `json:"attempts"`
+	StatusCode int            `json:"status_code,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
@@ -0,0 +1,602 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/pkg/errors"
+
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/WendelHime/ports/internal/shared/models"
+)
+
+// PortHistory holds the audit trail of the port writes
+type PortHistory interface {
+	// History returns the audit entries of the port that is, or was, stored
+	// under the unloc, oldest first
+	History(ctx context.Context, unloc string) ([]models.AuditEntry, error)
+	// PortAt returns the port stored under the unloc at the instant
+	PortAt(ctx context.Context, unloc string, at time.Time) (models.Port, error)
+	// PortsAt returns every port stored at the instant ordered by unloc
+	PortsAt(ctx context.Context, at time.Time) ([]models.Port, error)
+}
+
+// AuditedPortRepository is a PortRepository recording an audit entry for each
+// one of its writes
+type AuditedPortRepository interface {
+	PortRepository
+	PortHistory
+}
+
+// AuditStore persists the audit trail of an audited repository along its
+// writes, so the ports history survives restarts
+type AuditStore interface {
+	// BeginAudit begins a transaction storing its audit entries along its
+	// writes
+	BeginAudit(ctx context.Context) (AuditTransaction, error)
+	// LoadAudit returns the stored audit trail
+	LoadAudit(ctx context.Context) (AuditTrail, error)
+}
+
+// AuditTransaction is a PortTransaction whose commit stores the audit entries
+// appended to it too, all at once
+type AuditTransaction interface {
+	PortTransaction
+	// AppendAudit stores the entries after the stored ones once committed,
+	// keeping the latest retention entries of each port, or every entry when
+	// retention is zero
+	AppendAudit(ctx context.Context, entries []models.AuditEntry, retention int) error
+}
+
+// auditLogger is implemented by the stores keeping their trail in memory,
+// whose log is shared by the audited repository instead of being copied. The
+// store appends the committed entries to it.
+type auditLogger interface {
+	auditLog() *auditLog
+}
+
+// AuditTrail is the audit trail kept by an AuditStore
+type AuditTrail struct {
+	// Since is when the store started recording the writes
+	Since time.Time `json:"since"`
+	// Entries are the retained entries, oldest first
+	Entries []models.AuditEntry `json:"entries"`
+	// Trimmed holds the primary unlocs of the ports whose oldest entries were
+	// discarded
+	Trimmed []string `json:"trimmed"`
+}
+
+// PortObserver is notified of the audit entries of the writes once stored, in
+// the order they were written. It's called while the writes are held, so it
+// must not block.
+type PortObserver interface {
+	PortsChanged(entries []models.AuditEntry)
+}
+
+type auditedPortRepo struct {
+	PortRepository
+	log       *auditLog
+	retention int
+	store     AuditStore
+	// shared tells whether the log is the store's one
+	shared    bool
+	observers []PortObserver
+	// writes serializes the writes, so each entry holds the port it replaced
+	writes *sync.Mutex
+	now    func() time.Time
+}
+
+// NewAuditedPortRepository records the writes of repo, keeping the latest
+// retention entries of each port, or every entry when retention is zero, and
+// notifies them to the observers. With a store, which must be the one holding
+// the ports of repo, the writes are executed on its transactions and committed
+// along their entries, restoring the ones it holds. Without a store they're
+// only kept in memory and lost on restart, so the ports can only be read as
+// they were since the repository is built.
+func NewAuditedPortRepository(repo PortRepository, store AuditStore, retention int, observers ...PortObserver) (AuditedPortRepository, error) {
+	return newAuditedPortRepo(repo, store, retention, time.Now, observers...)
+}
+
+func newAuditedPortRepo(repo PortRepository, store AuditStore, retention int, now func() time.Time, observers ...PortObserver) (*auditedPortRepo, error) {
+	log := newAuditLog(retention, now())
+	logger, shared := store.(auditLogger)
+	switch {
+	case shared:
+		log = logger.auditLog()
+	case store != nil:
+		trail, err := store.LoadAudit(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		log = restoreAuditLog(retention, trail)
+	}
+	return &auditedPortRepo{
+		PortRepository: repo,
+		log:            log,
+		retention:      retention,
+		store:          store,
+		shared:         shared,
+		observers:      observers,
+		writes:         new(sync.Mutex),
+		now:            now,
+	}, nil
+}
+
+func (r *auditedPortRepo) Create(ctx context.Context, port models.Port) error {
+	return r.write(ctx, primaryUnloc(port), func(repo portWriter) error {
+		return repo.Create(ctx, port)
+	})
+}
+
+func (r *auditedPortRepo) Update(ctx context.Context, port models.Port) error {
+	return r.write(ctx, primaryUnloc(port), func(repo portWriter) error {
+		return repo.Update(ctx, port)
+	})
+}
+
+func (r *auditedPortRepo) Delete(ctx context.Context, unloc string) error {
+	return r.write(ctx, unloc, func(repo portWriter) error {
+		return repo.Delete(ctx, unloc)
+	})
+}
+
+func (r *auditedPortRepo) Begin(ctx context.Context) (PortTransaction, error) {
+	if r.store == nil {
+		tx, err := r.PortRepository.Begin(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &auditedPortTx{PortTransaction: tx, repo: r}, nil
+	}
+	tx, err := r.store.BeginAudit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &auditedPortTx{PortTransaction: tx, repo: r, store: tx}, nil
+}
+
+// portWriter is the write side of both PortRepository and PortTransaction
+type portWriter interface {
+	Create(ctx context.Context, port models.Port) error
+	Update(ctx context.Context, port models.Port) error
+	Delete(ctx context.Context, unloc string) error
+}
+
+// write executes the write of the port stored under the unloc and records its
+// entry. With a store it's executed on a transaction committing the entry too.
+func (r *auditedPortRepo) write(ctx context.Context, unloc string, write func(repo portWriter) error) error {
+	r.writes.Lock()
+	defer r.writes.Unlock()
+	if r.store == nil {
+		entry, err := audit(ctx, r.PortRepository.Get, unloc, func() error {
+			return write(r.PortRepository)
+		})
+		if err != nil {
+			return err
+		}
+		r.record(r.stamp(entry))
+		return nil
+	}
+
+	tx, err := r.store.BeginAudit(ctx)
+	if err != nil {
+		return err
+	}
+	entry, err := audit(ctx, tx.Get, unloc, func() error {
+		return write(tx)
+	})
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return err
+	}
+	return r.commit(ctx, tx, r.stamp(entry))
+}
+
+// commit commits the store transaction along the stamped entries of its writes
+// and records them. The caller must hold the writes.
+func (r *auditedPortRepo) commit(ctx context.Context, tx AuditTransaction, entries []models.AuditEntry) error {
+	if len(entries) > 0 {
+		err := tx.AppendAudit(ctx, entries, r.retention)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return err
+		}
+	}
+	err := tx.Commit(ctx)
+	if err != nil {
+		return err
+	}
+	r.record(entries)
+	return nil
+}
+
+func (r *auditedPortRepo) History(ctx context.Context, unloc string) ([]models.AuditEntry, error) {
+	return r.log.history(unloc), nil
+}
+
+func (r *auditedPortRepo) PortAt(ctx context.Context, unloc string, at time.Time) (models.Port, error) {
+	r.writes.Lock()
+	defer r.writes.Unlock()
+	port, recorded, err := r.log.portAt(unloc, at)
+	if err != nil {
+		return models.Port{}, err
+	}
+	if !recorded {
+		// the port hasn't changed since the history started
+		return r.PortRepository.Get(ctx, unloc)
+	}
+	if port == nil || !containsString(port.Unlocs, unloc) {
+		return models.Port{}, localErrs.ErrNotFound
+	}
+	return *port, nil
+}
+
+func (r *auditedPortRepo) PortsAt(ctx context.Context, at time.Time) ([]models.Port, error) {
+	r.writes.Lock()
+	defer r.writes.Unlock()
+	page, err := r.PortRepository.List(ctx, models.PortFilter{})
+	if err != nil {
+		return nil, err
+	}
+	ports, err := r.log.portsAt(at)
+	if err != nil {
+		return nil, err
+	}
+	// the ports that haven't changed since the history started
+	for _, port := range page.Ports {
+		if !r.log.recorded(primaryUnloc(port)) {
+			ports = append(ports, port)
+		}
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		return primaryUnloc(ports[i]) < primaryUnloc(ports[j])
+	})
+	return ports, nil
+}
+
+// stamp timestamps the entries, discarding the ones of writes without ports
+func (r *auditedPortRepo) stamp(entries ...models.AuditEntry) []models.AuditEntry {
+	at := r.now()
+	stamped := make([]models.AuditEntry, 0, len(entries))
+	for _, entry := range entries {
+		// a write of a port without unlocs can't be looked up
+		if entry.Unloc == "" {
+			continue
+		}
+		entry.Timestamp = at
+		stamped = append(stamped, entry)
+	}
+	return stamped
+}
+
+// record appends the stamped entries of committed writes to the log, unless
+// the store already did, and notifies the observers. The caller must hold the
+// writes.
+func (r *auditedPortRepo) record(entries []models.AuditEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	if !r.shared {
+		r.log.append(entries...)
+	}
+	for _, observer := range r.observers {
+		observer.PortsChanged(entries)
+	}
+}
+
+// auditedPortTx records the entries of the transaction writes once committed,
+// committing them along the writes on the store transaction when there's one
+type auditedPortTx struct {
+	PortTransaction
+	repo    *auditedPortRepo
+	store   AuditTransaction
+	entries []models.AuditEntry
+}
+
+func (tx *auditedPortTx) Create(ctx context.Context, port models.Port) error {
+	return tx.audit(ctx, primaryUnloc(port), func() error {
+		return tx.PortTransaction.Create(ctx, port)
+	})
+}
+
+func (tx *auditedPortTx) Update(ctx context.Context, port models.Port) error {
+	return tx.audit(ctx, primaryUnloc(port), func() error {
+		return tx.PortTransaction.Update(ctx, port)
+	})
+}
+
+func (tx *auditedPortTx) Delete(ctx context.Context, unloc string) error {
+	return tx.audit(ctx, unloc, func() error {
+		return tx.PortTransaction.Delete(ctx, unloc)
+	})
+}
+
+func (tx *auditedPortTx) Commit(ctx context.Context) error {
+	tx.repo.writes.Lock()
+	defer tx.repo.writes.Unlock()
+	entries := tx.repo.stamp(tx.entries...)
+	tx.entries = nil
+	if tx.store != nil {
+		return tx.repo.commit(ctx, tx.store, entries)
+	}
+	err := tx.PortTransaction.Commit(ctx)
+	if err != nil {
+		return err
+	}
+	tx.repo.record(entries)
+	return nil
+}
+
+func (tx *auditedPortTx) audit(ctx context.Context, unloc string, write func() error) error {
+	entry, err := audit(ctx, tx.PortTransaction.Get, unloc, write)
+	if err != nil {
+		return err
+	}
+	tx.entries = append(tx.entries, entry)
+	return nil
+}
+
+// audit executes the write of the port stored under the unloc, returning the
+// entry recording it. get reads the port before and after the write.
+func audit(ctx context.Context, get func(ctx context.Context, unloc string) (models.Port, error), unloc string, write func() error) (models.AuditEntry, error) {
+	previous, err := lookup(ctx, get, unloc)
+	if err != nil {
+		return models.AuditEntry{}, err
+	}
+	err = write()
+	if err != nil {
+		return models.AuditEntry{}, err
+	}
+	current, err := lookup(ctx, get, unloc)
+	if err != nil {
+		return models.AuditEntry{}, err
+	}
+
+	entry := models.AuditEntry{
+		RequestID: middleware.GetReqID(ctx),
+		Previous:  previous,
+		New:       current,
+	}
+	switch {
+	case previous == nil && current != nil:
+		entry.Action = models.AuditCreated
+		entry.Unloc = primaryUnloc(*current)
+	case current == nil && previous != nil:
+		entry.Action = models.AuditDeleted
+		entry.Unloc = primaryUnloc(*previous)
+	case current != nil:
+		entry.Action = models.AuditUpdated
+		entry.Unloc = primaryUnloc(*current)
+	}
+	entry.Changes, err = diffPorts(previous, current)
+	if err != nil {
+		return models.AuditEntry{}, err
+	}
+	return entry, nil
+}
+
+// lookup returns the port stored under the unloc, nil when there is none
+func lookup(ctx context.Context, get func(ctx context.Context, unloc string) (models.Port, error), unloc string) (*models.Port, error) {
+	port, err := get(ctx, unloc)
+	if errors.Is(err, localErrs.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &port, nil
+}
+
+// diffPorts returns the fields, but the version, changed from the previous
+// port to the current one, a missing port having every field empty
+func diffPorts(previous, current *models.Port) ([]models.FieldChange, error) {
+	before, err := portFields(previous)
+	if err != nil {
+		return nil, err
+	}
+	after, err := portFields(current)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(after))
+	for field := range after {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var changes []models.FieldChange
+	for _, field := range fields {
+		if field == "version" || bytes.Equal(before[field], after[field]) {
+			continue
+		}
+		changes = append(changes, models.FieldChange{Field: field, Previous: before[field], New: after[field]})
+	}
+	return changes, nil
+}
+
+// portFields returns the JSON value of each port field
+func portFields(port *models.Port) (map[string]json.RawMessage, error) {
+	if port == nil {
+		port = &models.Port{}
+	}
+	b, err := json.Marshal(port)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode port")
+	}
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(b, &fields)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode port fields")
+	}
+	return fields, nil
+}
+
+// auditLog keeps the latest retention entries of each port by its primary
+// unloc, remembering the port each unloc belonged to. The entries recorded
+// since the log started tell how every port was at any instant after it,
+// unless some of them were trimmed.
+type auditLog struct {
+	retention int
+	since     time.Time
+	entries   map[string][]models.AuditEntry
+	// trimmed holds the ports whose oldest entries were discarded
+	trimmed map[string]bool
+	owners  map[string]string
+	mutex   *sync.Mutex
+}
+
+func newAuditLog(retention int, since time.Time) *auditLog {
+	return &auditLog{
+		retention: retention,
+		since:     since,
+		entries:   make(map[string][]models.AuditEntry),
+		trimmed:   make(map[string]bool),
+		owners:    make(map[string]string),
+		mutex:     new(sync.Mutex),
+	}
+}
+
+// restoreAuditLog returns a log holding the trail of a store
+func restoreAuditLog(retention int, trail AuditTrail) *auditLog {
+	l := newAuditLog(retention, trail.Since)
+	l.append(trail.Entries...)
+	for _, primary := range trail.Trimmed {
+		l.trimmed[primary] = true
+	}
+	return l
+}
+
+// trail returns the entries of every port ordered by timestamp, each port
+// keeping the order of its own entries
+func (l *auditLog) trail() AuditTrail {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	trail := AuditTrail{Since: l.since, Entries: []models.AuditEntry{}, Trimmed: []string{}}
+	for _, entries := range l.entries {
+		trail.Entries = append(trail.Entries, entries...)
+	}
+	sort.SliceStable(trail.Entries, func(i, j int) bool {
+		return trail.Entries[i].Timestamp.Before(trail.Entries[j].Timestamp)
+	})
+	for primary := range l.trimmed {
+		trail.Trimmed = append(trail.Trimmed, primary)
+	}
+	sort.Strings(trail.Trimmed)
+	return trail
+}
+
+// append records the entries, which are written after every recorded one
+func (l *auditLog) append(entries ...models.AuditEntry) {
+	l.appendRetaining(l.retention, entries...)
+}
+
+// appendRetaining records the entries keeping the latest retention ones of
+// each port, or every entry when retention is zero
+func (l *auditLog) appendRetaining(retention int, entries ...models.AuditEntry) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, entry := range entries {
+		for _, port := range []*models.Port{entry.Previous, entry.New} {
+			if port == nil {
+				continue
+			}
+			for _, unloc := range port.Unlocs {
+				l.owners[unloc] = entry.Unloc
+			}
+		}
+
+		kept := append(l.entries[entry.Unloc], entry)
+		if retention > 0 && len(kept) > retention {
+			kept = append([]models.AuditEntry(nil), kept[len(kept)-retention:]...)
+			l.trimmed[entry.Unloc] = true
+		}
+		l.entries[entry.Unloc] = kept
+	}
+}
+
+// history returns a copy of the entries of the port the unloc belongs to
+func (l *auditLog) history(unloc string) []models.AuditEntry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	primary, exists := l.owners[unloc]
+	if !exists {
+		return []models.AuditEntry{}
+	}
+	return append([]models.AuditEntry{}, l.entries[primary]...)
+}
+
+// recorded reports whether the port identified by the primary unloc has any
+// entry
+func (l *auditLog) recorded(primary string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.entries[primary]) > 0
+}
+
+// portAt returns the port the unloc belonged to as it was at the instant, nil
+// when it wasn't stored, and whether the port has any entry. Without entries
+// the port is the same since the log started.
+func (l *auditLog) portAt(unloc string, at time.Time) (*models.Port, bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if at.Before(l.since) {
+		return nil, false, l.unretained(l.since)
+	}
+	primary, exists := l.owners[unloc]
+	if !exists {
+		return nil, false, nil
+	}
+	port, err := l.stateAt(primary, at)
+	return port, true, err
+}
+
+// portsAt returns every port with entries as it was at the instant
+func (l *auditLog) portsAt(at time.Time) ([]models.Port, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if at.Before(l.since) {
+		return nil, l.unretained(l.since)
+	}
+	ports := make([]models.Port, 0, len(l.entries))
+	for primary := range l.entries {
+		port, err := l.stateAt(primary, at)
+		if err != nil {
+			return nil, err
+		}
+		if port != nil {
+			ports = append(ports, *port)
+		}
+	}
+	return ports, nil
+}
+
+// stateAt returns the port identified by the primary unloc as it was at the
+// instant, nil when it wasn't stored. The caller must hold the mutex.
+func (l *auditLog) stateAt(primary string, at time.Time) (*models.Port, error) {
+	entries := l.entries[primary]
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	if l.trimmed[primary] && at.Before(entries[0].Timestamp) {
+		return nil, l.unretained(entries[0].Timestamp)
+	}
+	// the first entry written after the instant
+	i := sort.Search(len(entries), func(i int) bool {
+		return entries[i].Timestamp.After(at)
+	})
+	if i == 0 {
+		return entries[0].Previous, nil
+	}
+	return entries[i-1].New, nil
+}
+
+func (l *auditLog) unretained(since time.Time) error {
+	return localErrs.New(localErrs.CodeUnprocessableEntity, fmt.Sprintf("ports history is only retained since %s", since.Format(time.RFC3339Nano)))
+}
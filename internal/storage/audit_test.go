@@ -0,0 +1,425 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/WendelHime/ports/internal/shared/models"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditedRepositoryBehaviour(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		testRepositoryBehaviour(t, func(t *testing.T) PortRepository {
+			repo, err := NewAuditedPortRepository(NewPortRepository(), nil, 0)
+			require.NoError(t, err)
+			return repo
+		})
+	})
+	t.Run("File store", func(t *testing.T) {
+		testRepositoryBehaviour(t, func(t *testing.T) PortRepository {
+			stored := newTestFileRepository(t, t.TempDir(), DefaultCompactEvery)
+			repo, err := NewAuditedPortRepository(stored, stored.(AuditStore), 0)
+			require.NoError(t, err)
+			return repo
+		})
+	})
+	t.Run("SQL store", func(t *testing.T) {
+		testRepositoryBehaviour(t, func(t *testing.T) PortRepository {
+			stored, err := NewSQLPortRepository(openTestDB(t, filepath.Join(t.TempDir(), "ports.db")))
+			require.NoError(t, err)
+			repo, err := NewAuditedPortRepository(stored, stored.(AuditStore), 0)
+			require.NoError(t, err)
+			return repo
+		})
+	})
+}
+
+func TestAuditedRepositoryFileRecords(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	stored := newTestFileRepository(t, dir, DefaultCompactEvery)
+	repo, err := NewAuditedPortRepository(stored, stored.(AuditStore), 0)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.Create(ctx, models.Port{Unloc: "AEAJM", Name: "Ajman", Unlocs: []string{"AEAJM"}}))
+	tx, err := repo.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.Create(ctx, models.Port{Unloc: "AEDXB", Name: "Dubai", Unlocs: []string{"AEDXB"}}))
+	require.NoError(t, tx.Delete(ctx, "AEAJM"))
+	require.NoError(t, tx.Commit(ctx))
+
+	// each write is a single record holding its changes and entries
+	b, err := os.ReadFile(filepath.Join(dir, walFileName))
+	require.NoError(t, err)
+	lines := bytes.Split(bytes.TrimSpace(b), []byte("\n"))
+	require.Len(t, lines, 2)
+	for i, changes := range []int{1, 2} {
+		var record walRecord
+		require.NoError(t, json.Unmarshal(lines[i], &record))
+		assert.Equal(t, walOpBatch, record.Op)
+		assert.Len(t, record.Changes, changes)
+		assert.Len(t, record.Audit, changes)
+	}
+
+	// the trail is kept once, on the log of the file repository
+	entries, err := repo.History(ctx, "AEAJM")
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Same(t, stored.(*filePortRepo).audit, repo.(*auditedPortRepo).log)
+}
+
+func TestAuditedRepository(t *testing.T) {
+	ctx := context.WithValue(context.Background(), middleware.RequestIDKey, "request-id")
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var tests = []struct {
+		name      string
+		retention int
+		exec      func(t *testing.T, repo AuditedPortRepository)
+		assert    func(t *testing.T, repo AuditedPortRepository)
+	}{
+		{
+			name: "Writes should be recorded with their changed fields",
+			exec: func(t *testing.T, repo AuditedPortRepository) {
+				require.NoError(t, repo.Create(ctx, models.Port{Unloc: "AEAJM", Name: "Ajman", Unlocs: []string{"AEAJM", "AEAUH"}}))
+				require.NoError(t, repo.Update(ctx, models.Port{Unloc: "AEAJM", Name: "Ajman Port", Unlocs: []string{"AEAJM", "AEAUH"}}))
+				require.NoError(t, repo.Delete(ctx, "AEAUH"))
+			},
+			assert: func(t *testing.T, repo AuditedPortRepository) {
+				entries, err := repo.History(ctx, "AEAUH")
+				require.NoError(t, err)
+				require.Len(t, entries, 3)
+
+				created := entries[0]
+				assert.Equal(t, models.AuditCreated, created.Action)
+				assert.Equal(t, "AEAJM", created.Unloc)
+				assert.Equal(t, now, created.Timestamp)
+				assert.Equal(t, "request-id", created.RequestID)
+				assert.Nil(t, created.Previous)
+				assert.Equal(t, int64(1), created.New.Version)
+				assert.Equal(t, []string{"name", "unloc", "unlocs"}, changedFields(created.Changes))
+
+				updated := entries[1]
+				assert.Equal(t, models.AuditUpdated, updated.Action)
+				assert.Equal(t, "Ajman", updated.Previous.Name)
+				assert.Equal(t, "Ajman Port", updated.New.Name)
+				assert.Equal(t, []models.FieldChange{
+					{Field: "name", Previous: json.RawMessage(`"Ajman"`), New: json.RawMessage(`"Ajman Port"`)},
+				}, updated.Changes)
+
+				deleted := entries[2]
+				assert.Equal(t, models.AuditDeleted, deleted.Action)
+				assert.Equal(t, "Ajman Port", deleted.Previous.Name)
+				assert.Nil(t, deleted.New)
+			},
+		},
+		{
+			name:      "Only the latest entries should be retained",
+			retention: 2,
+			exec: func(t *testing.T, repo AuditedPortRepository) {
+				for _, name := range []string{"first", "second", "third"} {
+					require.NoError(t, repo.Update(ctx, models.Port{Unloc: "AEAJM", Name: name, Unlocs: []string{"AEAJM"}}))
+				}
+			},
+			assert: func(t *testing.T, repo AuditedPortRepository) {
+				entries, err := repo.History(ctx, "AEAJM")
+				require.NoError(t, err)
+				require.Len(t, entries, 2)
+				assert.Equal(t, "second", entries[0].New.Name)
+				assert.Equal(t, "third", entries[1].New.Name)
+			},
+		},
+		{
+			name: "Failed writes should not be recorded",
+			exec: func(t *testing.T, repo AuditedPortRepository) {
+				require.NoError(t, repo.Create(ctx, models.Port{Unloc: "AEAJM", Unlocs: []string{"AEAJM"}}))
+				assert.Error(t, repo.Update(ctx, models.Port{Unloc: "AEAJM", Unlocs: []string{"AEAJM"}, Version: 5}))
+			},
+			assert: func(t *testing.T, repo AuditedPortRepository) {
+				entries, err := repo.History(ctx, "AEAJM")
+				require.NoError(t, err)
+				assert.Len(t, entries, 1)
+			},
+		},
+		{
+			name: "Transaction writes should only be recorded once committed",
+			exec: func(t *testing.T, repo AuditedPortRepository) {
+				tx, err := repo.Begin(ctx)
+				require.NoError(t, err)
+				require.NoError(t, tx.Create(ctx, models.Port{Unloc: "AEAJM", Unlocs: []string{"AEAJM"}}))
+				require.NoError(t, tx.Rollback(ctx))
+
+				tx, err = repo.Begin(ctx)
+				require.NoError(t, err)
+				require.NoError(t, tx.Create(ctx, models.Port{Unloc: "AEAUH", Unlocs: []string{"AEAUH"}}))
+				entries, err := repo.History(ctx, "AEAUH")
+				require.NoError(t, err)
+				assert.Empty(t, entries)
+				require.NoError(t, tx.Commit(ctx))
+			},
+			assert: func(t *testing.T, repo AuditedPortRepository) {
+				entries, err := repo.History(ctx, "AEAJM")
+				require.NoError(t, err)
+				assert.Empty(t, entries)
+
+				entries, err = repo.History(ctx, "AEAUH")
+				require.NoError(t, err)
+				require.Len(t, entries, 1)
+				assert.Equal(t, models.AuditCreated, entries[0].Action)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, err := newAuditedPortRepo(NewPortRepository(), nil, tt.retention, func() time.Time { return now })
+			require.NoError(t, err)
+			tt.exec(t, repo)
+			tt.assert(t, repo)
+		})
+	}
+}
+
+// recordingObserver keeps the entries it's notified of
+type recordingObserver struct {
+	entries [][]models.AuditEntry
+}
+
+func (o *recordingObserver) PortsChanged(entries []models.AuditEntry) {
+	o.entries = append(o.entries, entries)
+}
+
+func TestAuditedRepositoryObservers(t *testing.T) {
+	ctx := context.Background()
+	observer := &recordingObserver{}
+	repo, err := NewAuditedPortRepository(NewPortRepository(), nil, 0, observer)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.Create(ctx, models.Port{Unloc: "AEAJM", Unlocs: []string{"AEAJM"}}))
+	assert.Error(t, repo.Delete(ctx, "AEAUH"))
+	tx, err := repo.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.Create(ctx, models.Port{Unloc: "AEAUH", Unlocs: []string{"AEAUH"}}))
+	require.NoError(t, tx.Delete(ctx, "AEAJM"))
+	assert.Len(t, observer.entries, 1)
+	require.NoError(t, tx.Commit(ctx))
+
+	require.Len(t, observer.entries, 2)
+	assert.Equal(t, models.AuditCreated, observer.entries[0][0].Action)
+	require.Len(t, observer.entries[1], 2)
+	assert.Equal(t, "AEAUH", observer.entries[1][0].Unloc)
+	assert.Equal(t, models.AuditDeleted, observer.entries[1][1].Action)
+	assert.False(t, observer.entries[1][1].Timestamp.IsZero())
+}
+
+func changedFields(changes []models.FieldChange) []string {
+	fields := make([]string, 0, len(changes))
+	for _, change := range changes {
+		fields = append(fields, change.Field)
+	}
+	return fields
+}
+
+func TestAuditedRepositoryPointInTime(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time {
+		return start.Add(time.Duration(hours) * time.Hour)
+	}
+	var tests = []struct {
+		name      string
+		retention int
+		assert    func(t *testing.T, repo AuditedPortRepository)
+	}{
+		{
+			name: "Port should be read as it was at the instant",
+			assert: func(t *testing.T, repo AuditedPortRepository) {
+				for hours, name := range map[int]string{1: "Ajman", 2: "Ajman", 3: "Ajman Port", 10: "Ajman Port"} {
+					port, err := repo.PortAt(ctx, "AEAJM", at(hours))
+					require.NoError(t, err)
+					assert.Equal(t, name, port.Name)
+				}
+				_, err := repo.PortAt(ctx, "AEAJM", at(0))
+				assert.ErrorIs(t, err, localErrs.ErrNotFound)
+			},
+		},
+		{
+			name: "Unchanged port should be read as stored, deleted or missing unlocs should not be found",
+			assert: func(t *testing.T, repo AuditedPortRepository) {
+				port, err := repo.PortAt(ctx, "FJSUV", at(0))
+				require.NoError(t, err)
+				assert.Equal(t, "Suva", port.Name)
+
+				port, err = repo.PortAt(ctx, "AEDXB", at(5))
+				require.NoError(t, err)
+				assert.Equal(t, "Dubai", port.Name)
+
+				_, err = repo.PortAt(ctx, "AEDXB", at(6))
+				assert.ErrorIs(t, err, localErrs.ErrNotFound)
+				_, err = repo.PortAt(ctx, "AEAUH", at(2))
+				assert.ErrorIs(t, err, localErrs.ErrNotFound)
+			},
+		},
+		{
+			name: "Catalogue should be read as it was at the instant",
+			assert: func(t *testing.T, repo AuditedPortRepository) {
+				ports, err := repo.PortsAt(ctx, at(5))
+				require.NoError(t, err)
+				require.Len(t, ports, 3)
+				assert.Equal(t, "AEAJM", ports[0].Unloc)
+				assert.Equal(t, "AEDXB", ports[1].Unloc)
+				assert.Equal(t, "FJSUV", ports[2].Unloc)
+
+				ports, err = repo.PortsAt(ctx, at(1))
+				require.NoError(t, err)
+				require.Len(t, ports, 2)
+				assert.Equal(t, "Ajman", ports[0].Name)
+				assert.Equal(t, "Suva", ports[1].Name)
+			},
+		},
+		{
+			name: "Instants before the history started should not be read",
+			assert: func(t *testing.T, repo AuditedPortRepository) {
+				_, err := repo.PortAt(ctx, "AEAJM", at(-1))
+				assert.ErrorIs(t, err, localErrs.ErrUnprocessableEntity)
+				_, err = repo.PortsAt(ctx, at(-1))
+				assert.ErrorIs(t, err, localErrs.ErrUnprocessableEntity)
+			},
+		},
+		{
+			name:      "Instants before the retained entries should not be read",
+			retention: 1,
+			assert: func(t *testing.T, repo AuditedPortRepository) {
+				port, err := repo.PortAt(ctx, "AEAJM", at(3))
+				require.NoError(t, err)
+				assert.Equal(t, "Ajman Port", port.Name)
+				_, err = repo.PortAt(ctx, "AEAJM", at(2))
+				assert.ErrorIs(t, err, localErrs.ErrUnprocessableEntity)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := start
+			stored := NewPortRepository()
+			require.NoError(t, stored.Create(ctx, models.Port{Unloc: "FJSUV", Name: "Suva", Unlocs: []string{"FJSUV"}}))
+			repo, err := newAuditedPortRepo(stored, nil, tt.retention, func() time.Time { return now })
+			require.NoError(t, err)
+			for _, write := range []struct {
+				hours int
+				exec  func() error
+			}{
+				{1, func() error {
+					return repo.Create(ctx, models.Port{Unloc: "AEAJM", Name: "Ajman", Unlocs: []string{"AEAJM"}})
+				}},
+				{3, func() error {
+					return repo.Update(ctx, models.Port{Unloc: "AEAJM", Name: "Ajman Port", Unlocs: []string{"AEAJM", "AEAUH"}})
+				}},
+				{4, func() error {
+					return repo.Create(ctx, models.Port{Unloc: "AEDXB", Name: "Dubai", Unlocs: []string{"AEDXB"}})
+				}},
+				{6, func() error { return repo.Delete(ctx, "AEDXB") }},
+			} {
+				now = at(write.hours)
+				require.NoError(t, write.exec())
+			}
+			tt.assert(t, repo)
+		})
+	}
+}
+
+func TestAuditedRepositoryPersistence(t *testing.T) {
+	ctx := context.Background()
+	// the stores start the trail when they're first opened
+	start := time.Now().Add(time.Minute)
+	at := func(hours int) time.Time {
+		return start.Add(time.Duration(hours) * time.Hour)
+	}
+	var tests = []struct {
+		name string
+		open func(t *testing.T, dir string) (PortRepository, AuditStore)
+		// stop releases the repository opened first
+		stop func(t *testing.T, repo PortRepository)
+	}{
+		{
+			name: "File backend should restore the trail from its snapshot",
+			open: func(t *testing.T, dir string) (PortRepository, AuditStore) {
+				repo := newTestFileRepository(t, dir, 2)
+				return repo, repo.(AuditStore)
+			},
+			stop: func(t *testing.T, repo PortRepository) {
+				require.NoError(t, repo.(io.Closer).Close())
+			},
+		},
+		{
+			name: "File backend should replay the trail from its log",
+			open: func(t *testing.T, dir string) (PortRepository, AuditStore) {
+				repo := newTestFileRepository(t, dir, DefaultCompactEvery)
+				return repo, repo.(AuditStore)
+			},
+			stop: func(t *testing.T, repo PortRepository) {
+				// simulating a crash, the log is never compacted
+				require.NoError(t, repo.(*filePortRepo).wal.Close())
+			},
+		},
+		{
+			name: "SQL backend should keep the trail on its tables",
+			open: func(t *testing.T, dir string) (PortRepository, AuditStore) {
+				repo, err := NewSQLPortRepository(openTestDB(t, filepath.Join(dir, "ports.db")))
+				require.NoError(t, err)
+				return repo, repo.(AuditStore)
+			},
+			stop: func(*testing.T, PortRepository) {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			stored, store := tt.open(t, dir)
+			now := start
+			repo, err := newAuditedPortRepo(stored, store, 2, func() time.Time { return now })
+			require.NoError(t, err)
+			for hours, name := range []string{"first", "second", "third"} {
+				now = at(hours)
+				require.NoError(t, repo.Update(ctx, models.Port{Unloc: "AEAJM", Name: name, Unlocs: []string{"AEAJM"}}))
+			}
+			now = at(3)
+			require.NoError(t, repo.Create(ctx, models.Port{Unloc: "AEDXB", Name: "Dubai", Unlocs: []string{"AEDXB"}}))
+			now = at(4)
+			require.NoError(t, repo.Delete(ctx, "AEDXB"))
+			tt.stop(t, stored)
+
+			stored, store = tt.open(t, dir)
+			repo, err = newAuditedPortRepo(stored, store, 2, time.Now)
+			require.NoError(t, err)
+
+			entries, err := repo.History(ctx, "AEAJM")
+			require.NoError(t, err)
+			require.Len(t, entries, 2)
+			assert.Equal(t, "second", entries[0].New.Name)
+			assert.True(t, at(1).Equal(entries[0].Timestamp))
+			assert.Equal(t, "third", entries[1].New.Name)
+
+			port, err := repo.PortAt(ctx, "AEAJM", at(1))
+			require.NoError(t, err)
+			assert.Equal(t, "second", port.Name)
+			// the first entry was discarded by the retention
+			_, err = repo.PortAt(ctx, "AEAJM", at(0))
+			assert.ErrorIs(t, err, localErrs.ErrUnprocessableEntity)
+
+			port, err = repo.PortAt(ctx, "AEDXB", at(3))
+			require.NoError(t, err)
+			assert.Equal(t, "Dubai", port.Name)
+			_, err = repo.PortAt(ctx, "AEDXB", at(4))
+			assert.ErrorIs(t, err, localErrs.ErrNotFound)
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"math"
+	"sort"
+
+	"github.com/WendelHime/ports/internal/shared/models"
+)
+
+const earthRadiusKm = 6371.0088
+
+// portLocation returns the longitude and latitude of the port, ok is false
+// when the port doesn't carry exactly two coordinates
+func portLocation(port models.Port) (lon, lat float64, ok bool) {
+	if len(port.Coordinates) != 2 {
+		return 0, 0, false
+	}
+	lon, _ = port.Coordinates[0].Float64()
+	lat, _ = port.Coordinates[1].Float64()
+	return lon, lat, true
+}
+
+// haversineKm returns the great-circle distance between two points
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLon := (lon2 - lon1) * toRad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// radiusBoundingBox returns a box containing every point within radiusKm of
+// the provided point, covering every longitude when it reaches a pole
+func radiusBoundingBox(lat, lon, radiusKm float64) models.BoundingBox {
+	dLat := radiusKm / earthRadiusKm * 180 / math.Pi
+	box := models.BoundingBox{
+		MinLatitude:  math.Max(-90, lat-dLat),
+		MaxLatitude:  math.Min(90, lat+dLat),
+		MinLongitude: -180,
+		MaxLongitude: 180,
+	}
+	if lat-dLat <= -90 || lat+dLat >= 90 {
+		return box
+	}
+
+	dLon := math.Asin(math.Min(1, math.Sin(radiusKm/earthRadiusKm)/math.Cos(lat*math.Pi/180))) * 180 / math.Pi
+	if dLon >= 180 {
+		return box
+	}
+	box.MinLongitude = normalizeLongitude(lon - dLon)
+	box.MaxLongitude = normalizeLongitude(lon + dLon)
+	return box
+}
+
+func normalizeLongitude(lon float64) float64 {
+	for lon < -180 {
+		lon += 360
+	}
+	for lon > 180 {
+		lon -= 360
+	}
+	return lon
+}
+
+// boxContains reports if the point is inside the box, handling boxes crossing
+// the antimeridian
+func boxContains(box models.BoundingBox, lon, lat float64) bool {
+	if lat < box.MinLatitude || lat > box.MaxLatitude {
+		return false
+	}
+	if box.MinLongitude <= box.MaxLongitude {
+		return lon >= box.MinLongitude && lon <= box.MaxLongitude
+	}
+	return lon >= box.MinLongitude || lon <= box.MaxLongitude
+}
+
+// geoCell is a one degree square of the grid
+type geoCell struct {
+	lat, lon int
+}
+
+type geoPoint struct {
+	lon, lat float64
+}
+
+// geoHit is an indexed unloc found by a spatial query
+type geoHit struct {
+	unloc      string
+	distanceKm float64
+}
+
+// geoIndex is a spatial index bucketing the port locations into a grid of one
+// degree cells, so queries only look at the points of the cells overlapping
+// the searched area. It isn't safe for concurrent use.
+type geoIndex struct {
+	cells  map[geoCell]map[string]geoPoint
+	points map[string]geoPoint
+}
+
+func newGeoIndex() *geoIndex {
+	return &geoIndex{
+		cells:  make(map[geoCell]map[string]geoPoint),
+		points: make(map[string]geoPoint),
+	}
+}
+
+func cellOf(lon, lat float64) geoCell {
+	// points on the 180th meridian and on the north pole belong to the last cell
+	return geoCell{
+		lat: int(math.Min(89, math.Floor(lat))),
+		lon: int(math.Min(179, math.Floor(lon))),
+	}
+}
+
+// set indexes the unloc at the provided location, replacing its previous one
+func (g *geoIndex) set(unloc string, lon, lat float64) {
+	g.remove(unloc)
+	point := geoPoint{lon: lon, lat: lat}
+	cell := cellOf(lon, lat)
+	if g.cells[cell] == nil {
+		g.cells[cell] = make(map[string]geoPoint)
+	}
+	g.cells[cell][unloc] = point
+	g.points[unloc] = point
+}
+
+func (g *geoIndex) remove(unloc string) {
+	point, exists := g.points[unloc]
+	if !exists {
+		return
+	}
+	cell := cellOf(point.lon, point.lat)
+	delete(g.cells[cell], unloc)
+	if len(g.cells[cell]) == 0 {
+		delete(g.cells, cell)
+	}
+	delete(g.points, unloc)
+}
+
+// within returns the unlocs inside the box ordered by unloc
+func (g *geoIndex) within(box models.BoundingBox) []string {
+	unlocs := make([]string, 0)
+	g.scan(box, func(unloc string, point geoPoint) {
+		if boxContains(box, point.lon, point.lat) {
+			unlocs = append(unlocs, unloc)
+		}
+	})
+	sort.Strings(unlocs)
+	return unlocs
+}
+
+// nearby returns the unlocs within radiusKm of the point ordered by distance
+func (g *geoIndex) nearby(lat, lon, radiusKm float64) []geoHit {
+	hits := make([]geoHit, 0)
+	g.scan(radiusBoundingBox(lat, lon, radiusKm), func(unloc string, point geoPoint) {
+		distance := haversineKm(lat, lon, point.lat, point.lon)
+		if distance <= radiusKm {
+			hits = append(hits, geoHit{unloc: unloc, distanceKm: distance})
+		}
+	})
+	sortHits(hits)
+	return hits
+}
+
+// scan calls fn for every point of the cells overlapping the box. When the box
+// covers more cells than the index holds, the populated cells are visited instead.
+func (g *geoIndex) scan(box models.BoundingBox, fn func(unloc string, point geoPoint)) {
+	minCell := cellOf(box.MinLongitude, box.MinLatitude)
+	maxCell := cellOf(box.MaxLongitude, box.MaxLatitude)
+	lonCells := maxCell.lon - minCell.lon + 1
+	if box.MinLongitude > box.MaxLongitude {
+		lonCells = int(math.Min(360, float64(lonCells+360)))
+	}
+	if (maxCell.lat-minCell.lat+1)*lonCells > len(g.cells) {
+		for cell, points := range g.cells {
+			if cell.lat < minCell.lat || cell.lat > maxCell.lat {
+				continue
+			}
+			for unloc, point := range points {
+				fn(unloc, point)
+			}
+		}
+		return
+	}
+
+	for lat := minCell.lat; lat <= maxCell.lat; lat++ {
+		for i := 0; i < lonCells; i++ {
+			lon := minCell.lon + i
+			if lon > 179 {
+				lon -= 360
+			}
+			for unloc, point := range g.cells[geoCell{lat: lat, lon: lon}] {
+				fn(unloc, point)
+			}
+		}
+	}
+}
+
+func sortHits(hits []geoHit) {
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].distanceKm == hits[j].distanceKm {
+			return hits[i].unloc < hits[j].unloc
+		}
+		return hits[i].distanceKm < hits[j].distanceKm
+	})
+}
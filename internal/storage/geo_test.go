@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/WendelHime/ports/internal/shared/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeoIndex(t *testing.T) {
+	var tests = []struct {
+		name   string
+		assert func(t *testing.T, index *geoIndex)
+		setup  func(index *geoIndex)
+	}{
+		{
+			name: "Nearby should find points across the antimeridian",
+			assert: func(t *testing.T, index *geoIndex) {
+				hits := index.nearby(0, 179.9, 50)
+				assert.Len(t, hits, 2)
+				assert.Equal(t, "EAST", hits[0].unloc)
+				assert.Equal(t, "WEST", hits[1].unloc)
+			},
+			setup: func(index *geoIndex) {
+				index.set("EAST", 179.95, 0)
+				index.set("WEST", -179.9, 0)
+				index.set("FAR", 170, 0)
+			},
+		},
+		{
+			name: "Nearby should find points across the pole",
+			assert: func(t *testing.T, index *geoIndex) {
+				hits := index.nearby(89.9, 0, 100)
+				assert.Len(t, hits, 2)
+			},
+			setup: func(index *geoIndex) {
+				index.set("NEAR", 0, 89.5)
+				index.set("OPPOSITE", 180, 89.8)
+				index.set("FAR", 0, 80)
+			},
+		},
+		{
+			name: "Removed points should not be found",
+			assert: func(t *testing.T, index *geoIndex) {
+				assert.Empty(t, index.within(models.BoundingBox{MinLongitude: -180, MinLatitude: -90, MaxLongitude: 180, MaxLatitude: 90}))
+				assert.Empty(t, index.cells)
+			},
+			setup: func(index *geoIndex) {
+				index.set("UNLOC", 10, 10)
+				index.set("UNLOC", 20, 20)
+				index.remove("UNLOC")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := newGeoIndex()
+			tt.setup(index)
+			tt.assert(t, index)
+		})
+	}
+}
+
+func TestHaversine(t *testing.T) {
+	// Rotterdam to Singapore
+	assert.InDelta(t, 10535, haversineKm(51.92, 4.48, 1.29, 103.85), 20)
+	assert.Zero(t, haversineKm(10, 10, 10, 10))
+}
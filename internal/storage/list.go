@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"encoding/base64"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/WendelHime/ports/internal/shared/models"
+)
+
+// primaryUnloc is the unloc a port is listed under
+func primaryUnloc(port models.Port) string {
+	if len(port.Unlocs) == 0 {
+		return ""
+	}
+	return port.Unlocs[0]
+}
+
+// listPortMap returns the page of the ports, keyed by unloc, matching the filter
+func listPortMap(ports map[string]models.Port, filter models.PortFilter) (models.PortPage, error) {
+	after := ""
+	if filter.Cursor != "" {
+		var err error
+		after, err = decodeCursor(filter.Cursor)
+		if err != nil {
+			return models.PortPage{}, err
+		}
+	}
+
+	unlocs := make([]string, 0, len(ports))
+	for unloc, port := range ports {
+		if unloc > after && unloc == primaryUnloc(port) {
+			unlocs = append(unlocs, unloc)
+		}
+	}
+	sort.Strings(unlocs)
+
+	page := models.PortPage{Ports: make([]models.Port, 0)}
+	for _, unloc := range unlocs {
+		port := ports[unloc]
+		if !matchesFilter(port, filter) {
+			continue
+		}
+		if filter.Limit > 0 && len(page.Ports) == filter.Limit {
+			page.NextCursor = encodeCursor(primaryUnloc(page.Ports[len(page.Ports)-1]))
+			break
+		}
+		page.Ports = append(page.Ports, port)
+	}
+	return page, nil
+}
+
+// matchesFilter reports if the port complies with every non empty field of the filter
+func matchesFilter(port models.Port, filter models.PortFilter) bool {
+	if filter.Country != "" && !strings.EqualFold(port.Country, filter.Country) {
+		return false
+	}
+	if filter.Province != "" && !strings.EqualFold(port.Province, filter.Province) {
+		return false
+	}
+	if filter.Timezone != "" && !strings.EqualFold(port.Timezone, filter.Timezone) {
+		return false
+	}
+	if filter.Code != "" && !strings.EqualFold(port.Code, filter.Code) {
+		return false
+	}
+	if filter.Region != "" {
+		for _, region := range port.Regions {
+			if strings.EqualFold(region, filter.Region) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// encodeCursor returns the opaque cursor pointing after the provided unloc
+func encodeCursor(unloc string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(unloc))
+}
+
+// decodeCursor returns the unloc the cursor points after
+func decodeCursor(cursor string) (string, error) {
+	unloc, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", errors.Wrap(localErrs.ErrBadRequest, "invalid cursor provided")
+	}
+	return string(unloc), nil
+}
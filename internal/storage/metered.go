@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/WendelHime/ports/internal/metrics"
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/WendelHime/ports/internal/shared/models"
+)
+
+// meteredPortRepo observes the latency of every operation of the repository
+type meteredPortRepo struct {
+	repo    PortRepository
+	latency *prometheus.HistogramVec
+}
+
+// NewMeteredPortRepository observes the latency of the repo operations per
+// operation and result on the registry, exposing the amount of stored ports
+// too, which is counted by the repo on every exposition
+func NewMeteredPortRepository(repo PortRepository, reg prometheus.Registerer) PortRepository {
+	factory := promauto.With(reg)
+	r := &meteredPortRepo{
+		repo: repo,
+		latency: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ports_repository_operation_duration_seconds",
+			Help:    "Latency of the port repository operations.",
+			Buckets: metrics.DefaultBuckets,
+		}, []string{"operation", "result"}),
+	}
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ports_repository_ports",
+		Help: "Amount of ports stored.",
+	}, func() float64 {
+		count, err := repo.Count(context.Background())
+		if err != nil {
+			return math.NaN()
+		}
+		return float64(count)
+	})
+	return r
+}
+
+// observe records the latency of the operation started at start
+func (r *meteredPortRepo) observe(operation string, start time.Time, err error) {
+	result := "ok"
+	if errors.Is(err, localErrs.ErrNotFound) {
+		result = "not_found"
+	} else if err != nil {
+		result = "error"
+	}
+	r.latency.WithLabelValues(operation, result).Observe(time.Since(start).Seconds())
+}
+
+func (r *meteredPortRepo) Create(ctx context.Context, port models.Port) error {
+	start := time.Now()
+	err := r.repo.Create(ctx, port)
+	r.observe("create", start, err)
+	return err
+}
+
+func (r *meteredPortRepo) Update(ctx context.Context, port models.Port) error {
+	start := time.Now()
+	err := r.repo.Update(ctx, port)
+	r.observe("update", start, err)
+	return err
+}
+
+func (r *meteredPortRepo) Get(ctx context.Context, unloc string) (models.Port, error) {
+	start := time.Now()
+	port, err := r.repo.Get(ctx, unloc)
+	r.observe("get", start, err)
+	return port, err
+}
+
+func (r *meteredPortRepo) Delete(ctx context.Context, unloc string) error {
+	start := time.Now()
+	err := r.repo.Delete(ctx, unloc)
+	r.observe("delete", start, err)
+	return err
+}
+
+func (r *meteredPortRepo) List(ctx context.Context, filter models.PortFilter) (models.PortPage, error) {
+	start := time.Now()
+	page, err := r.repo.List(ctx, filter)
+	r.observe("list", start, err)
+	return page, err
+}
+
+func (r *meteredPortRepo) Count(ctx context.Context) (int, error) {
+	start := time.Now()
+	count, err := r.repo.Count(ctx)
+	r.observe("count", start, err)
+	return count, err
+}
+
+func (r *meteredPortRepo) Nearby(ctx context.Context, query models.NearbyQuery) ([]models.PortDistance, error) {
+	start := time.Now()
+	ports, err := r.repo.Nearby(ctx, query)
+	r.observe("nearby", start, err)
+	return ports, err
+}
+
+func (r *meteredPortRepo) Within(ctx context.Context, box models.BoundingBox, limit int) ([]models.Port, error) {
+	start := time.Now()
+	ports, err := r.repo.Within(ctx, box, limit)
+	r.observe("within", start, err)
+	return ports, err
+}
+
+func (r *meteredPortRepo) Search(ctx context.Context, query string, limit int) ([]models.PortMatch, error) {
+	start := time.Now()
+	matches, err := r.repo.Search(ctx, query, limit)
+	r.observe("search", start, err)
+	return matches, err
+}
+
+func (r *meteredPortRepo) Begin(ctx context.Context) (PortTransaction, error) {
+	start := time.Now()
+	tx, err := r.repo.Begin(ctx)
+	r.observe("begin", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &meteredPortTx{tx: tx, repo: r}, nil
+}
+
+// meteredPortTx observes the latency of the transaction operations, prefixed
+// by tx_
+type meteredPortTx struct {
+	tx   PortTransaction
+	repo *meteredPortRepo
+}
+
+func (tx *meteredPortTx) Create(ctx context.Context, port models.Port) error {
+	start := time.Now()
+	err := tx.tx.Create(ctx, port)
+	tx.repo.observe("tx_create", start, err)
+	return err
+}
+
+func (tx *meteredPortTx) Update(ctx context.Context, port models.Port) error {
+	start := time.Now()
+	err := tx.tx.Update(ctx, port)
+	tx.repo.observe("tx_update", start, err)
+	return err
+}
+
+func (tx *meteredPortTx) Get(ctx context.Context, unloc string) (models.Port, error) {
+	start := time.Now()
+	port, err := tx.tx.Get(ctx, unloc)
+	tx.repo.observe("tx_get", start, err)
+	return port, err
+}
+
+func (tx *meteredPortTx) Delete(ctx context.Context, unloc string) error {
+	start := time.Now()
+	err := tx.tx.Delete(ctx, unloc)
+	tx.repo.observe("tx_delete", start, err)
+	return err
+}
+
+func (tx *meteredPortTx) List(ctx context.Context, filter models.PortFilter) (models.PortPage, error) {
+	start := time.Now()
+	page, err := tx.tx.List(ctx, filter)
+	tx.repo.observe("tx_list", start, err)
+	return page, err
+}
+
+func (tx *meteredPortTx) Commit(ctx context.Context) error {
+	start := time.Now()
+	err := tx.tx.Commit(ctx)
+	tx.repo.observe("commit", start, err)
+	return err
+}
+
+func (tx *meteredPortTx) Rollback(ctx context.Context) error {
+	start := time.Now()
+	err := tx.tx.Rollback(ctx)
+	tx.repo.observe("rollback", start, err)
+	return err
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/WendelHime/ports/internal/metrics"
+	"github.com/WendelHime/ports/internal/shared/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeteredRepositoryBehaviour(t *testing.T) {
+	testRepositoryBehaviour(t, func(*testing.T) PortRepository {
+		return NewMeteredPortRepository(NewPortRepository(), metrics.NewRegistry())
+	})
+}
+
+func TestMeteredRepository(t *testing.T) {
+	ctx := context.Background()
+	reg := metrics.NewRegistry()
+	repo := NewMeteredPortRepository(NewPortRepository(), reg)
+
+	require.NoError(t, repo.Create(ctx, models.Port{Name: "Ajman", Unlocs: []string{"AEAJM"}}))
+	_, err := repo.Get(ctx, "AEAUH")
+	require.Error(t, err)
+	tx, err := repo.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.Create(ctx, models.Port{Name: "Abu Dhabi", Unlocs: []string{"AEAUH"}}))
+	require.NoError(t, tx.Commit(ctx))
+
+	w := httptest.NewRecorder()
+	metrics.Handler(reg).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	exposition := w.Body.String()
+	assert.Contains(t, exposition, "ports_repository_ports 2\n")
+	assert.Contains(t, exposition, `ports_repository_operation_duration_seconds_count{operation="create",result="ok"} 1`)
+	assert.Contains(t, exposition, `ports_repository_operation_duration_seconds_count{operation="get",result="not_found"} 1`)
+	assert.Contains(t, exposition, `ports_repository_operation_duration_seconds_count{operation="tx_create",result="ok"} 1`)
+	assert.Contains(t, exposition, `ports_repository_operation_duration_seconds_count{operation="commit",result="ok"} 1`)
+}
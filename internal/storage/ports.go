@@ -1,10 +1,12 @@
 // Package storage contains structures that communicate directly with the storage layer
 package storage
 
-//go:generate mockgen -destination=./ports_mock.go -package=storage github.com/WendelHime/ports/internal/storage PortRepository
+//go:generate mockgen -destination=./ports_mock.go -package=storage github.com/WendelHime/ports/internal/storage PortRepository,PortTransaction,PortHistory
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sync"
 
 	localErrs "github.com/WendelHime/ports/internal/shared/errors"
@@ -16,35 +18,98 @@ type PortRepository interface {
 	Create(ctx context.Context, port models.Port) error
 	Update(ctx context.Context, port models.Port) error
 	Get(ctx context.Context, unloc string) (models.Port, error)
+	// Delete removes the port stored under the unloc from every one of its unlocs
+	Delete(ctx context.Context, unloc string) error
+	// List returns the ports matching the filter ordered by their primary
+	// unloc, a filter without limit returns every remaining port at once
+	List(ctx context.Context, filter models.PortFilter) (models.PortPage, error)
+	// Count returns the amount of ports stored, each counted once whatever its
+	// amount of unlocs
+	Count(ctx context.Context) (int, error)
+	// Nearby returns the ports within the query radius ordered by distance
+	Nearby(ctx context.Context, query models.NearbyQuery) ([]models.PortDistance, error)
+	// Within returns up to limit ports inside the box ordered by their primary unloc
+	Within(ctx context.Context, box models.BoundingBox, limit int) ([]models.Port, error)
+	// Search returns up to limit ports whose name, city, alias or province
+	// match every word of the query, best matches first
+	Search(ctx context.Context, query string, limit int) ([]models.PortMatch, error)
+	// Begin starts a transaction whose writes are only visible, all at once,
+	// after being committed
+	Begin(ctx context.Context) (PortTransaction, error)
 }
 
+// PortTransaction stages writes on top of the repository, reads see the staged
+// writes. It must be finished by either Commit or Rollback and isn't safe for
+// concurrent use.
+type PortTransaction interface {
+	Create(ctx context.Context, port models.Port) error
+	Update(ctx context.Context, port models.Port) error
+	Get(ctx context.Context, unloc string) (models.Port, error)
+	Delete(ctx context.Context, unloc string) error
+	List(ctx context.Context, filter models.PortFilter) (models.PortPage, error)
+	Commit(ctx context.Context) error
+	Rollback(ctx context.Context) error
+}
+
+// ErrTxDone is returned when using a transaction already committed or rolled back
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
+
+// portChange is a single write applied to the in-memory repository
+type portChange struct {
+	Op    string      `json:"op"`
+	Port  models.Port `json:"port"`
+	Unloc string      `json:"unloc,omitempty"`
+	// Version is the version of the port deleted
+	Version int64 `json:"version,omitempty"`
+}
+
+const (
+	opPut    = "put"
+	opDelete = "delete"
+)
+
 type portRepo struct {
 	ports map[string]models.Port
-	mutex *sync.Mutex
+	// keys holds the unlocs each port is stored under, by primary unloc
+	keys   map[string][]string
+	geo    *geoIndex
+	search *searchIndex
+	mutex  *sync.Mutex
 }
 
 func NewPortRepository() PortRepository {
+	return newPortRepo()
+}
+
+func newPortRepo() *portRepo {
 	return &portRepo{
-		ports: make(map[string]models.Port),
-		mutex: new(sync.Mutex),
+		ports:  make(map[string]models.Port),
+		keys:   make(map[string][]string),
+		geo:    newGeoIndex(),
+		search: newSearchIndex(),
+		mutex:  new(sync.Mutex),
 	}
 }
 
 func (r *portRepo) Create(ctx context.Context, port models.Port) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	for _, unloc := range port.Unlocs {
-		r.ports[unloc] = port
+	err := checkWrite(port, r.get)
+	if err != nil {
+		return err
 	}
+	r.put(port)
 	return nil
 }
 
 func (r *portRepo) Update(ctx context.Context, port models.Port) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	for _, unloc := range port.Unlocs {
-		r.ports[unloc] = port
+	err := checkWrite(port, r.get)
+	if err != nil {
+		return err
 	}
+	r.put(port)
 	return nil
 }
 
@@ -56,3 +121,301 @@ func (r *portRepo) Get(ctx context.Context, unloc string) (models.Port, error) {
 	}
 	return models.Port{}, localErrs.ErrNotFound
 }
+
+func (r *portRepo) Delete(ctx context.Context, unloc string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, exists := r.ports[unloc]; !exists {
+		return localErrs.ErrNotFound
+	}
+	r.remove(unloc)
+	return nil
+}
+
+func (r *portRepo) List(ctx context.Context, filter models.PortFilter) (models.PortPage, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return listPortMap(r.ports, filter)
+}
+
+func (r *portRepo) Count(ctx context.Context) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	count := 0
+	for primary := range r.keys {
+		if primaryUnloc(r.ports[primary]) == primary {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *portRepo) Nearby(ctx context.Context, query models.NearbyQuery) ([]models.PortDistance, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	hits := r.geo.nearby(query.Latitude, query.Longitude, query.RadiusKm)
+	if query.Limit > 0 && len(hits) > query.Limit {
+		hits = hits[:query.Limit]
+	}
+	ports := make([]models.PortDistance, 0, len(hits))
+	for _, hit := range hits {
+		ports = append(ports, models.PortDistance{Port: r.ports[hit.unloc], DistanceKm: hit.distanceKm})
+	}
+	return ports, nil
+}
+
+func (r *portRepo) Within(ctx context.Context, box models.BoundingBox, limit int) ([]models.Port, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	unlocs := r.geo.within(box)
+	if limit > 0 && len(unlocs) > limit {
+		unlocs = unlocs[:limit]
+	}
+	ports := make([]models.Port, 0, len(unlocs))
+	for _, unloc := range unlocs {
+		ports = append(ports, r.ports[unloc])
+	}
+	return ports, nil
+}
+
+func (r *portRepo) Search(ctx context.Context, query string, limit int) ([]models.PortMatch, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	hits := r.search.search(query)
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	ports := make([]models.PortMatch, 0, len(hits))
+	for _, hit := range hits {
+		ports = append(ports, models.PortMatch{Port: r.ports[hit.unloc], Score: hit.score})
+	}
+	return ports, nil
+}
+
+func (r *portRepo) Begin(ctx context.Context) (PortTransaction, error) {
+	return newPortTx(r, r.commit), nil
+}
+
+// commit applies every change at once, none when a concurrent write conflicts
+// with them
+func (r *portRepo) commit(ctx context.Context, changes []portChange) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	err := r.revalidate(changes)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		r.apply(change)
+	}
+	return nil
+}
+
+// apply executes the change, the caller must hold the mutex
+func (r *portRepo) apply(change portChange) {
+	switch change.Op {
+	case opPut:
+		r.put(change.Port)
+	case opDelete:
+		r.remove(change.Unloc)
+	}
+}
+
+// revalidate replays the changes staged by a transaction over the stored
+// ports, failing when a port they write was written since they were staged or
+// one of its unlocs was taken by another port. The caller must hold the mutex.
+func (r *portRepo) revalidate(changes []portChange) error {
+	staged := make(map[string]*models.Port)
+	get := func(unloc string) (models.Port, bool) {
+		if port, exists := staged[unloc]; exists {
+			if port == nil {
+				return models.Port{}, false
+			}
+			return *port, true
+		}
+		return r.get(unloc)
+	}
+
+	for _, change := range changes {
+		switch change.Op {
+		case opPut:
+			port := change.Port
+			stored, exists := get(primaryUnloc(port))
+			// the staged version is the next one of the port it was written over
+			if nextVersion(stored) != port.Version {
+				return concurrentWrite(primaryUnloc(port))
+			}
+			err := checkOwners(port, get)
+			if err != nil {
+				return err
+			}
+			if exists {
+				for _, unloc := range stored.Unlocs {
+					if !containsString(port.Unlocs, unloc) {
+						staged[unloc] = nil
+					}
+				}
+			}
+			for _, unloc := range port.Unlocs {
+				staged[unloc] = &port
+			}
+		case opDelete:
+			stored, exists := get(change.Unloc)
+			if !exists || stored.Version != change.Version {
+				return concurrentWrite(change.Unloc)
+			}
+			for _, unloc := range stored.Unlocs {
+				staged[unloc] = nil
+			}
+			staged[change.Unloc] = nil
+		}
+	}
+	return nil
+}
+
+// get returns the port stored under the unloc, the caller must hold the mutex
+func (r *portRepo) get(unloc string) (models.Port, bool) {
+	port, exists := r.ports[unloc]
+	return port, exists
+}
+
+// put stores the port under each one of its unlocs, removing the unlocs it
+// was previously stored under and no longer has. The caller must hold the mutex.
+func (r *portRepo) put(port models.Port) {
+	primary := primaryUnloc(port)
+	port.Version = nextVersion(r.ports[primary])
+	for _, unloc := range r.keys[primary] {
+		if !containsString(port.Unlocs, unloc) {
+			delete(r.ports, unloc)
+			r.unindex(unloc)
+		}
+	}
+	for _, unloc := range port.Unlocs {
+		// an unloc taken from another port, only found replaying a log
+		// written before the commits were revalidated
+		if owner := primaryUnloc(r.ports[unloc]); owner != "" && owner != primary {
+			r.keys[owner] = removeString(r.keys[owner], unloc)
+		}
+		r.ports[unloc] = port
+		r.unindex(unloc)
+	}
+	if primary != "" {
+		r.keys[primary] = append([]string(nil), port.Unlocs...)
+	}
+	r.index(port)
+}
+
+// remove deletes the port stored under the unloc from each one of its unlocs,
+// the caller must hold the mutex
+func (r *portRepo) remove(unloc string) {
+	primary := primaryUnloc(r.ports[unloc])
+	for _, other := range r.keys[primary] {
+		delete(r.ports, other)
+		r.unindex(other)
+	}
+	delete(r.keys, primary)
+	delete(r.ports, unloc)
+	r.unindex(unloc)
+}
+
+// restore replaces every stored port and rebuilds the indexes, the caller
+// must hold the mutex
+func (r *portRepo) restore(ports map[string]models.Port) {
+	r.ports = ports
+	r.keys = make(map[string][]string)
+	r.geo = newGeoIndex()
+	r.search = newSearchIndex()
+	for unloc, port := range ports {
+		primary := primaryUnloc(port)
+		r.keys[primary] = append(r.keys[primary], unloc)
+		if unloc == primary {
+			r.index(port)
+		}
+	}
+}
+
+// index adds the port to the indexes under its primary unloc, the caller must
+// hold the mutex
+func (r *portRepo) index(port models.Port) {
+	unloc := primaryUnloc(port)
+	if unloc == "" {
+		return
+	}
+	if lon, lat, ok := portLocation(port); ok {
+		r.geo.set(unloc, lon, lat)
+	}
+	r.search.set(unloc, port)
+}
+
+// checkWrite returns a conflict when one of the port unlocs already belongs
+// to another port, and a failed precondition when the port has a version
+// other than the stored one. get returns the port stored under an unloc.
+func checkWrite(port models.Port, get func(unloc string) (models.Port, bool)) error {
+	primary := primaryUnloc(port)
+	if port.Version != 0 {
+		stored, exists := get(primary)
+		if !exists || stored.Version != port.Version {
+			return versionMismatch(port)
+		}
+	}
+	return checkOwners(port, get)
+}
+
+// checkOwners returns a conflict when one of the port unlocs already belongs
+// to another port
+func checkOwners(port models.Port, get func(unloc string) (models.Port, bool)) error {
+	primary := primaryUnloc(port)
+	for _, unloc := range port.Unlocs {
+		stored, exists := get(unloc)
+		if !exists {
+			continue
+		}
+		if owner := primaryUnloc(stored); owner != primary {
+			return localErrs.New(localErrs.CodeConflict, fmt.Sprintf("unloc %s already belongs to the port %s", unloc, owner))
+		}
+	}
+	return nil
+}
+
+// nextVersion is the version of a port written over the stored one, the
+// stored port being the zero value when there is none
+func nextVersion(stored models.Port) int64 {
+	return stored.Version + 1
+}
+
+// concurrentWrite is returned when committing a transaction writing a port
+// written since
+func concurrentWrite(unloc string) error {
+	return localErrs.New(localErrs.CodePreconditionFailed, fmt.Sprintf("port %s was written since the transaction read it", unloc))
+}
+
+// versionMismatch is returned when the port version isn't the stored one
+func versionMismatch(port models.Port) error {
+	return localErrs.New(localErrs.CodePreconditionFailed, fmt.Sprintf("port %s isn't on version %d", primaryUnloc(port), port.Version))
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func removeString(values []string, value string) []string {
+	kept := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != value {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// unindex removes the port stored under the unloc from the indexes, the caller
+// must hold the mutex
+func (r *portRepo) unindex(unloc string) {
+	r.geo.remove(unloc)
+	r.search.remove(unloc)
+}
@@ -0,0 +1,383 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/WendelHime/ports/internal/logging"
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/WendelHime/ports/internal/shared/models"
+)
+
+const (
+	walFileName      = "ports.wal"
+	snapshotFileName = "ports.snapshot"
+
+	// DefaultCompactEvery is the amount of log records written before the log
+	// is compacted into a new snapshot
+	DefaultCompactEvery = 1000
+)
+
+// walRecord is a single line of the write-ahead log, either a change or a
+// batch of changes committed by a transaction along their audit entries
+type walRecord struct {
+	portChange
+	Changes []portChange `json:"changes,omitempty"`
+	// Audit holds the audit entries appended, keeping the latest Retention
+	// ones of each port, to the trail started at Since
+	Audit     []models.AuditEntry `json:"audit,omitempty"`
+	Retention int                 `json:"retention,omitempty"`
+	Since     *time.Time          `json:"since,omitempty"`
+}
+
+const (
+	walOpBatch = "batch"
+	// walOpAudit records only hold audit entries, written apart from their
+	// changes by the logs before the entries were batched with them
+	walOpAudit = "audit"
+)
+
+// snapshotVersion tells the snapshots holding the audit trail from the ones
+// written before, which only hold the ports
+const snapshotVersion = 2
+
+// fileSnapshot is the content of the snapshot file
+type fileSnapshot struct {
+	Version int                    `json:"version"`
+	Ports   map[string]models.Port `json:"ports"`
+	Audit   AuditTrail             `json:"audit"`
+}
+
+// filePortRepo keeps the ports in memory like portRepo, but every write is
+// appended to a write-ahead log before being applied. The log is compacted
+// into a snapshot every compactEvery records, and both are replayed on startup.
+// It's an AuditStore too, the audit entries being appended to the same log
+// records as their changes and kept in memory on the log shared with the
+// audited repository.
+type filePortRepo struct {
+	*portRepo
+	audit        *auditLog
+	dir          string
+	wal          *os.File
+	walRecords   int
+	compactEvery int
+}
+
+// NewFilePortRepository opens (or creates) a file backed repository under dir,
+// restoring its content from the latest snapshot and write-ahead log. The
+// returned repository implements io.Closer and should be closed on shutdown.
+func NewFilePortRepository(dir string, compactEvery int) (PortRepository, error) {
+	if compactEvery <= 0 {
+		compactEvery = DefaultCompactEvery
+	}
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create data directory")
+	}
+
+	r := &filePortRepo{
+		portRepo:     newPortRepo(),
+		audit:        newAuditLog(0, time.Time{}),
+		dir:          dir,
+		compactEvery: compactEvery,
+	}
+
+	err = r.loadSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	r.wal, err = os.OpenFile(filepath.Join(dir, walFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open write-ahead log")
+	}
+	err = r.replay()
+	if err != nil {
+		r.wal.Close()
+		return nil, err
+	}
+	if r.audit.since.IsZero() {
+		// the trail starts now, which is stored along its first entries
+		r.audit.since = time.Now()
+	}
+	return r, nil
+}
+
+func (r *filePortRepo) Create(ctx context.Context, port models.Port) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	err := checkWrite(port, r.get)
+	if err != nil {
+		return err
+	}
+	return r.write(ctx, walRecord{portChange: portChange{Op: opPut, Port: port}})
+}
+
+func (r *filePortRepo) Update(ctx context.Context, port models.Port) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	err := checkWrite(port, r.get)
+	if err != nil {
+		return err
+	}
+	return r.write(ctx, walRecord{portChange: portChange{Op: opPut, Port: port}})
+}
+
+func (r *filePortRepo) Delete(ctx context.Context, unloc string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, exists := r.ports[unloc]; !exists {
+		return localErrs.ErrNotFound
+	}
+	return r.write(ctx, walRecord{portChange: portChange{Op: opDelete, Unloc: unloc}})
+}
+
+func (r *filePortRepo) Begin(ctx context.Context) (PortTransaction, error) {
+	return newPortTx(r.portRepo, func(ctx context.Context, changes []portChange) error {
+		return r.commit(ctx, changes, nil, 0)
+	}), nil
+}
+
+func (r *filePortRepo) BeginAudit(ctx context.Context) (AuditTransaction, error) {
+	tx := &fileAuditTx{}
+	tx.portTx = newPortTx(r.portRepo, func(ctx context.Context, changes []portChange) error {
+		return r.commit(ctx, changes, tx.audit, tx.retention)
+	})
+	return tx, nil
+}
+
+// commit appends the changes and their audit entries to the log as a single
+// record, so a crash while writing it discards the whole transaction on
+// replay. Nothing is written when a concurrent write conflicts with the
+// changes.
+func (r *filePortRepo) commit(ctx context.Context, changes []portChange, audit []models.AuditEntry, retention int) error {
+	if len(changes) == 0 && len(audit) == 0 {
+		return nil
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	err := r.revalidate(changes)
+	if err != nil {
+		return err
+	}
+	record := walRecord{portChange: portChange{Op: walOpBatch}, Changes: changes}
+	if len(audit) > 0 {
+		since := r.audit.since
+		record.Audit, record.Retention, record.Since = audit, retention, &since
+	}
+	return r.write(ctx, record)
+}
+
+func (r *filePortRepo) auditLog() *auditLog {
+	return r.audit
+}
+
+func (r *filePortRepo) LoadAudit(ctx context.Context) (AuditTrail, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.audit.trail(), nil
+}
+
+// Close compacts the log into a snapshot and releases the log file
+func (r *filePortRepo) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	err := r.compact()
+	if err != nil {
+		return err
+	}
+	return r.wal.Close()
+}
+
+// write appends the record to the log, flushing it to the disk so it survives
+// a crash once acknowledged, and then applies it in memory. The record is
+// durable by then, so a failed compaction is only logged and retried after
+// another compactEvery records. The caller must hold the mutex.
+func (r *filePortRepo) write(ctx context.Context, record walRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode log record")
+	}
+	_, err = r.wal.Write(append(line, '\n'))
+	if err != nil {
+		return errors.Wrap(err, "failed to append log record")
+	}
+	err = r.wal.Sync()
+	if err != nil {
+		return errors.Wrap(err, "failed to flush log record")
+	}
+	r.applyRecord(record)
+
+	r.walRecords++
+	if r.walRecords >= r.compactEvery {
+		err = r.compact()
+		if err != nil {
+			r.walRecords = 0
+			logging.FromContext(ctx).Error("failed to compact write-ahead log", "error", err.Error())
+		}
+	}
+	return nil
+}
+
+func (r *filePortRepo) applyRecord(record walRecord) {
+	switch record.Op {
+	case walOpBatch, walOpAudit:
+		for _, change := range record.Changes {
+			r.apply(change)
+		}
+		if len(record.Audit) == 0 {
+			return
+		}
+		if r.audit.since.IsZero() && record.Since != nil {
+			r.audit.since = *record.Since
+		}
+		r.audit.appendRetaining(record.Retention, record.Audit...)
+	default:
+		r.apply(record.portChange)
+	}
+}
+
+// fileAuditTx stages the audit entries of a transaction, written on the same
+// log record as its changes
+type fileAuditTx struct {
+	*portTx
+	audit     []models.AuditEntry
+	retention int
+}
+
+func (tx *fileAuditTx) AppendAudit(ctx context.Context, entries []models.AuditEntry, retention int) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.audit = append(tx.audit, entries...)
+	tx.retention = retention
+	return nil
+}
+
+// compact writes the current state into a new snapshot and truncates the log,
+// the caller must hold the mutex. The snapshot is renamed into place before the
+// log is truncated so a crash in between only replays records already applied.
+func (r *filePortRepo) compact() error {
+	tmpPath := filepath.Join(r.dir, snapshotFileName+".tmp")
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to create snapshot")
+	}
+	w := bufio.NewWriter(f)
+	err = json.NewEncoder(w).Encode(fileSnapshot{Version: snapshotVersion, Ports: r.ports, Audit: r.audit.trail()})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return errors.Wrap(err, "failed to write snapshot")
+	}
+
+	err = os.Rename(tmpPath, filepath.Join(r.dir, snapshotFileName))
+	if err != nil {
+		return errors.Wrap(err, "failed to replace snapshot")
+	}
+
+	err = r.wal.Truncate(0)
+	if err != nil {
+		return errors.Wrap(err, "failed to truncate write-ahead log")
+	}
+	_, err = r.wal.Seek(0, io.SeekStart)
+	if err != nil {
+		return errors.Wrap(err, "failed to rewind write-ahead log")
+	}
+	r.walRecords = 0
+	return nil
+}
+
+func (r *filePortRepo) loadSnapshot() error {
+	f, err := os.Open(filepath.Join(r.dir, snapshotFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to open snapshot")
+	}
+	defer f.Close()
+
+	var raw map[string]json.RawMessage
+	err = json.NewDecoder(bufio.NewReader(f)).Decode(&raw)
+	if err != nil {
+		return errors.Wrap(err, "failed to decode snapshot")
+	}
+	var snapshot fileSnapshot
+	if _, versioned := raw["version"]; versioned {
+		err = json.Unmarshal(raw["ports"], &snapshot.Ports)
+		if err == nil {
+			err = json.Unmarshal(raw["audit"], &snapshot.Audit)
+		}
+	} else {
+		// written before the audit trail was persisted, only holding the ports
+		snapshot.Ports = make(map[string]models.Port, len(raw))
+		for unloc, port := range raw {
+			var decoded models.Port
+			err = json.Unmarshal(port, &decoded)
+			if err != nil {
+				break
+			}
+			snapshot.Ports[unloc] = decoded
+		}
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to decode snapshot")
+	}
+	r.restore(snapshot.Ports)
+	r.audit = restoreAuditLog(0, snapshot.Audit)
+	return nil
+}
+
+// replay applies every complete record of the log. A partially written last
+// record, left behind by a crash during an append, is discarded.
+func (r *filePortRepo) replay() error {
+	reader := bufio.NewReader(r.wal)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read write-ahead log")
+		}
+
+		var record walRecord
+		err = json.Unmarshal(bytes.TrimSpace(line), &record)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("corrupted write-ahead log record at offset %d", offset))
+		}
+		r.applyRecord(record)
+		r.walRecords++
+		offset += int64(len(line))
+	}
+
+	err := r.wal.Truncate(offset)
+	if err != nil {
+		return errors.Wrap(err, "failed to truncate write-ahead log")
+	}
+	_, err = r.wal.Seek(offset, io.SeekStart)
+	if err != nil {
+		return errors.Wrap(err, "failed to seek write-ahead log")
+	}
+	return nil
+}
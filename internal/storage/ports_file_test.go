@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/WendelHime/ports/internal/shared/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFileRepository(t *testing.T, dir string, compactEvery int) PortRepository {
+	repo, err := NewFilePortRepository(dir, compactEvery)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = repo.(io.Closer).Close()
+	})
+	return repo
+}
+
+func TestFileRepositoryBehaviour(t *testing.T) {
+	testRepositoryBehaviour(t, func(t *testing.T) PortRepository {
+		return newTestFileRepository(t, t.TempDir(), DefaultCompactEvery)
+	})
+}
+
+func TestFileRepositoryRestore(t *testing.T) {
+	ctx := context.Background()
+	var tests = []struct {
+		name   string
+		assert func(t *testing.T, dir string, repo PortRepository)
+		setup  func(t *testing.T, dir string)
+	}{
+		{
+			name: "Ports written to the log should be replayed",
+			assert: func(t *testing.T, dir string, repo PortRepository) {
+				port, err := repo.Get(ctx, "UNLOC")
+				assert.NoError(t, err)
+				assert.Equal(t, "updated", port.Code)
+			},
+			setup: func(t *testing.T, dir string) {
+				repo, err := NewFilePortRepository(dir, DefaultCompactEvery)
+				require.NoError(t, err)
+				assert.NoError(t, repo.Create(ctx, models.Port{Code: "created", Unlocs: []string{"UNLOC"}}))
+				assert.NoError(t, repo.Update(ctx, models.Port{Code: "updated", Unlocs: []string{"UNLOC"}}))
+				// simulating a crash, the log is never compacted
+				assert.NoError(t, repo.(*filePortRepo).wal.Close())
+			},
+		},
+		{
+			name: "Deleted ports should stay deleted after replay",
+			assert: func(t *testing.T, dir string, repo PortRepository) {
+				_, err := repo.Get(ctx, "UNLOC")
+				assert.ErrorIs(t, err, localErrs.ErrNotFound)
+			},
+			setup: func(t *testing.T, dir string) {
+				repo, err := NewFilePortRepository(dir, DefaultCompactEvery)
+				require.NoError(t, err)
+				assert.NoError(t, repo.Create(ctx, models.Port{Unlocs: []string{"UNLOC"}}))
+				assert.NoError(t, repo.Delete(ctx, "UNLOC"))
+				assert.NoError(t, repo.(*filePortRepo).wal.Close())
+			},
+		},
+		{
+			name: "Ports compacted into the snapshot should be restored",
+			assert: func(t *testing.T, dir string, repo PortRepository) {
+				for _, unloc := range []string{"UNLOC1", "UNLOC2", "UNLOC3"} {
+					_, err := repo.Get(ctx, unloc)
+					assert.NoError(t, err)
+				}
+				assert.FileExists(t, filepath.Join(dir, snapshotFileName))
+			},
+			setup: func(t *testing.T, dir string) {
+				repo, err := NewFilePortRepository(dir, 2)
+				require.NoError(t, err)
+				assert.NoError(t, repo.Create(ctx, models.Port{Unlocs: []string{"UNLOC1"}}))
+				assert.NoError(t, repo.Create(ctx, models.Port{Unlocs: []string{"UNLOC2"}}))
+				assert.NoError(t, repo.Create(ctx, models.Port{Unlocs: []string{"UNLOC3"}}))
+				assert.NoError(t, repo.(*filePortRepo).wal.Close())
+
+				info, err := os.Stat(filepath.Join(dir, walFileName))
+				assert.NoError(t, err)
+				assert.NotZero(t, info.Size(), "last record should only be in the log")
+			},
+		},
+		{
+			name: "Committed transaction should be replayed",
+			assert: func(t *testing.T, dir string, repo PortRepository) {
+				_, err := repo.Get(ctx, "CREATED")
+				assert.NoError(t, err)
+				_, err = repo.Get(ctx, "DELETED")
+				assert.ErrorIs(t, err, localErrs.ErrNotFound)
+				_, err = repo.Get(ctx, "ROLLEDBACK")
+				assert.ErrorIs(t, err, localErrs.ErrNotFound)
+			},
+			setup: func(t *testing.T, dir string) {
+				repo, err := NewFilePortRepository(dir, DefaultCompactEvery)
+				require.NoError(t, err)
+				assert.NoError(t, repo.Create(ctx, models.Port{Unlocs: []string{"DELETED"}}))
+
+				tx, err := repo.Begin(ctx)
+				require.NoError(t, err)
+				assert.NoError(t, tx.Create(ctx, models.Port{Unlocs: []string{"CREATED"}}))
+				assert.NoError(t, tx.Delete(ctx, "DELETED"))
+				assert.NoError(t, tx.Commit(ctx))
+
+				tx, err = repo.Begin(ctx)
+				require.NoError(t, err)
+				assert.NoError(t, tx.Create(ctx, models.Port{Unlocs: []string{"ROLLEDBACK"}}))
+				assert.NoError(t, tx.Rollback(ctx))
+				assert.NoError(t, repo.(*filePortRepo).wal.Close())
+			},
+		},
+		{
+			name: "Partially written record should be discarded",
+			assert: func(t *testing.T, dir string, repo PortRepository) {
+				_, err := repo.Get(ctx, "UNLOC")
+				assert.NoError(t, err)
+				assert.NoError(t, repo.Create(ctx, models.Port{Unlocs: []string{"OTHER"}}))
+				_, err = repo.Get(ctx, "OTHER")
+				assert.NoError(t, err)
+			},
+			setup: func(t *testing.T, dir string) {
+				repo, err := NewFilePortRepository(dir, DefaultCompactEvery)
+				require.NoError(t, err)
+				assert.NoError(t, repo.Create(ctx, models.Port{Unlocs: []string{"UNLOC"}}))
+				_, err = repo.(*filePortRepo).wal.WriteString(`{"op":"put","port":{"unlo`)
+				assert.NoError(t, err)
+				assert.NoError(t, repo.(*filePortRepo).wal.Close())
+			},
+		},
+		{
+			name: "Snapshot holding only the ports should be restored",
+			assert: func(t *testing.T, dir string, repo PortRepository) {
+				port, err := repo.Get(ctx, "OTHER")
+				assert.NoError(t, err)
+				assert.Equal(t, "legacy", port.Name)
+				trail, err := repo.(AuditStore).LoadAudit(ctx)
+				assert.NoError(t, err)
+				assert.Empty(t, trail.Entries)
+				assert.False(t, trail.Since.IsZero())
+			},
+			setup: func(t *testing.T, dir string) {
+				port := `{"name":"legacy","unlocs":["UNLOC","OTHER"]}`
+				snapshot := `{"UNLOC":` + port + `,"OTHER":` + port + `}`
+				assert.NoError(t, os.WriteFile(filepath.Join(dir, snapshotFileName), []byte(snapshot), 0o644))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.setup(t, dir)
+			repo := newTestFileRepository(t, dir, DefaultCompactEvery)
+			tt.assert(t, dir, repo)
+		})
+	}
+}
+
+func TestFileRepositoryCompactionFailure(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	repo := newTestFileRepository(t, dir, 1)
+	// the snapshot can't be written while a directory takes its place
+	tmpPath := filepath.Join(dir, snapshotFileName+".tmp")
+	require.NoError(t, os.Mkdir(tmpPath, 0o755))
+
+	assert.NoError(t, repo.Create(ctx, models.Port{Unlocs: []string{"UNLOC"}}))
+	_, err := repo.Get(ctx, "UNLOC")
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, snapshotFileName))
+	assert.True(t, os.IsNotExist(err))
+
+	require.NoError(t, os.Remove(tmpPath))
+	assert.NoError(t, repo.Create(ctx, models.Port{Unlocs: []string{"OTHER"}}))
+	_, err = os.Stat(filepath.Join(dir, snapshotFileName))
+	assert.NoError(t, err)
+}
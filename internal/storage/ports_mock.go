@@ -1,5 +1,5 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: github.com/WendelHime/ports/internal/storage (interfaces: PortRepository)
+// Source: github.com/WendelHime/ports/internal/storage (interfaces: PortRepository,PortTransaction,PortHistory)
 
 // Package storage is a generated GoMock package.
 package storage
@@ -7,6 +7,7 @@ package storage
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	models "github.com/WendelHime/ports/internal/shared/models"
 	gomock "github.com/golang/mock/gomock"
@@ -35,6 +36,36 @@ func (m *MockPortRepository) EXPECT() *MockPortRepositoryMockRecorder {
 	return m.recorder
 }
 
+// Begin mocks base method.
+func (m *MockPortRepository) Begin(arg0 context.Context) (PortTransaction, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Begin", arg0)
+	ret0, _ := ret[0].(PortTransaction)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Begin indicates an expected call of Begin.
+func (mr *MockPortRepositoryMockRecorder) Begin(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Begin", reflect.TypeOf((*MockPortRepository)(nil).Begin), arg0)
+}
+
+// Count mocks base method.
+func (m *MockPortRepository) Count(arg0 context.Context) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Count", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Count indicates an expected call of Count.
+func (mr *MockPortRepositoryMockRecorder) Count(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Count", reflect.TypeOf((*MockPortRepository)(nil).Count), arg0)
+}
+
 // Create mocks base method.
 func (m *MockPortRepository) Create(arg0 context.Context, arg1 models.Port) error {
 	m.ctrl.T.Helper()
@@ -49,6 +80,20 @@ func (mr *MockPortRepositoryMockRecorder) Create(arg0, arg1 interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockPortRepository)(nil).Create), arg0, arg1)
 }
 
+// Delete mocks base method.
+func (m *MockPortRepository) Delete(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockPortRepositoryMockRecorder) Delete(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockPortRepository)(nil).Delete), arg0, arg1)
+}
+
 // Get mocks base method.
 func (m *MockPortRepository) Get(arg0 context.Context, arg1 string) (models.Port, error) {
 	m.ctrl.T.Helper()
@@ -64,6 +109,51 @@ func (mr *MockPortRepositoryMockRecorder) Get(arg0, arg1 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockPortRepository)(nil).Get), arg0, arg1)
 }
 
+// List mocks base method.
+func (m *MockPortRepository) List(arg0 context.Context, arg1 models.PortFilter) (models.PortPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", arg0, arg1)
+	ret0, _ := ret[0].(models.PortPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockPortRepositoryMockRecorder) List(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockPortRepository)(nil).List), arg0, arg1)
+}
+
+// Nearby mocks base method.
+func (m *MockPortRepository) Nearby(arg0 context.Context, arg1 models.NearbyQuery) ([]models.PortDistance, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Nearby", arg0, arg1)
+	ret0, _ := ret[0].([]models.PortDistance)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Nearby indicates an expected call of Nearby.
+func (mr *MockPortRepositoryMockRecorder) Nearby(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Nearby", reflect.TypeOf((*MockPortRepository)(nil).Nearby), arg0, arg1)
+}
+
+// Search mocks base method.
+func (m *MockPortRepository) Search(arg0 context.Context, arg1 string, arg2 int) ([]models.PortMatch, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Search", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]models.PortMatch)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Search indicates an expected call of Search.
+func (mr *MockPortRepositoryMockRecorder) Search(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockPortRepository)(nil).Search), arg0, arg1, arg2)
+}
+
 // Update mocks base method.
 func (m *MockPortRepository) Update(arg0 context.Context, arg1 models.Port) error {
 	m.ctrl.T.Helper()
@@ -77,3 +167,209 @@ func (mr *MockPortRepositoryMockRecorder) Update(arg0, arg1 interface{}) *gomock
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockPortRepository)(nil).Update), arg0, arg1)
 }
+
+// Within mocks base method.
+func (m *MockPortRepository) Within(arg0 context.Context, arg1 models.BoundingBox, arg2 int) ([]models.Port, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Within", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]models.Port)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Within indicates an expected call of Within.
+func (mr *MockPortRepositoryMockRecorder) Within(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Within", reflect.TypeOf((*MockPortRepository)(nil).Within), arg0, arg1, arg2)
+}
+
+// MockPortTransaction is a mock of PortTransaction interface.
+type MockPortTransaction struct {
+	ctrl     *gomock.Controller
+	recorder *MockPortTransactionMockRecorder
+}
+
+// MockPortTransactionMockRecorder is the mock recorder for MockPortTransaction.
+type MockPortTransactionMockRecorder struct {
+	mock *MockPortTransaction
+}
+
+// NewMockPortTransaction creates a new mock instance.
+func NewMockPortTransaction(ctrl *gomock.Controller) *MockPortTransaction {
+	mock := &MockPortTransaction{ctrl: ctrl}
+	mock.recorder = &MockPortTransactionMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPortTransaction) EXPECT() *MockPortTransactionMockRecorder {
+	return m.recorder
+}
+
+// Commit mocks base method.
+func (m *MockPortTransaction) Commit(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Commit", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Commit indicates an expected call of Commit.
+func (mr *MockPortTransactionMockRecorder) Commit(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Commit", reflect.TypeOf((*MockPortTransaction)(nil).Commit), arg0)
+}
+
+// Create mocks base method.
+func (m *MockPortTransaction) Create(arg0 context.Context, arg1 models.Port) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockPortTransactionMockRecorder) Create(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockPortTransaction)(nil).Create), arg0, arg1)
+}
+
+// Delete mocks base method.
+func (m *MockPortTransaction) Delete(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockPortTransactionMockRecorder) Delete(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockPortTransaction)(nil).Delete), arg0, arg1)
+}
+
+// Get mocks base method.
+func (m *MockPortTransaction) Get(arg0 context.Context, arg1 string) (models.Port, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", arg0, arg1)
+	ret0, _ := ret[0].(models.Port)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockPortTransactionMockRecorder) Get(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockPortTransaction)(nil).Get), arg0, arg1)
+}
+
+// List mocks base method.
+func (m *MockPortTransaction) List(arg0 context.Context, arg1 models.PortFilter) (models.PortPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", arg0, arg1)
+	ret0, _ := ret[0].(models.PortPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockPortTransactionMockRecorder) List(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockPortTransaction)(nil).List), arg0, arg1)
+}
+
+// Rollback mocks base method.
+func (m *MockPortTransaction) Rollback(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rollback", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Rollback indicates an expected call of Rollback.
+func (mr *MockPortTransactionMockRecorder) Rollback(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rollback", reflect.TypeOf((*MockPortTransaction)(nil).Rollback), arg0)
+}
+
+// Update mocks base method.
+func (m *MockPortTransaction) Update(arg0 context.Context, arg1 models.Port) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockPortTransactionMockRecorder) Update(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockPortTransaction)(nil).Update), arg0, arg1)
+}
+
+// MockPortHistory is a mock of PortHistory interface.
+type MockPortHistory struct {
+	ctrl     *gomock.Controller
+	recorder *MockPortHistoryMockRecorder
+}
+
+// MockPortHistoryMockRecorder is the mock recorder for MockPortHistory.
+type MockPortHistoryMockRecorder struct {
+	mock *MockPortHistory
+}
+
+// NewMockPortHistory creates a new mock instance.
+func NewMockPortHistory(ctrl *gomock.Controller) *MockPortHistory {
+	mock := &MockPortHistory{ctrl: ctrl}
+	mock.recorder = &MockPortHistoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPortHistory) EXPECT() *MockPortHistoryMockRecorder {
+	return m.recorder
+}
+
+// History mocks base method.
+func (m *MockPortHistory) History(arg0 context.Context, arg1 string) ([]models.AuditEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "History", arg0, arg1)
+	ret0, _ := ret[0].([]models.AuditEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// History indicates an expected call of History.
+func (mr *MockPortHistoryMockRecorder) History(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "History", reflect.TypeOf((*MockPortHistory)(nil).History), arg0, arg1)
+}
+
+// PortAt mocks base method.
+func (m *MockPortHistory) PortAt(arg0 context.Context, arg1 string, arg2 time.Time) (models.Port, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PortAt", arg0, arg1, arg2)
+	ret0, _ := ret[0].(models.Port)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PortAt indicates an expected call of PortAt.
+func (mr *MockPortHistoryMockRecorder) PortAt(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PortAt", reflect.TypeOf((*MockPortHistory)(nil).PortAt), arg0, arg1, arg2)
+}
+
+// PortsAt mocks base method.
+func (m *MockPortHistory) PortsAt(arg0 context.Context, arg1 time.Time) ([]models.Port, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PortsAt", arg0, arg1)
+	ret0, _ := ret[0].([]models.Port)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PortsAt indicates an expected call of PortsAt.
+func (mr *MockPortHistoryMockRecorder) PortsAt(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PortsAt", reflect.TypeOf((*MockPortHistory)(nil).PortsAt), arg0, arg1)
+}
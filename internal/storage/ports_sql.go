@@ -0,0 +1,851 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/WendelHime/ports/internal/shared/models"
+)
+
+// migrations holds the schema changes applied in order at startup, new
+// migrations must always be appended to the end of the list
+var migrations = []string{
+	`CREATE TABLE ports (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		city TEXT NOT NULL,
+		country TEXT NOT NULL,
+		province TEXT NOT NULL,
+		timezone TEXT NOT NULL,
+		code TEXT NOT NULL
+	);
+	CREATE TABLE port_unlocs (
+		unloc TEXT PRIMARY KEY,
+		port_id INTEGER NOT NULL REFERENCES ports (id),
+		position INTEGER NOT NULL
+	);
+	CREATE INDEX port_unlocs_port_id ON port_unlocs (port_id);
+	CREATE TABLE port_aliases (
+		port_id INTEGER NOT NULL REFERENCES ports (id),
+		position INTEGER NOT NULL,
+		alias TEXT NOT NULL,
+		PRIMARY KEY (port_id, position)
+	);
+	CREATE TABLE port_regions (
+		port_id INTEGER NOT NULL REFERENCES ports (id),
+		position INTEGER NOT NULL,
+		region TEXT NOT NULL,
+		PRIMARY KEY (port_id, position)
+	);
+	CREATE TABLE port_coordinates (
+		port_id INTEGER NOT NULL REFERENCES ports (id),
+		position INTEGER NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (port_id, position)
+	);`,
+	`ALTER TABLE ports ADD COLUMN longitude REAL;
+	ALTER TABLE ports ADD COLUMN latitude REAL;
+	CREATE INDEX ports_location ON ports (latitude, longitude);`,
+	`CREATE TABLE port_terms (
+		term TEXT NOT NULL,
+		port_id INTEGER NOT NULL REFERENCES ports (id),
+		weight REAL NOT NULL,
+		PRIMARY KEY (term, port_id)
+	);
+	CREATE INDEX port_terms_port_id ON port_terms (port_id);`,
+	`ALTER TABLE ports ADD COLUMN unloc TEXT NOT NULL DEFAULT '';
+	UPDATE ports SET unloc = COALESCE((SELECT unloc FROM port_unlocs WHERE port_id = ports.id AND position = 0), '');`,
+	`ALTER TABLE ports ADD COLUMN version INTEGER NOT NULL DEFAULT 1;`,
+	`CREATE INDEX port_terms_length ON port_terms (length(term));`,
+	`CREATE TABLE audit (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		unloc TEXT NOT NULL,
+		entry TEXT NOT NULL
+	);
+	CREATE INDEX audit_unloc ON audit (unloc, id);
+	CREATE TABLE audit_trimmed (unloc TEXT PRIMARY KEY);
+	CREATE TABLE audit_since (since TEXT NOT NULL);
+	INSERT INTO audit_since (since) VALUES (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'));`,
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// sqlPortRepo stores ports on a normalized schema through database/sql. The
+// queries are written for SQLite, which is the driver used by the application.
+// It's an AuditStore too, keeping the audit entries on the audit table.
+type sqlPortRepo struct {
+	db *sql.DB
+}
+
+// NewSQLPortRepository returns a repository backed by db, running any pending
+// schema migration before returning
+func NewSQLPortRepository(db *sql.DB) (PortRepository, error) {
+	r := &sqlPortRepo{db: db}
+	err := r.migrate(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *sqlPortRepo) migrate(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+	if err != nil {
+		return errors.Wrap(err, "failed to create migrations table")
+	}
+
+	var version int
+	err = r.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve schema version")
+	}
+
+	for i := version; i < len(migrations); i++ {
+		err = r.inTx(ctx, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, migrations[i])
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES (?)`, i+1)
+			return err
+		})
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to apply migration %d", i+1))
+		}
+	}
+	return nil
+}
+
+func (r *sqlPortRepo) Create(ctx context.Context, port models.Port) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		return savePort(ctx, tx, port)
+	})
+}
+
+func (r *sqlPortRepo) Update(ctx context.Context, port models.Port) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		return savePort(ctx, tx, port)
+	})
+}
+
+func (r *sqlPortRepo) Get(ctx context.Context, unloc string) (models.Port, error) {
+	return loadPort(ctx, r.db, unloc)
+}
+
+func (r *sqlPortRepo) Delete(ctx context.Context, unloc string) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		return deletePort(ctx, tx, unloc)
+	})
+}
+
+func (r *sqlPortRepo) List(ctx context.Context, filter models.PortFilter) (models.PortPage, error) {
+	return listPorts(ctx, r.db, filter)
+}
+
+func (r *sqlPortRepo) Count(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM ports`).Scan(&count)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to count ports")
+	}
+	return count, nil
+}
+
+func (r *sqlPortRepo) Nearby(ctx context.Context, query models.NearbyQuery) ([]models.PortDistance, error) {
+	box := radiusBoundingBox(query.Latitude, query.Longitude, query.RadiusKm)
+	hits := make([]geoHit, 0)
+	err := scanLocations(ctx, r.db, box, func(unloc string, lon, lat float64) {
+		distance := haversineKm(query.Latitude, query.Longitude, lat, lon)
+		if distance <= query.RadiusKm {
+			hits = append(hits, geoHit{unloc: unloc, distanceKm: distance})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortHits(hits)
+	if query.Limit > 0 && len(hits) > query.Limit {
+		hits = hits[:query.Limit]
+	}
+
+	unlocs := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		unlocs = append(unlocs, hit.unloc)
+	}
+	loaded, err := loadPorts(ctx, r.db, unlocs)
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]models.PortDistance, 0, len(hits))
+	for _, hit := range hits {
+		if port, exists := loaded[hit.unloc]; exists {
+			ports = append(ports, models.PortDistance{Port: port, DistanceKm: hit.distanceKm})
+		}
+	}
+	return ports, nil
+}
+
+func (r *sqlPortRepo) Within(ctx context.Context, box models.BoundingBox, limit int) ([]models.Port, error) {
+	unlocs := make([]string, 0)
+	err := scanLocations(ctx, r.db, box, func(unloc string, _, _ float64) {
+		unlocs = append(unlocs, unloc)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(unlocs) > limit {
+		unlocs = unlocs[:limit]
+	}
+
+	loaded, err := loadPorts(ctx, r.db, unlocs)
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]models.Port, 0, len(unlocs))
+	for _, unloc := range unlocs {
+		if port, exists := loaded[unloc]; exists {
+			ports = append(ports, port)
+		}
+	}
+	return ports, nil
+}
+
+// Search matches each query token against the indexed terms that may match it,
+// then loads the postings of the matched terms to rank the ports
+func (r *sqlPortRepo) Search(ctx context.Context, query string, limit int) ([]models.PortMatch, error) {
+	tokens := tokenize(query)
+	if len(tokens) == 0 {
+		return []models.PortMatch{}, nil
+	}
+	matches := make([]map[string]float64, len(tokens))
+	for i, token := range tokens {
+		candidates, err := loadCandidateTerms(ctx, r.db, token)
+		if err != nil {
+			return nil, err
+		}
+		matches[i] = matchVocabulary([]string{token}, candidates)[0]
+	}
+
+	var err error
+	postings := make(map[string]map[string]float64)
+	for _, tokenMatches := range matches {
+		for term := range tokenMatches {
+			if _, loaded := postings[term]; loaded {
+				continue
+			}
+			postings[term], err = loadPostings(ctx, r.db, term)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	hits := rankHits(matches, postings)
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	unlocs := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		unlocs = append(unlocs, hit.unloc)
+	}
+	loaded, err := loadPorts(ctx, r.db, unlocs)
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]models.PortMatch, 0, len(hits))
+	for _, hit := range hits {
+		if port, exists := loaded[hit.unloc]; exists {
+			ports = append(ports, models.PortMatch{Port: port, Score: hit.score})
+		}
+	}
+	return ports, nil
+}
+
+func (r *sqlPortRepo) Begin(ctx context.Context) (PortTransaction, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+	return &sqlPortTx{tx: tx}, nil
+}
+
+func (r *sqlPortRepo) BeginAudit(ctx context.Context) (AuditTransaction, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+	return &sqlPortTx{tx: tx}, nil
+}
+
+func (r *sqlPortRepo) LoadAudit(ctx context.Context) (AuditTrail, error) {
+	var trail AuditTrail
+	var since string
+	err := r.db.QueryRowContext(ctx, `SELECT since FROM audit_since`).Scan(&since)
+	if err != nil {
+		return AuditTrail{}, errors.Wrap(err, "failed to retrieve audit start")
+	}
+	trail.Since, err = time.Parse(time.RFC3339Nano, since)
+	if err != nil {
+		return AuditTrail{}, errors.Wrap(err, "failed to parse audit start")
+	}
+
+	entries, err := loadStrings(ctx, r.db, `SELECT entry FROM audit ORDER BY id`)
+	if err != nil {
+		return AuditTrail{}, err
+	}
+	trail.Entries = make([]models.AuditEntry, 0, len(entries))
+	for _, entry := range entries {
+		var decoded models.AuditEntry
+		err = json.Unmarshal([]byte(entry), &decoded)
+		if err != nil {
+			return AuditTrail{}, errors.Wrap(err, "failed to decode audit entry")
+		}
+		trail.Entries = append(trail.Entries, decoded)
+	}
+	trail.Trimmed, err = loadStrings(ctx, r.db, `SELECT unloc FROM audit_trimmed ORDER BY unloc`)
+	if err != nil {
+		return AuditTrail{}, err
+	}
+	return trail, nil
+}
+
+// sqlPortTx runs the repository operations on a database transaction
+type sqlPortTx struct {
+	tx *sql.Tx
+}
+
+func (t *sqlPortTx) Create(ctx context.Context, port models.Port) error {
+	return savePort(ctx, t.tx, port)
+}
+
+func (t *sqlPortTx) Update(ctx context.Context, port models.Port) error {
+	return savePort(ctx, t.tx, port)
+}
+
+func (t *sqlPortTx) Get(ctx context.Context, unloc string) (models.Port, error) {
+	return loadPort(ctx, t.tx, unloc)
+}
+
+func (t *sqlPortTx) Delete(ctx context.Context, unloc string) error {
+	return deletePort(ctx, t.tx, unloc)
+}
+
+func (t *sqlPortTx) List(ctx context.Context, filter models.PortFilter) (models.PortPage, error) {
+	return listPorts(ctx, t.tx, filter)
+}
+
+// AppendAudit inserts the entries, then deletes the entries of their ports
+// beyond the retention, on the transaction
+func (t *sqlPortTx) AppendAudit(ctx context.Context, entries []models.AuditEntry, retention int) error {
+	unlocs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode audit entry")
+		}
+		_, err = t.tx.ExecContext(ctx, `INSERT INTO audit (unloc, entry) VALUES (?, ?)`, entry.Unloc, string(b))
+		if err != nil {
+			return errors.Wrap(err, "failed to insert audit entry")
+		}
+		if !containsString(unlocs, entry.Unloc) {
+			unlocs = append(unlocs, entry.Unloc)
+		}
+	}
+	if retention <= 0 {
+		return nil
+	}
+
+	for _, unloc := range unlocs {
+		result, err := t.tx.ExecContext(ctx,
+			`DELETE FROM audit WHERE unloc = ? AND id NOT IN (SELECT id FROM audit WHERE unloc = ? ORDER BY id DESC LIMIT ?)`,
+			unloc, unloc, retention)
+		if err != nil {
+			return errors.Wrap(err, "failed to trim audit entries")
+		}
+		trimmed, err := result.RowsAffected()
+		if err != nil {
+			return errors.Wrap(err, "failed to trim audit entries")
+		}
+		if trimmed == 0 {
+			continue
+		}
+		_, err = t.tx.ExecContext(ctx, `INSERT OR IGNORE INTO audit_trimmed (unloc) VALUES (?)`, unloc)
+		if err != nil {
+			return errors.Wrap(err, "failed to mark trimmed audit entries")
+		}
+	}
+	return nil
+}
+
+func (t *sqlPortTx) Commit(ctx context.Context) error {
+	err := t.tx.Commit()
+	if err == sql.ErrTxDone {
+		return ErrTxDone
+	}
+	return errors.Wrap(err, "failed to commit transaction")
+}
+
+func (t *sqlPortTx) Rollback(ctx context.Context) error {
+	err := t.tx.Rollback()
+	if err == sql.ErrTxDone {
+		return ErrTxDone
+	}
+	return errors.Wrap(err, "failed to rollback transaction")
+}
+
+// inTx runs fn inside a transaction, committing it when fn succeeds
+func (r *sqlPortRepo) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	err = fn(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return errors.Wrap(tx.Commit(), "failed to commit transaction")
+}
+
+// savePort makes every unloc of the port point to it, reusing the port row
+// owned by its first unloc. The unlocs the port no longer has are removed and
+// unlocs belonging to another port are a conflict.
+func savePort(ctx context.Context, q querier, port models.Port) error {
+	if len(port.Unlocs) == 0 {
+		return nil
+	}
+
+	for _, unloc := range port.Unlocs {
+		var owner string
+		err := q.QueryRowContext(ctx,
+			`SELECT p.unloc FROM port_unlocs u JOIN port_unlocs p ON p.port_id = u.port_id AND p.position = 0
+			WHERE u.unloc = ?`, unloc).Scan(&owner)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to retrieve unloc owner")
+		}
+		if owner != port.Unlocs[0] {
+			return localErrs.New(localErrs.CodeConflict, fmt.Sprintf("unloc %s already belongs to the port %s", unloc, owner))
+		}
+	}
+
+	var lon, lat sql.NullFloat64
+	if longitude, latitude, ok := portLocation(port); ok {
+		lon = sql.NullFloat64{Float64: longitude, Valid: true}
+		lat = sql.NullFloat64{Float64: latitude, Valid: true}
+	}
+
+	var id int64
+	err := q.QueryRowContext(ctx, `SELECT port_id FROM port_unlocs WHERE unloc = ?`, port.Unlocs[0]).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		if port.Version != 0 {
+			return versionMismatch(port)
+		}
+		res, err := q.ExecContext(ctx,
+			`INSERT INTO ports (unloc, name, city, country, province, timezone, code, longitude, latitude) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			port.Unloc, port.Name, port.City, port.Country, port.Province, port.Timezone, port.Code, lon, lat)
+		if err != nil {
+			return errors.Wrap(err, "failed to insert port")
+		}
+		id, err = res.LastInsertId()
+		if err != nil {
+			return errors.Wrap(err, "failed to retrieve port id")
+		}
+	case err != nil:
+		return errors.Wrap(err, "failed to retrieve port id")
+	default:
+		res, err := q.ExecContext(ctx,
+			`UPDATE ports SET unloc = ?, name = ?, city = ?, country = ?, province = ?, timezone = ?, code = ?, longitude = ?, latitude = ?,
+			version = version + 1 WHERE id = ? AND (? = 0 OR version = ?)`,
+			port.Unloc, port.Name, port.City, port.Country, port.Province, port.Timezone, port.Code, lon, lat, id, port.Version, port.Version)
+		if err != nil {
+			return errors.Wrap(err, "failed to update port")
+		}
+		updated, err := res.RowsAffected()
+		if err != nil {
+			return errors.Wrap(err, "failed to update port")
+		}
+		if updated == 0 {
+			return versionMismatch(port)
+		}
+	}
+
+	err = deletePortChildren(ctx, q, id)
+	if err != nil {
+		return err
+	}
+	for i, unloc := range port.Unlocs {
+		_, err = q.ExecContext(ctx, `INSERT INTO port_unlocs (unloc, port_id, position) VALUES (?, ?, ?)`, unloc, id, i)
+		if err != nil {
+			return errors.Wrap(err, "failed to insert port unloc")
+		}
+	}
+	for i, alias := range port.Alias {
+		_, err = q.ExecContext(ctx, `INSERT INTO port_aliases (port_id, position, alias) VALUES (?, ?, ?)`, id, i, alias)
+		if err != nil {
+			return errors.Wrap(err, "failed to insert port alias")
+		}
+	}
+	for i, region := range port.Regions {
+		_, err = q.ExecContext(ctx, `INSERT INTO port_regions (port_id, position, region) VALUES (?, ?, ?)`, id, i, region)
+		if err != nil {
+			return errors.Wrap(err, "failed to insert port region")
+		}
+	}
+	for i, coordinate := range port.Coordinates {
+		_, err = q.ExecContext(ctx, `INSERT INTO port_coordinates (port_id, position, value) VALUES (?, ?, ?)`, id, i, coordinate.String())
+		if err != nil {
+			return errors.Wrap(err, "failed to insert port coordinate")
+		}
+	}
+	for term, weight := range portTerms(port) {
+		_, err = q.ExecContext(ctx, `INSERT INTO port_terms (term, port_id, weight) VALUES (?, ?, ?)`, term, id, weight)
+		if err != nil {
+			return errors.Wrap(err, "failed to insert port search term")
+		}
+	}
+
+	return nil
+}
+
+// deletePort removes the port owning the unloc along with all its data
+func deletePort(ctx context.Context, q querier, unloc string) error {
+	var id int64
+	err := q.QueryRowContext(ctx, `SELECT port_id FROM port_unlocs WHERE unloc = ?`, unloc).Scan(&id)
+	if err == sql.ErrNoRows {
+		return localErrs.ErrNotFound
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve port id")
+	}
+	err = deletePortChildren(ctx, q, id)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, `DELETE FROM ports WHERE id = ?`, id)
+	return errors.Wrap(err, "failed to delete port")
+}
+
+// deletePortChildren removes the unlocs, aliases, regions, coordinates and search terms of a port
+func deletePortChildren(ctx context.Context, q querier, id int64) error {
+	for _, table := range []string{"port_unlocs", "port_aliases", "port_regions", "port_coordinates", "port_terms"} {
+		_, err := q.ExecContext(ctx, `DELETE FROM `+table+` WHERE port_id = ?`, id)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to delete from %s", table))
+		}
+	}
+	return nil
+}
+
+// listPorts queries the primary unlocs matching the filter, fetching one extra
+// row to know if there is a next page, and loads each one of the ports
+func listPorts(ctx context.Context, q querier, filter models.PortFilter) (models.PortPage, error) {
+	after := ""
+	if filter.Cursor != "" {
+		var err error
+		after, err = decodeCursor(filter.Cursor)
+		if err != nil {
+			return models.PortPage{}, err
+		}
+	}
+
+	query := strings.Builder{}
+	query.WriteString(`SELECT u.unloc FROM port_unlocs u JOIN ports p ON p.id = u.port_id WHERE u.position = 0 AND u.unloc > ?`)
+	args := []interface{}{after}
+	for _, condition := range []struct{ column, value string }{
+		{"p.country", filter.Country},
+		{"p.province", filter.Province},
+		{"p.timezone", filter.Timezone},
+		{"p.code", filter.Code},
+	} {
+		if condition.value != "" {
+			query.WriteString(` AND ` + condition.column + ` = ? COLLATE NOCASE`)
+			args = append(args, condition.value)
+		}
+	}
+	if filter.Region != "" {
+		query.WriteString(` AND EXISTS (SELECT 1 FROM port_regions r WHERE r.port_id = p.id AND r.region = ? COLLATE NOCASE)`)
+		args = append(args, filter.Region)
+	}
+	query.WriteString(` ORDER BY u.unloc`)
+	if filter.Limit > 0 {
+		query.WriteString(` LIMIT ?`)
+		args = append(args, filter.Limit+1)
+	}
+
+	unlocs, err := loadStrings(ctx, q, query.String(), args...)
+	if err != nil {
+		return models.PortPage{}, err
+	}
+
+	page := models.PortPage{Ports: make([]models.Port, 0, len(unlocs))}
+	if filter.Limit > 0 && len(unlocs) > filter.Limit {
+		unlocs = unlocs[:filter.Limit]
+		page.NextCursor = encodeCursor(unlocs[len(unlocs)-1])
+	}
+	loaded, err := loadPorts(ctx, q, unlocs)
+	if err != nil {
+		return models.PortPage{}, err
+	}
+	for _, unloc := range unlocs {
+		if port, exists := loaded[unloc]; exists {
+			page.Ports = append(page.Ports, port)
+		}
+	}
+	return page, nil
+}
+
+// scanLocations calls fn, ordered by unloc, for every primary unloc whose port
+// is located inside the box, relying on the ports_location index
+func scanLocations(ctx context.Context, q querier, box models.BoundingBox, fn func(unloc string, lon, lat float64)) error {
+	query := `SELECT u.unloc, p.longitude, p.latitude FROM ports p JOIN port_unlocs u ON u.port_id = p.id
+		WHERE u.position = 0 AND p.latitude BETWEEN ? AND ?`
+	if box.MinLongitude <= box.MaxLongitude {
+		query += ` AND p.longitude BETWEEN ? AND ?`
+	} else {
+		query += ` AND (p.longitude >= ? OR p.longitude <= ?)`
+	}
+	rows, err := q.QueryContext(ctx, query+` ORDER BY u.unloc`,
+		box.MinLatitude, box.MaxLatitude, box.MinLongitude, box.MaxLongitude)
+	if err != nil {
+		return errors.Wrap(err, "failed to query port locations")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var unloc string
+		var lon, lat float64
+		err = rows.Scan(&unloc, &lon, &lat)
+		if err != nil {
+			return errors.Wrap(err, "failed to scan port location")
+		}
+		fn(unloc, lon, lat)
+	}
+	return errors.Wrap(rows.Err(), "failed to iterate port locations")
+}
+
+func loadPort(ctx context.Context, q querier, unloc string) (models.Port, error) {
+	ports, err := loadPorts(ctx, q, []string{unloc})
+	if err != nil {
+		return models.Port{}, err
+	}
+	port, exists := ports[unloc]
+	if !exists {
+		return models.Port{}, localErrs.ErrNotFound
+	}
+	return port, nil
+}
+
+// portBatchSize is the amount of ports loaded by each set of loadPorts
+// queries, keeping their arguments under the SQLite limit
+const portBatchSize = 500
+
+// loadPorts returns the ports stored under the unlocs by unloc, missing the
+// unlocs without ports. Each batch of ports is loaded by a query per table,
+// whatever its size.
+func loadPorts(ctx context.Context, q querier, unlocs []string) (map[string]models.Port, error) {
+	ports := make(map[string]models.Port, len(unlocs))
+	for start := 0; start < len(unlocs); start += portBatchSize {
+		end := start + portBatchSize
+		if end > len(unlocs) {
+			end = len(unlocs)
+		}
+		err := loadPortBatch(ctx, q, unlocs[start:end], ports)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ports, nil
+}
+
+func loadPortBatch(ctx context.Context, q querier, unlocs []string, ports map[string]models.Port) error {
+	args := make([]interface{}, 0, len(unlocs))
+	for _, unloc := range unlocs {
+		args = append(args, unloc)
+	}
+	rows, err := q.QueryContext(ctx,
+		`SELECT u.unloc, p.id, p.unloc, p.name, p.city, p.country, p.province, p.timezone, p.code, p.version
+		FROM ports p JOIN port_unlocs u ON u.port_id = p.id
+		WHERE u.unloc IN (`+placeholders(len(unlocs))+`)`, args...)
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve ports")
+	}
+	defer rows.Close()
+
+	owners := make(map[int64][]string)
+	loaded := make(map[int64]models.Port)
+	for rows.Next() {
+		var unloc string
+		var id int64
+		var port models.Port
+		err = rows.Scan(&unloc, &id, &port.Unloc, &port.Name, &port.City, &port.Country, &port.Province, &port.Timezone, &port.Code, &port.Version)
+		if err != nil {
+			return errors.Wrap(err, "failed to scan port")
+		}
+		owners[id] = append(owners[id], unloc)
+		loaded[id] = port
+	}
+	err = rows.Err()
+	if err != nil {
+		return errors.Wrap(err, "failed to iterate ports")
+	}
+	if len(loaded) == 0 {
+		return nil
+	}
+
+	ids := make([]interface{}, 0, len(loaded))
+	for id := range loaded {
+		ids = append(ids, id)
+	}
+	unlocsByPort, err := loadPortStrings(ctx, q, "port_unlocs", "unloc", ids)
+	if err != nil {
+		return err
+	}
+	aliases, err := loadPortStrings(ctx, q, "port_aliases", "alias", ids)
+	if err != nil {
+		return err
+	}
+	regions, err := loadPortStrings(ctx, q, "port_regions", "region", ids)
+	if err != nil {
+		return err
+	}
+	coordinates, err := loadPortStrings(ctx, q, "port_coordinates", "value", ids)
+	if err != nil {
+		return err
+	}
+
+	for id, port := range loaded {
+		port.Unlocs = orEmpty(unlocsByPort[id])
+		port.Alias = orEmpty(aliases[id])
+		port.Regions = orEmpty(regions[id])
+		port.Coordinates = make([]decimal.Decimal, 0, len(coordinates[id]))
+		for _, coordinate := range coordinates[id] {
+			value, err := decimal.NewFromString(coordinate)
+			if err != nil {
+				return errors.Wrap(err, "failed to parse port coordinate")
+			}
+			port.Coordinates = append(port.Coordinates, value)
+		}
+		for _, unloc := range owners[id] {
+			ports[unloc] = port
+		}
+	}
+	return nil
+}
+
+// loadPortStrings returns the column values of the table rows of each port,
+// ordered by position
+func loadPortStrings(ctx context.Context, q querier, table, column string, ids []interface{}) (map[int64][]string, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT port_id, `+column+` FROM `+table+` WHERE port_id IN (`+placeholders(len(ids))+`) ORDER BY port_id, position`, ids...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query port data")
+	}
+	defer rows.Close()
+
+	values := make(map[int64][]string)
+	for rows.Next() {
+		var id int64
+		var value string
+		err = rows.Scan(&id, &value)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan port data")
+		}
+		values[id] = append(values[id], value)
+	}
+	return values, errors.Wrap(rows.Err(), "failed to iterate port data")
+}
+
+// placeholders returns n comma separated query placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// orEmpty returns the values, never nil so empty lists are encoded the same
+// way they were received
+func orEmpty(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// loadCandidateTerms returns the indexed terms starting with the token, along
+// with the ones close enough in length and containing one of its fuzzyPieces
+// when typos are tolerated on it, instead of the whole vocabulary
+func loadCandidateTerms(ctx context.Context, q querier, token string) ([]string, error) {
+	query := `SELECT term FROM port_terms WHERE term >= ? AND term < ?`
+	// no term starting with the token sorts after it followed by the last code point
+	args := []interface{}{token, token + "\U0010FFFF"}
+	if edits := maxEdits(token); edits > 0 {
+		length := len([]rune(token))
+		pieces := fuzzyPieces(token, edits)
+		query += ` UNION SELECT term FROM port_terms WHERE length(term) BETWEEN ? AND ? AND (` +
+			strings.TrimSuffix(strings.Repeat(`instr(term, ?) > 0 OR `, len(pieces)), ` OR `) + `)`
+		args = append(args, length-edits, length+edits)
+		for _, piece := range pieces {
+			args = append(args, piece)
+		}
+	}
+	return loadStrings(ctx, q, query, args...)
+}
+
+// loadPostings returns the weight of the term for each primary unloc containing it
+func loadPostings(ctx context.Context, q querier, term string) (map[string]float64, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT u.unloc, t.weight FROM port_terms t JOIN port_unlocs u ON u.port_id = t.port_id
+		WHERE u.position = 0 AND t.term = ?`, term)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query search term postings")
+	}
+	defer rows.Close()
+
+	postings := make(map[string]float64)
+	for rows.Next() {
+		var unloc string
+		var weight float64
+		err = rows.Scan(&unloc, &weight)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan search term posting")
+		}
+		postings[unloc] = weight
+	}
+	return postings, errors.Wrap(rows.Err(), "failed to iterate search term postings")
+}
+
+// loadStrings returns the single column values of the query rows, never nil
+// so empty lists are encoded the same way they were received
+func loadStrings(ctx context.Context, q querier, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query port data")
+	}
+	defer rows.Close()
+
+	values := make([]string, 0)
+	for rows.Next() {
+		var value string
+		err = rows.Scan(&value)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan port data")
+		}
+		values = append(values, value)
+	}
+	return values, errors.Wrap(rows.Err(), "failed to iterate port data")
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/WendelHime/ports/internal/shared/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+func openTestDB(t *testing.T, path string) *sql.DB {
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db
+}
+
+func TestSQLRepositoryBehaviour(t *testing.T) {
+	testRepositoryBehaviour(t, func(t *testing.T) PortRepository {
+		repo, err := NewSQLPortRepository(openTestDB(t, filepath.Join(t.TempDir(), "ports.db")))
+		require.NoError(t, err)
+		return repo
+	})
+}
+
+func TestSQLRepository(t *testing.T) {
+	ctx := context.Background()
+	var tests = []struct {
+		name   string
+		assert func(t *testing.T, db *sql.DB, repo PortRepository)
+		setup  func(t *testing.T, repo PortRepository)
+	}{
+		{
+			name: "Migrations should only be applied once",
+			assert: func(t *testing.T, db *sql.DB, repo PortRepository) {
+				_, err := NewSQLPortRepository(db)
+				assert.NoError(t, err)
+				var applied int
+				assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&applied))
+				assert.Equal(t, len(migrations), applied)
+			},
+			setup: func(*testing.T, PortRepository) {},
+		},
+		{
+			name: "Port data should be normalized",
+			assert: func(t *testing.T, db *sql.DB, repo PortRepository) {
+				var ports, unlocs, aliases int
+				assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM ports`).Scan(&ports))
+				assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM port_unlocs`).Scan(&unlocs))
+				assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM port_aliases`).Scan(&aliases))
+				assert.Equal(t, 1, ports)
+				assert.Equal(t, 2, unlocs)
+				assert.Equal(t, 1, aliases)
+			},
+			setup: func(t *testing.T, repo PortRepository) {
+				assert.NoError(t, repo.Create(ctx, models.Port{Alias: []string{"alias"}, Unlocs: []string{"UNLOC1", "UNLOC2"}}))
+				assert.NoError(t, repo.Update(ctx, models.Port{Alias: []string{"updated"}, Unlocs: []string{"UNLOC1", "UNLOC2"}}))
+			},
+		},
+		{
+			name: "Unlocs removed from a port should be deleted",
+			assert: func(t *testing.T, db *sql.DB, repo PortRepository) {
+				var unlocs int
+				assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM port_unlocs`).Scan(&unlocs))
+				assert.Equal(t, 1, unlocs)
+			},
+			setup: func(t *testing.T, repo PortRepository) {
+				assert.NoError(t, repo.Create(ctx, models.Port{Unlocs: []string{"UNLOC", "OTHER"}}))
+				assert.NoError(t, repo.Update(ctx, models.Port{Unlocs: []string{"UNLOC"}}))
+			},
+		},
+		{
+			name: "Ports beyond a loading batch should all be listed in order",
+			assert: func(t *testing.T, db *sql.DB, repo PortRepository) {
+				page, err := repo.List(ctx, models.PortFilter{})
+				require.NoError(t, err)
+				require.Len(t, page.Ports, portBatchSize+1)
+				for i, port := range page.Ports {
+					assert.Equal(t, []string{fmt.Sprintf("UNLOC%04d", i), fmt.Sprintf("ALIAS%04d", i)}, port.Unlocs)
+					assert.Equal(t, []string{fmt.Sprintf("alias %d", i)}, port.Alias)
+				}
+			},
+			setup: func(t *testing.T, repo PortRepository) {
+				tx, err := repo.Begin(ctx)
+				require.NoError(t, err)
+				for i := 0; i <= portBatchSize; i++ {
+					unlocs := []string{fmt.Sprintf("UNLOC%04d", i), fmt.Sprintf("ALIAS%04d", i)}
+					require.NoError(t, tx.Create(ctx, models.Port{Unlocs: unlocs, Alias: []string{fmt.Sprintf("alias %d", i)}}))
+				}
+				require.NoError(t, tx.Commit(ctx))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t, filepath.Join(t.TempDir(), "ports.db"))
+			repo, err := NewSQLPortRepository(db)
+			require.NoError(t, err)
+			tt.setup(t, repo)
+			tt.assert(t, db, repo)
+		})
+	}
+}
+
+func TestSQLRepositoryUnlocBackfill(t *testing.T) {
+	// a database left on the schema used before ports stored their primary unloc
+	db := openTestDB(t, filepath.Join(t.TempDir(), "ports.db"))
+	_, err := db.Exec(`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY)`)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = db.Exec(migrations[i])
+		require.NoError(t, err)
+		_, err = db.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, i+1)
+		require.NoError(t, err)
+	}
+	_, err = db.Exec(`INSERT INTO ports (id, name, city, country, province, timezone, code) VALUES (1, 'Port', '', '', '', '', '')`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO port_unlocs (unloc, port_id, position) VALUES ('UNLOC', 1, 0), ('OTHER', 1, 1)`)
+	require.NoError(t, err)
+
+	repo, err := NewSQLPortRepository(db)
+	require.NoError(t, err)
+	port, err := repo.Get(context.Background(), "OTHER")
+	require.NoError(t, err)
+	assert.Equal(t, "UNLOC", port.Unloc)
+	assert.Equal(t, []string{"UNLOC", "OTHER"}, port.Unlocs)
+	assert.Equal(t, "Port", port.Name)
+}
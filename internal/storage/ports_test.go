@@ -2,11 +2,17 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"sync"
 	"testing"
 
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
 	"github.com/WendelHime/ports/internal/shared/models"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestInMemRepository(t *testing.T) {
@@ -31,8 +37,11 @@ func TestInMemRepository(t *testing.T) {
 			},
 			setup: func(*testing.T) portRepo {
 				return portRepo{
-					ports: make(map[string]models.Port),
-					mutex: new(sync.Mutex),
+					ports:  make(map[string]models.Port),
+					keys:   make(map[string][]string),
+					geo:    newGeoIndex(),
+					search: newSearchIndex(),
+					mutex:  new(sync.Mutex),
 				}
 			},
 		},
@@ -51,8 +60,11 @@ func TestInMemRepository(t *testing.T) {
 			},
 			setup: func(*testing.T) portRepo {
 				repo := portRepo{
-					ports: make(map[string]models.Port),
-					mutex: new(sync.Mutex),
+					ports:  make(map[string]models.Port),
+					keys:   make(map[string][]string),
+					geo:    newGeoIndex(),
+					search: newSearchIndex(),
+					mutex:  new(sync.Mutex),
 				}
 				err := repo.Create(context.Background(), models.Port{
 					Unlocs: []string{"UNLOC"},
@@ -80,8 +92,11 @@ func TestInMemRepository(t *testing.T) {
 			},
 			setup: func(*testing.T) portRepo {
 				repo := portRepo{
-					ports: make(map[string]models.Port),
-					mutex: new(sync.Mutex),
+					ports:  make(map[string]models.Port),
+					keys:   make(map[string][]string),
+					geo:    newGeoIndex(),
+					search: newSearchIndex(),
+					mutex:  new(sync.Mutex),
 				}
 				err := repo.Create(context.Background(), models.Port{
 					Unlocs: []string{"UNLOC"},
@@ -90,6 +105,33 @@ func TestInMemRepository(t *testing.T) {
 				return repo
 			},
 		},
+		{
+			name: "Delete port with success",
+			assert: func(t *testing.T, repo portRepo, err error) {
+				assert.Nil(t, err)
+				assert.NotContains(t, repo.ports, "UNLOC1")
+				assert.NotContains(t, repo.ports, "UNLOC2")
+				assert.Contains(t, repo.ports, "OTHER")
+				assert.Empty(t, repo.search.postings["deleted"])
+			},
+
+			exec: func(repo portRepo) error {
+				return repo.Delete(context.Background(), "UNLOC2")
+			},
+			setup: func(*testing.T) portRepo {
+				repo := *newPortRepo()
+				err := repo.Create(context.Background(), models.Port{
+					Name:   "deleted",
+					Unlocs: []string{"UNLOC1", "UNLOC2"},
+				})
+				assert.NoError(t, err)
+				err = repo.Create(context.Background(), models.Port{
+					Unlocs: []string{"OTHER"},
+				})
+				assert.NoError(t, err)
+				return repo
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -99,3 +141,645 @@ func TestInMemRepository(t *testing.T) {
 		})
 	}
 }
+
+// testRepositoryBehaviour runs the behaviour every PortRepository implementation
+// must comply with against the repositories built by newRepo
+func testRepositoryBehaviour(t *testing.T, newRepo func(t *testing.T) PortRepository) {
+	ctx := context.Background()
+	var tests = []struct {
+		name   string
+		assert func(t *testing.T, repo PortRepository, err error)
+		exec   func(repo PortRepository) error
+		setup  func(t *testing.T, repo PortRepository)
+	}{
+		{
+			name: "Create port with success",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.NoError(t, err)
+				port, err := repo.Get(ctx, "UNLOC")
+				assert.NoError(t, err)
+				assert.Equal(t, "created", port.Code)
+			},
+			exec: func(repo PortRepository) error {
+				return repo.Create(ctx, models.Port{Code: "created", Unlocs: []string{"UNLOC"}})
+			},
+			setup: func(*testing.T, PortRepository) {},
+		},
+		{
+			name: "Port should be reachable by each one of its unlocs",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.NoError(t, err)
+				for _, unloc := range []string{"UNLOC1", "UNLOC2"} {
+					port, err := repo.Get(ctx, unloc)
+					assert.NoError(t, err)
+					assert.Equal(t, []string{"UNLOC1", "UNLOC2"}, port.Unlocs)
+				}
+			},
+			exec: func(repo PortRepository) error {
+				return repo.Create(ctx, models.Port{Unlocs: []string{"UNLOC1", "UNLOC2"}})
+			},
+			setup: func(*testing.T, PortRepository) {},
+		},
+		{
+			name: "Get unknown port should return not found",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrNotFound)
+			},
+			exec: func(repo PortRepository) error {
+				_, err := repo.Get(ctx, "UNKNOWN")
+				return err
+			},
+			setup: func(*testing.T, PortRepository) {},
+		},
+		{
+			name: "Update port with success",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.NoError(t, err)
+				port, err := repo.Get(ctx, "UNLOC")
+				assert.NoError(t, err)
+				assert.Equal(t, models.Port{
+					Unloc:       "UNLOC",
+					Name:        "Ajman",
+					Alias:       []string{"alias"},
+					Regions:     []string{"region"},
+					Coordinates: []decimal.Decimal{decimal.RequireFromString("55.5136433"), decimal.RequireFromString("25.4052165")},
+					Code:        "updated",
+					Unlocs:      []string{"UNLOC"},
+					Version:     2,
+				}, port)
+			},
+			exec: func(repo PortRepository) error {
+				return repo.Update(ctx, models.Port{
+					Unloc:       "UNLOC",
+					Name:        "Ajman",
+					Alias:       []string{"alias"},
+					Regions:     []string{"region"},
+					Coordinates: []decimal.Decimal{decimal.RequireFromString("55.5136433"), decimal.RequireFromString("25.4052165")},
+					Code:        "updated",
+					Unlocs:      []string{"UNLOC"},
+				})
+			},
+			setup: func(t *testing.T, repo PortRepository) {
+				err := repo.Create(ctx, models.Port{Code: "created", Unlocs: []string{"UNLOC"}})
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "Created port should be on the first version",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.NoError(t, err)
+				port, err := repo.Get(ctx, "UNLOC")
+				assert.NoError(t, err)
+				assert.Equal(t, int64(1), port.Version)
+			},
+			exec: func(repo PortRepository) error {
+				return repo.Create(ctx, models.Port{Unlocs: []string{"UNLOC"}})
+			},
+			setup: func(*testing.T, PortRepository) {},
+		},
+		{
+			name: "Update on the stored version should increase it",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.NoError(t, err)
+				port, err := repo.Get(ctx, "UNLOC")
+				assert.NoError(t, err)
+				assert.Equal(t, "updated", port.Code)
+				assert.Equal(t, int64(3), port.Version)
+			},
+			exec: func(repo PortRepository) error {
+				return repo.Update(ctx, models.Port{Code: "updated", Unlocs: []string{"UNLOC"}, Version: 2})
+			},
+			setup: func(t *testing.T, repo PortRepository) {
+				assert.NoError(t, repo.Create(ctx, models.Port{Unlocs: []string{"UNLOC"}}))
+				assert.NoError(t, repo.Update(ctx, models.Port{Unlocs: []string{"UNLOC"}}))
+			},
+		},
+		{
+			name: "Update on a stale version should fail the precondition",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrPreconditionFailed)
+				port, err := repo.Get(ctx, "UNLOC")
+				assert.NoError(t, err)
+				assert.Equal(t, "current", port.Code)
+				assert.Equal(t, int64(2), port.Version)
+			},
+			exec: func(repo PortRepository) error {
+				return repo.Update(ctx, models.Port{Code: "stale", Unlocs: []string{"UNLOC"}, Version: 1})
+			},
+			setup: func(t *testing.T, repo PortRepository) {
+				assert.NoError(t, repo.Create(ctx, models.Port{Unlocs: []string{"UNLOC"}}))
+				assert.NoError(t, repo.Update(ctx, models.Port{Code: "current", Unlocs: []string{"UNLOC"}}))
+			},
+		},
+		{
+			name: "Versioned write of an unknown port should fail the precondition",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrPreconditionFailed)
+				_, err = repo.Get(ctx, "UNLOC")
+				assert.ErrorIs(t, err, localErrs.ErrNotFound)
+			},
+			exec: func(repo PortRepository) error {
+				return repo.Update(ctx, models.Port{Unlocs: []string{"UNLOC"}, Version: 1})
+			},
+			setup: func(*testing.T, PortRepository) {},
+		},
+		{
+			name: "Transaction on a stale version should fail the precondition",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrPreconditionFailed)
+			},
+			exec: func(repo PortRepository) error {
+				tx, err := repo.Begin(ctx)
+				if err != nil {
+					return err
+				}
+				defer tx.Rollback(ctx)
+				err = tx.Update(ctx, models.Port{Unlocs: []string{"UNLOC"}, Version: 1})
+				if err != nil {
+					return err
+				}
+				return tx.Update(ctx, models.Port{Unlocs: []string{"UNLOC"}, Version: 1})
+			},
+			setup: func(t *testing.T, repo PortRepository) {
+				assert.NoError(t, repo.Create(ctx, models.Port{Unlocs: []string{"UNLOC"}}))
+			},
+		},
+		{
+			name: "List ports should paginate ordered by unloc",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.NoError(t, err)
+				page, err := repo.List(ctx, models.PortFilter{Limit: 2})
+				assert.NoError(t, err)
+				assert.Len(t, page.Ports, 2)
+				assert.Equal(t, "AAAAA", page.Ports[0].Unlocs[0])
+				assert.Equal(t, "BBBBB", page.Ports[1].Unlocs[0])
+				assert.NotEmpty(t, page.NextCursor)
+
+				page, err = repo.List(ctx, models.PortFilter{Limit: 2, Cursor: page.NextCursor})
+				assert.NoError(t, err)
+				assert.Len(t, page.Ports, 1)
+				assert.Equal(t, "CCCCC", page.Ports[0].Unlocs[0])
+				assert.Empty(t, page.NextCursor)
+			},
+			exec: func(repo PortRepository) error {
+				return nil
+			},
+			setup: func(t *testing.T, repo PortRepository) {
+				for _, unlocs := range [][]string{{"CCCCC"}, {"AAAAA", "ZZZZZ"}, {"BBBBB"}} {
+					assert.NoError(t, repo.Create(ctx, models.Port{Unlocs: unlocs}))
+				}
+			},
+		},
+		{
+			name: "List ports should apply filters",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.NoError(t, err)
+				page, err := repo.List(ctx, models.PortFilter{Country: "brazil", Region: "south america"})
+				assert.NoError(t, err)
+				assert.Len(t, page.Ports, 1)
+				assert.Equal(t, "BRSSZ", page.Ports[0].Unlocs[0])
+
+				page, err = repo.List(ctx, models.PortFilter{Code: "none"})
+				assert.NoError(t, err)
+				assert.Empty(t, page.Ports)
+			},
+			exec: func(repo PortRepository) error {
+				return nil
+			},
+			setup: func(t *testing.T, repo PortRepository) {
+				assert.NoError(t, repo.Create(ctx, models.Port{Country: "Brazil", Regions: []string{"South America"}, Unlocs: []string{"BRSSZ"}}))
+				assert.NoError(t, repo.Create(ctx, models.Port{Country: "Brazil", Unlocs: []string{"BRRIO"}}))
+				assert.NoError(t, repo.Create(ctx, models.Port{Country: "Chile", Regions: []string{"South America"}, Unlocs: []string{"CLVAP"}}))
+			},
+		},
+		{
+			name: "List ports with invalid cursor should return bad request",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrBadRequest)
+			},
+			exec: func(repo PortRepository) error {
+				_, err := repo.List(ctx, models.PortFilter{Cursor: "%%%"})
+				return err
+			},
+			setup: func(*testing.T, PortRepository) {},
+		},
+		{
+			name: "Nearby ports should be ordered by distance",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.NoError(t, err)
+				ports, err := repo.Nearby(ctx, models.NearbyQuery{Latitude: 25.2, Longitude: 55.3, RadiusKm: 100})
+				assert.NoError(t, err)
+				assert.Len(t, ports, 2)
+				assert.Equal(t, "AEDXB", ports[0].Port.Unlocs[0])
+				assert.Equal(t, "AEAJM", ports[1].Port.Unlocs[0])
+				assert.InDelta(t, 6.3, ports[0].DistanceKm, 0.1)
+
+				ports, err = repo.Nearby(ctx, models.NearbyQuery{Latitude: 25.2, Longitude: 55.3, RadiusKm: 200, Limit: 1})
+				assert.NoError(t, err)
+				assert.Len(t, ports, 1)
+			},
+			exec: func(repo PortRepository) error {
+				return nil
+			},
+			setup: func(t *testing.T, repo PortRepository) {
+				for _, port := range geoPorts() {
+					assert.NoError(t, repo.Create(ctx, port))
+				}
+			},
+		},
+		{
+			name: "Ports within a bounding box should be ordered by unloc",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.NoError(t, err)
+				ports, err := repo.Within(ctx, models.BoundingBox{MinLongitude: 54, MinLatitude: 24, MaxLongitude: 56, MaxLatitude: 26}, 0)
+				assert.NoError(t, err)
+				assert.Len(t, ports, 3)
+				assert.Equal(t, "AEAJM", ports[0].Unlocs[0])
+
+				ports, err = repo.Within(ctx, models.BoundingBox{MinLongitude: 170, MinLatitude: -20, MaxLongitude: -170, MaxLatitude: -10}, 0)
+				assert.NoError(t, err)
+				assert.Len(t, ports, 1)
+				assert.Equal(t, "FJSUV", ports[0].Unlocs[0])
+			},
+			exec: func(repo PortRepository) error {
+				return nil
+			},
+			setup: func(t *testing.T, repo PortRepository) {
+				for _, port := range geoPorts() {
+					assert.NoError(t, repo.Create(ctx, port))
+				}
+			},
+		},
+		{
+			name: "Search should match names, aliases, cities and provinces",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.NoError(t, err)
+				ports, err := repo.Search(ctx, "dubay", 10)
+				assert.NoError(t, err)
+				assert.Len(t, ports, 1)
+				assert.Equal(t, "AEDXB", ports[0].Port.Unlocs[0])
+
+				ports, err = repo.Search(ctx, "ABU", 10)
+				assert.NoError(t, err)
+				assert.Len(t, ports, 1)
+				assert.Equal(t, "AEAUH", ports[0].Port.Unlocs[0])
+			},
+			exec: func(repo PortRepository) error {
+				return repo.Update(ctx, models.Port{Name: "Dubai", Province: "Dubayy [Dubai]", Unlocs: []string{"AEDXB"}})
+			},
+			setup: func(t *testing.T, repo PortRepository) {
+				for _, port := range geoPorts() {
+					assert.NoError(t, repo.Create(ctx, port))
+				}
+			},
+		},
+		{
+			name: "Delete port should remove it from every unloc",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.NoError(t, err)
+				for _, unloc := range []string{"UNLOC1", "UNLOC2"} {
+					_, err := repo.Get(ctx, unloc)
+					assert.ErrorIs(t, err, localErrs.ErrNotFound)
+				}
+				_, err = repo.Get(ctx, "OTHER")
+				assert.NoError(t, err)
+				page, err := repo.List(ctx, models.PortFilter{})
+				assert.NoError(t, err)
+				assert.Len(t, page.Ports, 1)
+				count, err := repo.Count(ctx)
+				assert.NoError(t, err)
+				assert.Equal(t, 1, count)
+				ports, err := repo.Search(ctx, "deleted", 10)
+				assert.NoError(t, err)
+				assert.Empty(t, ports)
+			},
+			exec: func(repo PortRepository) error {
+				return repo.Delete(ctx, "UNLOC2")
+			},
+			setup: func(t *testing.T, repo PortRepository) {
+				assert.NoError(t, repo.Create(ctx, models.Port{Name: "deleted", Unlocs: []string{"UNLOC1", "UNLOC2"}}))
+				assert.NoError(t, repo.Create(ctx, models.Port{Name: "kept", Unlocs: []string{"OTHER"}}))
+				count, err := repo.Count(ctx)
+				assert.NoError(t, err)
+				assert.Equal(t, 2, count)
+			},
+		},
+		{
+			name: "Delete unknown port should return not found",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrNotFound)
+			},
+			exec: func(repo PortRepository) error {
+				return repo.Delete(ctx, "UNKNOWN")
+			},
+			setup: func(*testing.T, PortRepository) {},
+		},
+		{
+			name: "Update should remove the unlocs the port no longer has",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.NoError(t, err)
+				_, err = repo.Get(ctx, "UNLOC2")
+				assert.ErrorIs(t, err, localErrs.ErrNotFound)
+				port, err := repo.Get(ctx, "UNLOC1")
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"UNLOC1", "UNLOC3"}, port.Unlocs)
+				port, err = repo.Get(ctx, "UNLOC3")
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"UNLOC1", "UNLOC3"}, port.Unlocs)
+			},
+			exec: func(repo PortRepository) error {
+				return repo.Update(ctx, models.Port{Unlocs: []string{"UNLOC1", "UNLOC3"}})
+			},
+			setup: func(t *testing.T, repo PortRepository) {
+				assert.NoError(t, repo.Create(ctx, models.Port{Unlocs: []string{"UNLOC1", "UNLOC2"}}))
+			},
+		},
+		{
+			name: "Unloc belonging to another port should be a conflict",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrConflict)
+				port, err := repo.Get(ctx, "SHARED")
+				assert.NoError(t, err)
+				assert.Equal(t, "first", port.Name)
+				_, err = repo.Get(ctx, "SECOND")
+				assert.ErrorIs(t, err, localErrs.ErrNotFound)
+			},
+			exec: func(repo PortRepository) error {
+				return repo.Create(ctx, models.Port{Name: "second", Unlocs: []string{"SECOND", "SHARED"}})
+			},
+			setup: func(t *testing.T, repo PortRepository) {
+				assert.NoError(t, repo.Create(ctx, models.Port{Name: "first", Unlocs: []string{"FIRST", "SHARED"}}))
+			},
+		},
+		{
+			name: "Unloc belonging to another port should be a conflict on a transaction",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.ErrorIs(t, err, localErrs.ErrConflict)
+			},
+			exec: func(repo PortRepository) error {
+				tx, err := repo.Begin(ctx)
+				if err != nil {
+					return err
+				}
+				defer tx.Rollback(ctx)
+				if err = tx.Create(ctx, models.Port{Unlocs: []string{"FIRST", "SHARED"}}); err != nil {
+					return err
+				}
+				return tx.Update(ctx, models.Port{Unlocs: []string{"SECOND", "SHARED"}})
+			},
+			setup: func(*testing.T, PortRepository) {},
+		},
+		{
+			name: "Committed transaction should apply every write at once",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.NoError(t, err)
+				_, err = repo.Get(ctx, "CREATED")
+				assert.NoError(t, err)
+				port, err := repo.Get(ctx, "UPDATED")
+				assert.NoError(t, err)
+				assert.Equal(t, "updated", port.Code)
+				_, err = repo.Get(ctx, "DELETED")
+				assert.ErrorIs(t, err, localErrs.ErrNotFound)
+				ports, err := repo.Search(ctx, "created", 10)
+				assert.NoError(t, err)
+				assert.Len(t, ports, 1)
+			},
+			exec: func(repo PortRepository) error {
+				tx, err := repo.Begin(ctx)
+				if err != nil {
+					return err
+				}
+				if err = tx.Create(ctx, models.Port{Name: "created", Unlocs: []string{"CREATED"}}); err != nil {
+					return err
+				}
+				if err = tx.Update(ctx, models.Port{Code: "updated", Unlocs: []string{"UPDATED"}}); err != nil {
+					return err
+				}
+				if err = tx.Delete(ctx, "DELETED"); err != nil {
+					return err
+				}
+				if _, err = tx.Get(ctx, "CREATED"); err != nil {
+					return err
+				}
+				if _, err = tx.Get(ctx, "DELETED"); !errors.Is(err, localErrs.ErrNotFound) {
+					return fmt.Errorf("deleted port should not be visible on the transaction: %v", err)
+				}
+				page, err := tx.List(ctx, models.PortFilter{})
+				if err != nil {
+					return err
+				}
+				if len(page.Ports) != 2 {
+					return fmt.Errorf("transaction should list 2 ports, listed %d", len(page.Ports))
+				}
+				if _, err = repo.Get(ctx, "CREATED"); !errors.Is(err, localErrs.ErrNotFound) {
+					return fmt.Errorf("uncommitted port should not be visible on the repository: %v", err)
+				}
+				return tx.Commit(ctx)
+			},
+			setup: func(t *testing.T, repo PortRepository) {
+				assert.NoError(t, repo.Create(ctx, models.Port{Code: "original", Unlocs: []string{"UPDATED"}}))
+				assert.NoError(t, repo.Create(ctx, models.Port{Unlocs: []string{"DELETED"}}))
+			},
+		},
+		{
+			name: "Rolled back transaction should leave the repository untouched",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.NoError(t, err)
+				_, err = repo.Get(ctx, "CREATED")
+				assert.ErrorIs(t, err, localErrs.ErrNotFound)
+				port, err := repo.Get(ctx, "KEPT")
+				assert.NoError(t, err)
+				assert.Equal(t, "original", port.Code)
+				page, err := repo.List(ctx, models.PortFilter{})
+				assert.NoError(t, err)
+				assert.Len(t, page.Ports, 1)
+			},
+			exec: func(repo PortRepository) error {
+				tx, err := repo.Begin(ctx)
+				if err != nil {
+					return err
+				}
+				if err = tx.Create(ctx, models.Port{Unlocs: []string{"CREATED"}}); err != nil {
+					return err
+				}
+				if err = tx.Update(ctx, models.Port{Code: "updated", Unlocs: []string{"KEPT"}}); err != nil {
+					return err
+				}
+				return tx.Rollback(ctx)
+			},
+			setup: func(t *testing.T, repo PortRepository) {
+				assert.NoError(t, repo.Create(ctx, models.Port{Code: "original", Unlocs: []string{"KEPT"}}))
+			},
+		},
+		{
+			name: "Finished transaction should not be committed again",
+			assert: func(t *testing.T, repo PortRepository, err error) {
+				assert.ErrorIs(t, err, ErrTxDone)
+			},
+			exec: func(repo PortRepository) error {
+				tx, err := repo.Begin(ctx)
+				if err != nil {
+					return err
+				}
+				if err = tx.Rollback(ctx); err != nil {
+					return err
+				}
+				return tx.Commit(ctx)
+			},
+			setup: func(*testing.T, PortRepository) {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newRepo(t)
+			tt.setup(t, repo)
+			err := tt.exec(repo)
+			tt.assert(t, repo, err)
+		})
+	}
+}
+
+func TestInMemRepositoryBehaviour(t *testing.T) {
+	testRepositoryBehaviour(t, func(*testing.T) PortRepository {
+		return NewPortRepository()
+	})
+}
+
+// TestTransactionConcurrentWrite commits transactions after a concurrent write
+// on the repositories staging their writes in memory until committed
+func TestTransactionConcurrentWrite(t *testing.T) {
+	ctx := context.Background()
+	repos := map[string]func(t *testing.T) PortRepository{
+		"memory": func(*testing.T) PortRepository {
+			return NewPortRepository()
+		},
+		"file": func(t *testing.T) PortRepository {
+			repo, err := NewFilePortRepository(t.TempDir(), DefaultCompactEvery)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				_ = repo.(io.Closer).Close()
+			})
+			return repo
+		},
+	}
+	var tests = []struct {
+		name          string
+		stage         func(tx PortTransaction) error
+		write         func(repo PortRepository) error
+		expectedError error
+		assert        func(t *testing.T, repo PortRepository)
+	}{
+		{
+			name: "Port updated since staged should fail the commit",
+			stage: func(tx PortTransaction) error {
+				return tx.Update(ctx, models.Port{Code: "staged", Unlocs: []string{"STORED"}})
+			},
+			write: func(repo PortRepository) error {
+				return repo.Update(ctx, models.Port{Code: "concurrent", Unlocs: []string{"STORED"}})
+			},
+			expectedError: localErrs.ErrPreconditionFailed,
+			assert: func(t *testing.T, repo PortRepository) {
+				port, err := repo.Get(ctx, "STORED")
+				require.NoError(t, err)
+				assert.Equal(t, "concurrent", port.Code)
+				assert.Equal(t, int64(2), port.Version)
+			},
+		},
+		{
+			name: "Port created since staged should fail the commit",
+			stage: func(tx PortTransaction) error {
+				return tx.Create(ctx, models.Port{Code: "staged", Unlocs: []string{"NEW"}})
+			},
+			write: func(repo PortRepository) error {
+				return repo.Create(ctx, models.Port{Code: "concurrent", Unlocs: []string{"NEW"}})
+			},
+			expectedError: localErrs.ErrPreconditionFailed,
+			assert: func(t *testing.T, repo PortRepository) {
+				port, err := repo.Get(ctx, "NEW")
+				require.NoError(t, err)
+				assert.Equal(t, "concurrent", port.Code)
+			},
+		},
+		{
+			name: "Unloc taken since staged should fail the commit",
+			stage: func(tx PortTransaction) error {
+				return tx.Update(ctx, models.Port{Code: "staged", Unlocs: []string{"STORED", "TAKEN"}})
+			},
+			write: func(repo PortRepository) error {
+				return repo.Create(ctx, models.Port{Code: "concurrent", Unlocs: []string{"OTHER", "TAKEN"}})
+			},
+			expectedError: localErrs.ErrConflict,
+			assert: func(t *testing.T, repo PortRepository) {
+				port, err := repo.Get(ctx, "TAKEN")
+				require.NoError(t, err)
+				assert.Equal(t, "concurrent", port.Code)
+				port, err = repo.Get(ctx, "STORED")
+				require.NoError(t, err)
+				assert.Equal(t, "original", port.Code)
+			},
+		},
+		{
+			name: "Port updated since its deletion was staged should fail the commit",
+			stage: func(tx PortTransaction) error {
+				return tx.Delete(ctx, "STORED")
+			},
+			write: func(repo PortRepository) error {
+				return repo.Update(ctx, models.Port{Code: "concurrent", Unlocs: []string{"STORED"}})
+			},
+			expectedError: localErrs.ErrPreconditionFailed,
+			assert: func(t *testing.T, repo PortRepository) {
+				port, err := repo.Get(ctx, "STORED")
+				require.NoError(t, err)
+				assert.Equal(t, "concurrent", port.Code)
+			},
+		},
+		{
+			name: "Writes to other ports shouldn't fail the commit",
+			stage: func(tx PortTransaction) error {
+				return tx.Update(ctx, models.Port{Code: "staged", Unlocs: []string{"STORED"}})
+			},
+			write: func(repo PortRepository) error {
+				return repo.Create(ctx, models.Port{Code: "concurrent", Unlocs: []string{"OTHER"}})
+			},
+			assert: func(t *testing.T, repo PortRepository) {
+				port, err := repo.Get(ctx, "STORED")
+				require.NoError(t, err)
+				assert.Equal(t, "staged", port.Code)
+				assert.Equal(t, int64(2), port.Version)
+			},
+		},
+	}
+	for name, newRepo := range repos {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				repo := newRepo(t)
+				require.NoError(t, repo.Create(ctx, models.Port{Code: "original", Unlocs: []string{"STORED"}}))
+				tx, err := repo.Begin(ctx)
+				require.NoError(t, err)
+				require.NoError(t, tt.stage(tx))
+				require.NoError(t, tt.write(repo))
+
+				err = tx.Commit(ctx)
+				if tt.expectedError != nil {
+					assert.ErrorIs(t, err, tt.expectedError)
+				} else {
+					assert.NoError(t, err)
+				}
+				tt.assert(t, repo)
+			})
+		}
+	}
+}
+
+func geoPorts() []models.Port {
+	coordinates := func(lon, lat string) []decimal.Decimal {
+		return []decimal.Decimal{decimal.RequireFromString(lon), decimal.RequireFromString(lat)}
+	}
+	return []models.Port{
+		{Name: "Ajman", Coordinates: coordinates("55.5136433", "25.4052165"), Unlocs: []string{"AEAJM"}},
+		{Name: "Abu Dhabi", Coordinates: coordinates("54.37", "24.47"), Unlocs: []string{"AEAUH"}},
+		{Name: "Dubai", Coordinates: coordinates("55.27", "25.25"), Unlocs: []string{"AEDXB"}},
+		{Name: "Suva", Coordinates: coordinates("178.42", "-18.14"), Unlocs: []string{"FJSUV"}},
+		{Name: "Unknown", Unlocs: []string{"XXXXX"}},
+	}
+}
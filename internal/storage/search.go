@@ -0,0 +1,343 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/WendelHime/ports/internal/shared/models"
+)
+
+// searchFields are the port fields indexed for searching and their weights
+var searchFields = []struct {
+	weight float64
+	values func(port models.Port) []string
+}{
+	{weight: 3, values: func(port models.Port) []string { return []string{port.Name} }},
+	{weight: 2, values: func(port models.Port) []string { return port.Alias }},
+	{weight: 2, values: func(port models.Port) []string { return []string{port.City} }},
+	{weight: 1, values: func(port models.Port) []string { return []string{port.Province} }},
+}
+
+const (
+	exactMatchScore  = 1.0
+	prefixMatchScore = 0.75
+	fuzzyMatchScore  = 0.5
+)
+
+// letters that aren't decomposed into a base letter and a diacritic
+var foldReplacer = strings.NewReplacer("ø", "o", "ł", "l", "đ", "d", "ß", "ss", "æ", "ae", "œ", "oe", "ı", "i")
+
+// foldText lower cases the text and strips its diacritics
+func foldText(text string) string {
+	t := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, strings.ToLower(text))
+	if err != nil {
+		return strings.ToLower(text)
+	}
+	return foldReplacer.Replace(folded)
+}
+
+// tokenize splits the folded text into its words
+func tokenize(text string) []string {
+	return strings.FieldsFunc(foldText(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// portTerms returns every term of the port searchable fields with the weight
+// of the most relevant field it appears on
+func portTerms(port models.Port) map[string]float64 {
+	terms := make(map[string]float64)
+	for _, field := range searchFields {
+		for _, value := range field.values(port) {
+			for _, term := range tokenize(value) {
+				if field.weight > terms[term] {
+					terms[term] = field.weight
+				}
+			}
+		}
+	}
+	return terms
+}
+
+// maxEdits is the amount of typos tolerated on a token, short tokens must be
+// spelled correctly
+func maxEdits(token string) int {
+	switch length := len([]rune(token)); {
+	case length < 4:
+		return 0
+	case length < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// matchScore returns how well the term matches the query token, zero when it doesn't
+func matchScore(token, term string) float64 {
+	if token == term {
+		return exactMatchScore
+	}
+	if strings.HasPrefix(term, token) {
+		return prefixMatchScore
+	}
+	edits := maxEdits(token)
+	if edits > 0 && levenshtein(token, term, edits) <= edits {
+		return fuzzyMatchScore
+	}
+	return 0
+}
+
+// fuzzyPieces splits the token into edits+1 pieces, at least one of them being
+// left untouched by edits typos, so every term fuzzily matching the token
+// contains one of them
+func fuzzyPieces(token string, edits int) []string {
+	runes := []rune(token)
+	pieces := make([]string, 0, edits+1)
+	for i := 0; i <= edits; i++ {
+		pieces = append(pieces, string(runes[i*len(runes)/(edits+1):(i+1)*len(runes)/(edits+1)]))
+	}
+	return pieces
+}
+
+// levenshtein returns the edit distance between a and b, or max+1 as soon as
+// the distance is known to be greater than max
+func levenshtein(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if absInt(len(ra)-len(rb)) > max {
+		return max + 1
+	}
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		rowMin := current[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			if current[j] < rowMin {
+				rowMin = current[j]
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// matchVocabulary returns, for each query token, the vocabulary terms it
+// matches and how well
+func matchVocabulary(tokens []string, vocabulary []string) []map[string]float64 {
+	matches := make([]map[string]float64, len(tokens))
+	for i, token := range tokens {
+		matches[i] = make(map[string]float64)
+		for _, term := range vocabulary {
+			if score := matchScore(token, term); score > 0 {
+				matches[i][term] = score
+			}
+		}
+	}
+	return matches
+}
+
+// searchHit is an indexed unloc found by a search
+type searchHit struct {
+	unloc string
+	score float64
+}
+
+// rankHits scores the unlocs matching every query token, each token
+// contributing with its best match weighted by the field it was found on.
+// postings holds the unlocs and field weights of each matched term.
+func rankHits(matches []map[string]float64, postings map[string]map[string]float64) []searchHit {
+	scores := make(map[string]float64)
+	for i, tokenMatches := range matches {
+		tokenScores := make(map[string]float64)
+		for term, score := range tokenMatches {
+			for unloc, weight := range postings[term] {
+				if score*weight > tokenScores[unloc] {
+					tokenScores[unloc] = score * weight
+				}
+			}
+		}
+
+		for unloc, score := range tokenScores {
+			if i == 0 {
+				scores[unloc] = score
+			} else if _, exists := scores[unloc]; exists {
+				scores[unloc] += score
+			}
+		}
+		for unloc := range scores {
+			if _, exists := tokenScores[unloc]; !exists {
+				delete(scores, unloc)
+			}
+		}
+	}
+
+	hits := make([]searchHit, 0, len(scores))
+	for unloc, score := range scores {
+		hits = append(hits, searchHit{unloc: unloc, score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score == hits[j].score {
+			return hits[i].unloc < hits[j].unloc
+		}
+		return hits[i].score > hits[j].score
+	})
+	return hits
+}
+
+// searchIndex is an inverted index from the searchable terms to the ports
+// containing them. It isn't safe for concurrent use.
+type searchIndex struct {
+	// postings holds the weight of each term for each one of the unlocs
+	postings map[string]map[string]float64
+	// terms holds the indexed terms of each one of the unlocs
+	terms map[string][]string
+	// vocabulary holds every indexed term sorted, so the ones starting with a
+	// token are next to each other
+	vocabulary []string
+	// lengths holds the indexed terms by their length in runes
+	lengths map[int]map[string]bool
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		postings: make(map[string]map[string]float64),
+		terms:    make(map[string][]string),
+		lengths:  make(map[int]map[string]bool),
+	}
+}
+
+// set indexes the port under the unloc, replacing its previous terms
+func (s *searchIndex) set(unloc string, port models.Port) {
+	s.remove(unloc)
+	terms := portTerms(port)
+	indexed := make([]string, 0, len(terms))
+	for term, weight := range terms {
+		if s.postings[term] == nil {
+			s.postings[term] = make(map[string]float64)
+			s.addTerm(term)
+		}
+		s.postings[term][unloc] = weight
+		indexed = append(indexed, term)
+	}
+	s.terms[unloc] = indexed
+}
+
+func (s *searchIndex) remove(unloc string) {
+	for _, term := range s.terms[unloc] {
+		delete(s.postings[term], unloc)
+		if len(s.postings[term]) == 0 {
+			delete(s.postings, term)
+			s.removeTerm(term)
+		}
+	}
+	delete(s.terms, unloc)
+}
+
+// search returns the unlocs matching every token of the query, best first
+func (s *searchIndex) search(query string) []searchHit {
+	tokens := tokenize(query)
+	if len(tokens) == 0 {
+		return []searchHit{}
+	}
+	matches := make([]map[string]float64, len(tokens))
+	for i, token := range tokens {
+		matches[i] = matchVocabulary([]string{token}, s.candidates(token))[0]
+	}
+	return rankHits(matches, s.postings)
+}
+
+// candidates returns the indexed terms starting with the token, along with the
+// ones close enough in length and containing one of its fuzzyPieces when
+// typos are tolerated on it, instead of the whole vocabulary
+func (s *searchIndex) candidates(token string) []string {
+	start := sort.SearchStrings(s.vocabulary, token)
+	end := start
+	for end < len(s.vocabulary) && strings.HasPrefix(s.vocabulary[end], token) {
+		end++
+	}
+	candidates := append([]string{}, s.vocabulary[start:end]...)
+
+	edits := maxEdits(token)
+	if edits == 0 {
+		return candidates
+	}
+	length := len([]rune(token))
+	pieces := fuzzyPieces(token, edits)
+	for l := length - edits; l <= length+edits; l++ {
+		for term := range s.lengths[l] {
+			if strings.HasPrefix(term, token) {
+				// already a candidate
+				continue
+			}
+			for _, piece := range pieces {
+				if strings.Contains(term, piece) {
+					candidates = append(candidates, term)
+					break
+				}
+			}
+		}
+	}
+	return candidates
+}
+
+// addTerm adds the newly indexed term to the vocabulary
+func (s *searchIndex) addTerm(term string) {
+	i := sort.SearchStrings(s.vocabulary, term)
+	s.vocabulary = append(s.vocabulary, "")
+	copy(s.vocabulary[i+1:], s.vocabulary[i:])
+	s.vocabulary[i] = term
+
+	length := len([]rune(term))
+	if s.lengths[length] == nil {
+		s.lengths[length] = make(map[string]bool)
+	}
+	s.lengths[length][term] = true
+}
+
+// removeTerm removes the term no longer indexed from the vocabulary
+func (s *searchIndex) removeTerm(term string) {
+	i := sort.SearchStrings(s.vocabulary, term)
+	if i < len(s.vocabulary) && s.vocabulary[i] == term {
+		s.vocabulary = append(s.vocabulary[:i], s.vocabulary[i+1:]...)
+	}
+
+	length := len([]rune(term))
+	delete(s.lengths[length], term)
+	if len(s.lengths[length]) == 0 {
+		delete(s.lengths, length)
+	}
+}
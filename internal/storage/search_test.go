@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/WendelHime/ports/internal/shared/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"sao", "sebastiao"}, tokenize("São Sebastião"))
+	assert.Equal(t, []string{"abu", "z", "aby", "abu", "dhabi"}, tokenize("Abu Z¸aby [Abu Dhabi]"))
+	assert.Equal(t, []string{"gdansk", "koln"}, tokenize("Gdańsk, KÖLN"))
+}
+
+func TestLevenshtein(t *testing.T) {
+	assert.Equal(t, 0, levenshtein("santos", "santos", 2))
+	assert.Equal(t, 2, levenshtein("santos", "sanots", 2))
+	assert.Equal(t, 1, levenshtein("rotterdam", "roterdam", 2))
+	assert.Equal(t, 3, levenshtein("abc", "xyzabc", 2))
+}
+
+func TestFuzzyPieces(t *testing.T) {
+	assert.Equal(t, []string{"santos"}, fuzzyPieces("santos", 0))
+	assert.Equal(t, []string{"san", "tos"}, fuzzyPieces("santos", 1))
+	assert.Equal(t, []string{"rot", "ter", "dam"}, fuzzyPieces("rotterdam", 2))
+	assert.Equal(t, []string{"sa", "ão"}, fuzzyPieces("saão", 1))
+}
+
+func TestSearchIndex(t *testing.T) {
+	var tests = []struct {
+		name   string
+		assert func(t *testing.T, index *searchIndex)
+		setup  func(index *searchIndex)
+	}{
+		{
+			name: "Exact matches should rank before prefix and fuzzy matches",
+			assert: func(t *testing.T, index *searchIndex) {
+				hits := index.search("santos")
+				assert.Len(t, hits, 3)
+				assert.Equal(t, "BRSSZ", hits[0].unloc)
+				assert.Equal(t, "PHSTS", hits[1].unloc)
+				assert.Equal(t, "XXSAN", hits[2].unloc)
+			},
+			setup: func(index *searchIndex) {
+				index.set("BRSSZ", models.Port{Name: "Santos"})
+				index.set("PHSTS", models.Port{Name: "General Santos City"})
+				index.set("XXSAN", models.Port{Name: "Santo"})
+			},
+		},
+		{
+			name: "Every query word should match",
+			assert: func(t *testing.T, index *searchIndex) {
+				hits := index.search("abu dha")
+				assert.Len(t, hits, 1)
+				assert.Equal(t, "AEAUH", hits[0].unloc)
+			},
+			setup: func(index *searchIndex) {
+				index.set("AEAUH", models.Port{Name: "Abu Dhabi", Province: "Abu Z¸aby [Abu Dhabi]"})
+				index.set("AEDXB", models.Port{Name: "Dubai"})
+				index.set("SAABU", models.Port{Name: "Abu Ali"})
+			},
+		},
+		{
+			name: "Name matches should rank before alias and province matches",
+			assert: func(t *testing.T, index *searchIndex) {
+				hits := index.search("Gdansk")
+				assert.Len(t, hits, 3)
+				assert.Equal(t, []string{"PLGDN", "PLXXX", "PLYYY"}, []string{hits[0].unloc, hits[1].unloc, hits[2].unloc})
+			},
+			setup: func(index *searchIndex) {
+				index.set("PLYYY", models.Port{Name: "Other", Province: "Gdańsk"})
+				index.set("PLXXX", models.Port{Name: "Another", Alias: []string{"Gdańsk Port"}})
+				index.set("PLGDN", models.Port{Name: "Gdańsk"})
+			},
+		},
+		{
+			name: "Removed ports should not be found",
+			assert: func(t *testing.T, index *searchIndex) {
+				assert.Empty(t, index.search("santos"))
+				assert.Empty(t, index.postings)
+				assert.Empty(t, index.vocabulary)
+				assert.Empty(t, index.lengths)
+			},
+			setup: func(index *searchIndex) {
+				index.set("BRSSZ", models.Port{Name: "Santos"})
+				index.set("BRSSZ", models.Port{Name: "Santos", City: "Santos"})
+				index.remove("BRSSZ")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := newSearchIndex()
+			tt.setup(index)
+			tt.assert(t, index)
+		})
+	}
+}
+
+func TestSearchIndexCandidates(t *testing.T) {
+	index := newSearchIndex()
+	index.set("BRSSZ", models.Port{Name: "Santos"})
+	index.set("PHSTS", models.Port{Name: "General Santos City"})
+	index.set("XXSAN", models.Port{Name: "Santo Sanatorium"})
+	index.set("AEDXB", models.Port{Name: "Dubai"})
+
+	assert.ElementsMatch(t, []string{"santos", "santo", "sanatorium"}, index.candidates("san"))
+	// sanatorium holds one of the pieces too, but is too long to be a typo
+	assert.ElementsMatch(t, []string{"santos", "santo"}, index.candidates("santox"))
+	assert.Empty(t, index.candidates("xyz"))
+}
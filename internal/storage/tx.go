@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/WendelHime/ports/internal/shared/models"
+)
+
+// portTx is a transaction over the in-memory repository. Writes are kept on a
+// staged overlay, shadowing the repository ports, and recorded as changes
+// handed all at once to commit.
+type portTx struct {
+	repo *portRepo
+	// staged holds the ports written by the transaction, nil when deleted
+	staged  map[string]*models.Port
+	changes []portChange
+	commit  func(ctx context.Context, changes []portChange) error
+	done    bool
+}
+
+func newPortTx(repo *portRepo, commit func(ctx context.Context, changes []portChange) error) *portTx {
+	return &portTx{
+		repo:   repo,
+		staged: make(map[string]*models.Port),
+		commit: commit,
+	}
+}
+
+func (tx *portTx) Create(ctx context.Context, port models.Port) error {
+	return tx.stagePut(port)
+}
+
+func (tx *portTx) Update(ctx context.Context, port models.Port) error {
+	return tx.stagePut(port)
+}
+
+func (tx *portTx) Get(ctx context.Context, unloc string) (models.Port, error) {
+	if tx.done {
+		return models.Port{}, ErrTxDone
+	}
+	port, exists := tx.get(unloc)
+	if !exists {
+		return models.Port{}, localErrs.ErrNotFound
+	}
+	return port, nil
+}
+
+func (tx *portTx) Delete(ctx context.Context, unloc string) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	port, exists := tx.get(unloc)
+	if !exists {
+		return localErrs.ErrNotFound
+	}
+	for _, other := range port.Unlocs {
+		if stored, exists := tx.get(other); exists && primaryUnloc(stored) == primaryUnloc(port) {
+			tx.staged[other] = nil
+		}
+	}
+	tx.staged[unloc] = nil
+	tx.changes = append(tx.changes, portChange{Op: opDelete, Unloc: unloc, Version: port.Version})
+	return nil
+}
+
+// List merges the staged overlay into a copy of the repository ports
+func (tx *portTx) List(ctx context.Context, filter models.PortFilter) (models.PortPage, error) {
+	if tx.done {
+		return models.PortPage{}, ErrTxDone
+	}
+	tx.repo.mutex.Lock()
+	ports := make(map[string]models.Port, len(tx.repo.ports)+len(tx.staged))
+	for unloc, port := range tx.repo.ports {
+		ports[unloc] = port
+	}
+	tx.repo.mutex.Unlock()
+
+	for unloc, port := range tx.staged {
+		if port == nil {
+			delete(ports, unloc)
+			continue
+		}
+		ports[unloc] = *port
+	}
+	return listPortMap(ports, filter)
+}
+
+func (tx *portTx) Commit(ctx context.Context) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	return tx.commit(ctx, tx.changes)
+}
+
+func (tx *portTx) Rollback(ctx context.Context) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	return nil
+}
+
+func (tx *portTx) stagePut(port models.Port) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	err := checkWrite(port, tx.get)
+	if err != nil {
+		return err
+	}
+	stored, exists := tx.get(primaryUnloc(port))
+	if exists {
+		for _, unloc := range stored.Unlocs {
+			if !containsString(port.Unlocs, unloc) {
+				tx.staged[unloc] = nil
+			}
+		}
+	}
+	port.Version = nextVersion(stored)
+	for _, unloc := range port.Unlocs {
+		staged := port
+		tx.staged[unloc] = &staged
+	}
+	tx.changes = append(tx.changes, portChange{Op: opPut, Port: port})
+	return nil
+}
+
+// get returns the port stored under the unloc as seen by the transaction
+func (tx *portTx) get(unloc string) (models.Port, bool) {
+	if port, staged := tx.staged[unloc]; staged {
+		if port == nil {
+			return models.Port{}, false
+		}
+		return *port, true
+	}
+	tx.repo.mutex.Lock()
+	defer tx.repo.mutex.Unlock()
+	port, exists := tx.repo.ports[unloc]
+	return port, exists
+}
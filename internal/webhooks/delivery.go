@@ -0,0 +1,255 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/WendelHime/ports/internal/logging"
+	"github.com/WendelHime/ports/internal/shared/models"
+)
+
+// Headers set on every delivery, the signature being the hex encoded
+// HMAC-SHA256 of the body keyed by the webhook secret
+const (
+	HeaderEvent     = "X-Ports-Event"
+	HeaderDelivery  = "X-Ports-Delivery"
+	HeaderSignature = "X-Ports-Signature"
+)
+
+// job is a delivery to be attempted
+type job struct {
+	delivery *models.Delivery
+	url      string
+	secret   string
+	body     []byte
+}
+
+// queue holds the pending deliveries of a webhook, attempted in order by a
+// single goroutine running while there are any
+type queue struct {
+	jobs    []job
+	running bool
+}
+
+// Run subscribes to the hub and delivers the changes published from now on,
+// resuming from the last one received when falling behind. Every webhook has
+// its own queue, so a slow or failing one only delays its own deliveries and
+// the hub is never kept waiting. It returns once the context is done and the
+// deliveries being attempted finish, the queued ones being failed.
+func (s *webhookService) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	sub := s.hub.Subscribe()
+	defer func() {
+		s.hub.Unsubscribe(sub)
+	}()
+	var last uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-sub.Events():
+			if ok {
+				last = event.Sequence
+				s.dispatch(ctx, &wg, event)
+				continue
+			}
+
+			var missed []models.PortEvent
+			var complete bool
+			sub, missed, complete = s.hub.Resume(last)
+			if !complete {
+				logging.FromContext(ctx).Warn("webhooks fell behind the port changes, some weren't delivered", "after_sequence", last)
+			}
+			for _, event := range missed {
+				last = event.Sequence
+				s.dispatch(ctx, &wg, event)
+			}
+		}
+	}
+}
+
+// dispatch records a pending delivery of the event to each webhook matching it
+// and queues it, without waiting for any delivery. A webhook with queueSize
+// deliveries pending has its oldest one failed to make room.
+func (s *webhookService) dispatch(ctx context.Context, wg *sync.WaitGroup, event models.PortEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to encode port change", "sequence", event.Sequence, "error", err.Error())
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, webhook := range s.webhooks {
+		if !matches(webhook, event.Port) {
+			continue
+		}
+		id, err := randomID()
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to generate delivery id", "error", err.Error())
+			continue
+		}
+		now := s.now()
+		delivery := &models.Delivery{
+			ID:        id,
+			WebhookID: webhook.ID,
+			Sequence:  event.Sequence,
+			Event:     event.Type,
+			Unloc:     event.Unloc,
+			Status:    models.DeliveryPending,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		kept := append(s.deliveries[webhook.ID], delivery)
+		if len(kept) > deliveriesKept {
+			kept = append([]*models.Delivery(nil), kept[len(kept)-deliveriesKept:]...)
+		}
+		s.deliveries[webhook.ID] = kept
+
+		q, exists := s.queues[webhook.ID]
+		if !exists {
+			q = &queue{}
+			s.queues[webhook.ID] = q
+		}
+		if len(q.jobs) >= queueSize {
+			s.update(q.jobs[0].delivery, models.DeliveryFailed, 0, 0, errQueueFull)
+			logging.FromContext(ctx).Warn("webhook delivery dropped, too many pending", "webhook_id", webhook.ID, "delivery_id", q.jobs[0].delivery.ID)
+			q.jobs = q.jobs[1:]
+		}
+		q.jobs = append(q.jobs, job{delivery: delivery, url: webhook.URL, secret: webhook.Secret, body: body})
+		if !q.running {
+			q.running = true
+			wg.Add(1)
+			go s.drain(ctx, wg, webhook.ID, q)
+		}
+	}
+}
+
+// drain attempts the deliveries of the webhook queue in order until it's
+// empty, failing them once the context is done
+func (s *webhookService) drain(ctx context.Context, wg *sync.WaitGroup, webhookID string, q *queue) {
+	defer wg.Done()
+	for {
+		s.mutex.Lock()
+		if len(q.jobs) == 0 {
+			q.running = false
+			delete(s.queues, webhookID)
+			s.mutex.Unlock()
+			return
+		}
+		j := q.jobs[0]
+		q.jobs = q.jobs[1:]
+		s.mutex.Unlock()
+
+		if ctx.Err() != nil {
+			s.record(j.delivery, models.DeliveryFailed, 0, 0, ctx.Err())
+			continue
+		}
+		s.deliver(ctx, j)
+	}
+}
+
+// deliver attempts the delivery until it succeeds, fails permanently or runs
+// out of attempts, waiting an exponential backoff between them
+func (s *webhookService) deliver(ctx context.Context, j job) {
+	backoff := s.opts.Backoff
+	for attempt := 1; ; attempt++ {
+		statusCode, err := s.post(ctx, j)
+		if err == nil {
+			s.record(j.delivery, models.DeliverySucceeded, attempt, statusCode, nil)
+			return
+		}
+		if attempt >= s.opts.MaxAttempts || !retryable(statusCode) {
+			s.record(j.delivery, models.DeliveryFailed, attempt, statusCode, err)
+			logging.FromContext(ctx).Warn("webhook delivery failed",
+				"webhook_id", j.delivery.WebhookID,
+				"delivery_id", j.delivery.ID,
+				"attempts", attempt,
+				"status", statusCode,
+				"error", err.Error(),
+			)
+			return
+		}
+		s.record(j.delivery, models.DeliveryPending, attempt, statusCode, err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.record(j.delivery, models.DeliveryFailed, attempt, statusCode, ctx.Err())
+			return
+		case <-timer.C:
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// post sends the signed body to the webhook, any answer but a 2xx one being
+// an error
+func (s *webhookService) post(ctx context.Context, j job) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.url, bytes.NewReader(j.body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, string(j.delivery.Event))
+	req.Header.Set(HeaderDelivery, j.delivery.ID)
+	req.Header.Set(HeaderSignature, "sha256="+Sign(j.secret, j.body))
+
+	res, err := s.opts.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("webhook answered with status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// record updates the delivery status with the outcome of its last attempt
+func (s *webhookService) record(delivery *models.Delivery, status models.DeliveryStatus, attempts, statusCode int, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.update(delivery, status, attempts, statusCode, err)
+}
+
+// update is record with the mutex held
+func (s *webhookService) update(delivery *models.Delivery, status models.DeliveryStatus, attempts, statusCode int, err error) {
+	delivery.Status = status
+	delivery.Attempts = attempts
+	delivery.StatusCode = statusCode
+	delivery.Error = ""
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	delivery.UpdatedAt = s.now()
+}
+
+// retryable reports whether an attempt answered with the status code, zero
+// when there was no answer, may succeed later
+func retryable(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the body keyed by the secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,247 @@
+// Package webhooks delivers the port changes to the registered webhooks
+package webhooks
+
+//go:generate mockgen -destination=./webhooks_mock.go -package=webhooks github.com/WendelHime/ports/internal/webhooks Service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WendelHime/ports/internal/events"
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/WendelHime/ports/internal/shared/models"
+)
+
+const (
+	// DefaultMaxAttempts is how many times a delivery is attempted
+	DefaultMaxAttempts = 5
+	// DefaultBackoff is the wait before the first retry, doubled on each one
+	DefaultBackoff = time.Second
+	// DefaultTimeout is how long a delivery attempt may take
+	DefaultTimeout = 10 * time.Second
+
+	// maxBackoff caps the wait between the retries
+	maxBackoff = 5 * time.Minute
+	// deliveriesKept is the amount of latest deliveries kept per webhook
+	deliveriesKept = 100
+	// queueSize is the amount of deliveries a webhook may have pending before
+	// the oldest ones are failed
+	queueSize = 1000
+)
+
+// errQueueFull fails the deliveries dropped from a full queue
+var errQueueFull = errors.New("too many deliveries pending for the webhook")
+
+// Service registers the webhooks and delivers the port changes to them
+type Service interface {
+	Register(ctx context.Context, webhook models.Webhook) (models.Webhook, error)
+	List(ctx context.Context) ([]models.Webhook, error)
+	Get(ctx context.Context, id string) (models.Webhook, error)
+	Delete(ctx context.Context, id string) error
+	// Deliveries returns the latest deliveries of the webhook, newest first
+	Deliveries(ctx context.Context, id string) ([]models.Delivery, error)
+	// Run delivers the changes published on the hub until the context is done
+	Run(ctx context.Context) error
+}
+
+// Options holds the delivery settings, the zero values meaning the defaults
+type Options struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	Timeout     time.Duration
+	// AllowPrivateTargets accepts webhooks on loopback, link-local and private
+	// addresses, rejected by default as they'd let the API reach the internal
+	// network
+	AllowPrivateTargets bool
+	// Client sends the deliveries, the default one refusing to connect to the
+	// private targets unless allowed
+	Client *http.Client
+}
+
+type webhookService struct {
+	hub  *events.Hub
+	opts Options
+
+	webhooks map[string]models.Webhook
+	// deliveries holds the latest deliveries of each webhook, oldest first
+	deliveries map[string][]*models.Delivery
+	// queues holds the pending deliveries of each webhook having any
+	queues map[string]*queue
+	mutex  *sync.Mutex
+	now    func() time.Time
+}
+
+// NewService returns the service delivering the changes published on hub. The
+// webhooks and their deliveries are kept in memory and lost on restart.
+func NewService(hub *events.Hub, opts Options) Service {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultBackoff
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Client == nil {
+		opts.Client = newClient(opts.Timeout, opts.AllowPrivateTargets)
+	}
+	return &webhookService{
+		hub:        hub,
+		opts:       opts,
+		webhooks:   make(map[string]models.Webhook),
+		deliveries: make(map[string][]*models.Delivery),
+		queues:     make(map[string]*queue),
+		mutex:      new(sync.Mutex),
+		now:        time.Now,
+	}
+}
+
+// Register validates and stores the webhook, generating its secret when none
+// is provided
+func (s *webhookService) Register(ctx context.Context, webhook models.Webhook) (models.Webhook, error) {
+	var verr []localErrs.FieldError
+	target, err := url.Parse(webhook.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		verr = append(verr, localErrs.FieldError{Field: "url", Message: "must be an absolute http or https URL"})
+	} else if !s.opts.AllowPrivateTargets && privateHost(target.Hostname()) {
+		verr = append(verr, localErrs.FieldError{Field: "url", Message: "must not target a loopback, link-local or private address"})
+	}
+	for _, unloc := range webhook.Unlocs {
+		if unloc == "" {
+			verr = append(verr, localErrs.FieldError{Field: "unlocs", Message: "must not be empty"})
+			break
+		}
+	}
+	for _, country := range webhook.Countries {
+		if strings.TrimSpace(country) == "" {
+			verr = append(verr, localErrs.FieldError{Field: "countries", Message: "must not be empty"})
+			break
+		}
+	}
+	if len(verr) > 0 {
+		return models.Webhook{}, localErrs.New(localErrs.CodeUnprocessableEntity, "invalid webhook", verr...)
+	}
+
+	webhook.ID, err = randomID()
+	if err != nil {
+		return models.Webhook{}, localErrs.Wrap(err, localErrs.CodeInternal, "failed to generate webhook id")
+	}
+	if webhook.Secret == "" {
+		webhook.Secret, err = randomID()
+		if err != nil {
+			return models.Webhook{}, localErrs.Wrap(err, localErrs.CodeInternal, "failed to generate webhook secret")
+		}
+	}
+	webhook.CreatedAt = s.now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.webhooks[webhook.ID] = webhook
+	return webhook, nil
+}
+
+// List returns the webhooks ordered by their creation, without their secrets
+func (s *webhookService) List(ctx context.Context) ([]models.Webhook, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	webhooks := make([]models.Webhook, 0, len(s.webhooks))
+	for _, webhook := range s.webhooks {
+		webhook.Secret = ""
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		if webhooks[i].CreatedAt.Equal(webhooks[j].CreatedAt) {
+			return webhooks[i].ID < webhooks[j].ID
+		}
+		return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+	})
+	return webhooks, nil
+}
+
+// Get returns the webhook without its secret
+func (s *webhookService) Get(ctx context.Context, id string) (models.Webhook, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	webhook, exists := s.webhooks[id]
+	if !exists {
+		return models.Webhook{}, notFound(id)
+	}
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+// Delete removes the webhook and its deliveries, the pending ones are still
+// attempted
+func (s *webhookService) Delete(ctx context.Context, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, exists := s.webhooks[id]; !exists {
+		return notFound(id)
+	}
+	delete(s.webhooks, id)
+	delete(s.deliveries, id)
+	return nil
+}
+
+// Deliveries returns the latest deliveries of the webhook, newest first
+func (s *webhookService) Deliveries(ctx context.Context, id string) ([]models.Delivery, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, exists := s.webhooks[id]; !exists {
+		return nil, notFound(id)
+	}
+	kept := s.deliveries[id]
+	deliveries := make([]models.Delivery, 0, len(kept))
+	for i := len(kept) - 1; i >= 0; i-- {
+		deliveries = append(deliveries, *kept[i])
+	}
+	return deliveries, nil
+}
+
+// matches reports whether the webhook filters accept the port
+func matches(webhook models.Webhook, port models.Port) bool {
+	if len(webhook.Countries) == 0 && len(webhook.Unlocs) == 0 {
+		return true
+	}
+	for _, unloc := range webhook.Unlocs {
+		for _, portUnloc := range port.Unlocs {
+			if strings.EqualFold(unloc, portUnloc) {
+				return true
+			}
+		}
+	}
+	for _, country := range webhook.Countries {
+		country = strings.TrimSpace(country)
+		if strings.EqualFold(country, port.Country) {
+			return true
+		}
+		// the country code is the prefix of the port unlocs
+		if len(country) == 2 && len(port.Unlocs) > 0 && strings.HasPrefix(strings.ToUpper(port.Unlocs[0]), strings.ToUpper(country)) {
+			return true
+		}
+	}
+	return false
+}
+
+func notFound(id string) error {
+	return localErrs.New(localErrs.CodeNotFound, fmt.Sprintf("webhook %s not found", id))
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,345 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WendelHime/ports/internal/events"
+	localErrs "github.com/WendelHime/ports/internal/shared/errors"
+	"github.com/WendelHime/ports/internal/shared/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegister(t *testing.T) {
+	var tests = []struct {
+		name           string
+		webhook        models.Webhook
+		opts           Options
+		expectedFields []string
+	}{
+		{
+			name:    "Valid webhook should be registered",
+			webhook: models.Webhook{URL: "https://example.com/ports", Countries: []string{"AE"}},
+		},
+		{
+			name:           "Relative URL should be rejected",
+			webhook:        models.Webhook{URL: "/ports"},
+			expectedFields: []string{"url"},
+		},
+		{
+			name:           "URL with another scheme should be rejected",
+			webhook:        models.Webhook{URL: "ftp://example.com"},
+			expectedFields: []string{"url"},
+		},
+		{
+			name:           "Loopback target should be rejected",
+			webhook:        models.Webhook{URL: "http://127.0.0.1:8080/ports"},
+			expectedFields: []string{"url"},
+		},
+		{
+			name:           "Local host name should be rejected",
+			webhook:        models.Webhook{URL: "http://localhost/ports"},
+			expectedFields: []string{"url"},
+		},
+		{
+			name:           "Link-local target should be rejected",
+			webhook:        models.Webhook{URL: "http://169.254.169.254/latest/meta-data"},
+			expectedFields: []string{"url"},
+		},
+		{
+			name:           "Private target should be rejected",
+			webhook:        models.Webhook{URL: "https://[fd00::1]/ports"},
+			expectedFields: []string{"url"},
+		},
+		{
+			name:    "Private target should be registered when allowed",
+			webhook: models.Webhook{URL: "http://10.0.0.1/ports"},
+			opts:    Options{AllowPrivateTargets: true},
+		},
+		{
+			name:           "Empty filters should be rejected",
+			webhook:        models.Webhook{URL: "http://example.com", Unlocs: []string{""}, Countries: []string{" "}},
+			expectedFields: []string{"unlocs", "countries"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewService(events.NewHub(10), tt.opts)
+			webhook, err := service.Register(context.Background(), tt.webhook)
+			if len(tt.expectedFields) > 0 {
+				var lerr *localErrs.Error
+				require.ErrorAs(t, err, &lerr)
+				assert.Equal(t, localErrs.CodeUnprocessableEntity, lerr.Code)
+				fields := make([]string, 0, len(lerr.Details))
+				for _, detail := range lerr.Details {
+					fields = append(fields, detail.Field)
+				}
+				assert.Equal(t, tt.expectedFields, fields)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotEmpty(t, webhook.ID)
+			assert.NotEmpty(t, webhook.Secret)
+
+			stored, err := service.Get(context.Background(), webhook.ID)
+			require.NoError(t, err)
+			assert.Empty(t, stored.Secret)
+			assert.Equal(t, tt.webhook.URL, stored.URL)
+		})
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	service := NewService(events.NewHub(10), Options{})
+	webhook, err := service.Register(context.Background(), models.Webhook{URL: "http://example.com"})
+	require.NoError(t, err)
+	require.NoError(t, service.Delete(context.Background(), webhook.ID))
+
+	_, err = service.Get(context.Background(), webhook.ID)
+	assert.ErrorIs(t, err, localErrs.ErrNotFound)
+	_, err = service.Deliveries(context.Background(), webhook.ID)
+	assert.ErrorIs(t, err, localErrs.ErrNotFound)
+	err = service.Delete(context.Background(), webhook.ID)
+	assert.ErrorIs(t, err, localErrs.ErrNotFound)
+	webhooks, err := service.List(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, webhooks)
+}
+
+func TestMatches(t *testing.T) {
+	port := models.Port{Unloc: "AEAJM", Unlocs: []string{"AEAJM", "AEQAJ"}, Country: "United Arab Emirates"}
+	var tests = []struct {
+		name     string
+		webhook  models.Webhook
+		expected bool
+	}{
+		{
+			name:     "Webhook without filters should match every port",
+			webhook:  models.Webhook{},
+			expected: true,
+		},
+		{
+			name:     "Webhook should match any of the port unlocs",
+			webhook:  models.Webhook{Unlocs: []string{"BRSSZ", "aeqaj"}},
+			expected: true,
+		},
+		{
+			name:     "Webhook should match the country name",
+			webhook:  models.Webhook{Countries: []string{"united arab emirates"}},
+			expected: true,
+		},
+		{
+			name:     "Webhook should match the country code",
+			webhook:  models.Webhook{Countries: []string{"ae"}},
+			expected: true,
+		},
+		{
+			name:     "Webhook of other ports shouldn't match",
+			webhook:  models.Webhook{Countries: []string{"BR", "Brazil"}, Unlocs: []string{"BRSSZ"}},
+			expected: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, matches(tt.webhook, port))
+		})
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	event := models.PortEvent{
+		Sequence: 7,
+		Type:     models.AuditUpdated,
+		Unloc:    "AEAJM",
+		Port:     models.Port{Unloc: "AEAJM", Unlocs: []string{"AEAJM"}, Name: "Ajman"},
+	}
+	var tests = []struct {
+		name               string
+		statuses           []int
+		expectedStatus     models.DeliveryStatus
+		expectedAttempts   int
+		expectedStatusCode int
+	}{
+		{
+			name:               "Accepted delivery should succeed on the first attempt",
+			statuses:           []int{http.StatusNoContent},
+			expectedStatus:     models.DeliverySucceeded,
+			expectedAttempts:   1,
+			expectedStatusCode: http.StatusNoContent,
+		},
+		{
+			name:               "Delivery should be retried until accepted",
+			statuses:           []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			expectedStatus:     models.DeliverySucceeded,
+			expectedAttempts:   3,
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "Rejected delivery shouldn't be retried",
+			statuses:           []int{http.StatusBadRequest},
+			expectedStatus:     models.DeliveryFailed,
+			expectedAttempts:   1,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:               "Delivery should fail once out of attempts",
+			statuses:           []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError},
+			expectedStatus:     models.DeliveryFailed,
+			expectedAttempts:   3,
+			expectedStatusCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				assert.NoError(t, err)
+				assert.Equal(t, "sha256="+Sign("secret", body), r.Header.Get(HeaderSignature))
+				assert.Equal(t, "updated", r.Header.Get(HeaderEvent))
+				assert.NotEmpty(t, r.Header.Get(HeaderDelivery))
+				assert.Contains(t, string(body), `"sequence":7`)
+
+				call := atomic.AddInt32(&calls, 1)
+				w.WriteHeader(tt.statuses[int(call)-1])
+			}))
+			defer server.Close()
+
+			service := NewService(events.NewHub(10), Options{MaxAttempts: 3, Backoff: time.Millisecond, AllowPrivateTargets: true}).(*webhookService)
+			webhook, err := service.Register(context.Background(), models.Webhook{URL: server.URL, Secret: "secret"})
+			require.NoError(t, err)
+
+			var wg sync.WaitGroup
+			service.dispatch(context.Background(), &wg, event)
+			wg.Wait()
+
+			deliveries, err := service.Deliveries(context.Background(), webhook.ID)
+			require.NoError(t, err)
+			require.Len(t, deliveries, 1)
+			assert.Equal(t, tt.expectedStatus, deliveries[0].Status)
+			assert.Equal(t, tt.expectedAttempts, deliveries[0].Attempts)
+			assert.Equal(t, tt.expectedStatusCode, deliveries[0].StatusCode)
+			assert.Equal(t, uint64(7), deliveries[0].Sequence)
+			assert.Equal(t, "AEAJM", deliveries[0].Unloc)
+			assert.Equal(t, int32(tt.expectedAttempts), atomic.LoadInt32(&calls))
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	received := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get(HeaderEvent)
+	}))
+	defer server.Close()
+
+	hub := events.NewHub(10)
+	service := NewService(hub, Options{Backoff: time.Millisecond, AllowPrivateTargets: true})
+	_, err := service.Register(context.Background(), models.Webhook{URL: server.URL, Countries: []string{"AE"}})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- service.Run(ctx)
+	}()
+
+	// the port changes published before Run subscribes aren't delivered, so
+	// they're published until one is
+	port := models.Port{Unloc: "AEAJM", Unlocs: []string{"AEAJM"}}
+	other := models.Port{Unloc: "BRSSZ", Unlocs: []string{"BRSSZ"}}
+	require.Eventually(t, func() bool {
+		hub.PortsChanged([]models.AuditEntry{
+			{Unloc: "BRSSZ", Action: models.AuditUpdated, New: &other},
+			{Unloc: "AEAJM", Action: models.AuditCreated, New: &port},
+		})
+		select {
+		case event := <-received:
+			assert.Equal(t, "created", event)
+			return true
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't return once the context was done")
+	}
+}
+
+func TestDeliverPrivateTarget(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer server.Close()
+
+	// a name resolving to a private address passes Register, the connection
+	// is refused instead
+	service := NewService(events.NewHub(10), Options{MaxAttempts: 1}).(*webhookService)
+	delivery := &models.Delivery{ID: "delivery"}
+	service.deliver(context.Background(), job{delivery: delivery, url: server.URL, secret: "secret", body: []byte("{}")})
+	assert.Equal(t, models.DeliveryFailed, delivery.Status)
+	assert.Contains(t, delivery.Error, "isn't allowed")
+	assert.Zero(t, atomic.LoadInt32(&calls))
+}
+
+func TestRunSlowWebhooks(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+	received := make(chan uint64, 100)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event models.PortEvent
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		received <- event.Sequence
+	}))
+	defer fast.Close()
+
+	hub := events.NewHub(10)
+	service := NewService(hub, Options{Timeout: time.Minute, AllowPrivateTargets: true}).(*webhookService)
+	for i := 0; i < 8; i++ {
+		_, err := service.Register(context.Background(), models.Webhook{URL: slow.URL})
+		require.NoError(t, err)
+	}
+	_, err := service.Register(context.Background(), models.Webhook{URL: fast.URL})
+	require.NoError(t, err)
+
+	// the slow webhooks shouldn't hold the deliveries to the others back
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	port := models.Port{Unloc: "AEAJM", Unlocs: []string{"AEAJM"}}
+	for sequence := uint64(1); sequence <= 3; sequence++ {
+		service.dispatch(ctx, &wg, models.PortEvent{Sequence: sequence, Type: models.AuditUpdated, Unloc: "AEAJM", Port: port})
+	}
+	for sequence := uint64(1); sequence <= 3; sequence++ {
+		select {
+		case received := <-received:
+			// each webhook receives its deliveries in order
+			assert.Equal(t, sequence, received)
+		case <-time.After(time.Second):
+			t.Fatal("the deliveries were held back by the slow webhooks")
+		}
+	}
+	cancel()
+	wg.Wait()
+}